@@ -0,0 +1,236 @@
+package main
+
+import (
+	"dockerImageMigrator/harbor"
+	"dockerImageMigrator/log"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// archive 导出导入使用的本地存储，OCI 目录或 tar 包
+type archive struct {
+	*harbor.OCILayout
+	tar *harbor.TarArchive
+}
+
+// openArchive 打开 OCI 目录或 tar 包，以 .tar 结尾或已存在的普通文件按 tar 包处理
+func openArchive(path string) (*archive, error) {
+	info, err := os.Stat(path)
+	if strings.HasSuffix(strings.ToLower(path), ".tar") || (err == nil && !info.IsDir()) {
+		tar, err := harbor.OpenTarArchive(path)
+		if err != nil {
+			return nil, err
+		}
+		return &archive{OCILayout: tar.OCILayout, tar: tar}, nil
+	}
+	layout, err := harbor.NewOCILayout(path)
+	if err != nil {
+		return nil, err
+	}
+	return &archive{OCILayout: layout}, nil
+}
+
+// registry 返回写入时使用的仓库，tar 包需要记录写入以便 Close 时重新打包
+func (a *archive) registry() harbor.Registry {
+	if a.tar != nil {
+		return a.tar
+	}
+	return a.OCILayout
+}
+
+// Close 关闭 tar 包，写入过时重新打包
+func (a *archive) Close() error {
+	if a.tar != nil {
+		return a.tar.Close()
+	}
+	return nil
+}
+
+// exportImages 将源仓库中的镜像导出到 OCI 目录或 tar 包，供离线环境使用 import 导入
+func exportImages(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := fs.String("o", "", "输出的 OCI 目录或 .tar 文件")
+	jsonOutput := fs.Bool("json", false, "以 JSON 格式输出报告")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: migrator export -o <目录|文件.tar> [-json] <镜像地址|yaml文件|->...")
+		fmt.Fprintln(fs.Output(), "参数为 - 时从标准输入逐行读取镜像地址")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 || *output == "" {
+		fs.Usage()
+		return exitUsage
+	}
+
+	images, err := collectImages(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+	dst, err := openArchive(*output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+
+	var results []imageResult
+	for _, image := range images {
+		result := imageResult{Source: image}
+		registry, path, tag, err := parseImage(image)
+		switch {
+		case err != nil:
+			result.Error = err.Error()
+		case strings.HasPrefix(tag, "sha256:"):
+			result.Error = "导出需要带标签的镜像地址"
+		default:
+			log.Infof("正在导出 %s", image)
+			src := harbor.NewHTTPRegistryFromConfig(sourceHarbor(registry, path, tag))
+			if err := harbor.CopyImage(src, path, tag, dst.registry(), path, tag); err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Dest = fmt.Sprintf("%s:%s", strings.TrimPrefix(path, "/"), tag)
+				result.OK = true
+			}
+		}
+		results = append(results, result)
+	}
+
+	failed := countFailed(results)
+	if err := dst.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		failed = len(results)
+	}
+
+	if *jsonOutput {
+		printJSON(results)
+	} else {
+		printImageResults(os.Stdout, results)
+		fmt.Printf("\n共 %d 个镜像，导出到 %s，失败 %d\n", len(results), *output, failed)
+	}
+
+	if failed > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// importImages 将 OCI 目录或 tar 包中的全部镜像按映射规则推送到目标仓库
+func importImages(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	jsonOutput := fs.Bool("json", false, "以 JSON 格式输出报告")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: migrator import [-json] <目录|文件.tar|->")
+		fmt.Fprintln(fs.Output(), "参数为 - 时从标准输入读取 tar 包")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	path := fs.Arg(0)
+	if path == stdinArg {
+		tmp, err := stdinToTemp()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitUsage
+		}
+		defer os.Remove(tmp)
+		path = tmp
+	} else if _, err := os.Stat(path); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+
+	src, err := openArchive(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+	defer src.Close()
+
+	repos, err := src.Repositories()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+
+	var results []imageResult
+	for _, repo := range repos {
+		tags, err := src.ListTags(repo)
+		if err != nil {
+			results = append(results, imageResult{Source: repo, Error: err.Error()})
+			continue
+		}
+		for _, tag := range tags {
+			results = append(results, importImage(src.OCILayout, repo, tag))
+		}
+	}
+
+	failed := countFailed(results)
+	if *jsonOutput {
+		printJSON(results)
+	} else {
+		printImageResults(os.Stdout, results)
+		fmt.Printf("\n共 %d 个镜像，失败 %d\n", len(results), failed)
+	}
+
+	if failed > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// importImage 将归档中的 repo:tag 推送到目标仓库，目标中已存在时跳过
+func importImage(src *harbor.OCILayout, repo, tag string) imageResult {
+	dest, _ := destImage("/"+repo, tag)
+	result := imageResult{
+		Source: fmt.Sprintf("%s:%s", repo, tag),
+		Dest:   formatImage(dest.HarborHost, dest.ImagePath, dest.ImageTag),
+	}
+
+	dst := harbor.NewHTTPRegistryFromConfig(dest)
+	exist, err := dst.ManifestExists(dest.ImagePath, dest.ImageTag)
+	if err != nil {
+		log.Errorf("检查镜像 %s 失败: %v", result.Dest, err)
+	}
+	if exist {
+		log.Infof("检测到镜像 %s 已存在，跳过", result.Dest)
+		result.OK = true
+		return result
+	}
+
+	log.Infof("正在导入 %s 到 %s", result.Source, result.Dest)
+	if err := harbor.CopyImage(src, repo, tag, dst, dest.ImagePath, dest.ImageTag); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.OK = true
+	return result
+}
+
+// stdinToTemp 将标准输入保存到临时文件，返回文件路径
+func stdinToTemp() (string, error) {
+	tmp, err := os.CreateTemp("", "migrator-import-*.tar")
+	if err != nil {
+		return "", fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	if _, err := io.Copy(tmp, os.Stdin); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("读取标准输入失败: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("写入临时文件失败: %v", err)
+	}
+	return tmp.Name(), nil
+}
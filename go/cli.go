@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"dockerImageMigrator/workload"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// 子命令退出码
+const (
+	exitOK     = 0 // 全部成功
+	exitFailed = 1 // 存在处理失败的镜像或文件
+	exitUsage  = 2 // 参数、配置或输入错误
+)
+
+// stdinArg 作为参数时表示从标准输入读取
+const stdinArg = "-"
+
+// stdinName 从标准输入读取的清单在报告与远程文件名中使用的名称
+const stdinName = "stdin.yaml"
+
+// command 一个子命令，run 返回退出码；journal 为 true 时子命令解析参数后通过 startJournal 记录到迁移日志，中断后可以 resume
+type command struct {
+	name    string
+	usage   string
+	run     func(args []string) int
+	journal bool
+}
+
+// commands 需要加载迁移配置的子命令，serve 与 secrets 在加载配置前单独处理。
+// resume 需要按名称查找子命令，因此在 init 中初始化以避免初始化循环
+var commands []command
+
+func init() {
+	commands = []command{
+		{"migrate", "迁移镜像到目标仓库", migrate, true},
+		{"deploy", "迁移 yaml 中的镜像并部署到集群", deployCommand, true},
+		{"rewrite", "迁移并改写 yaml 中的镜像，结果写入文件", rewrite, true},
+		{"verify", "校验源与目标仓库中的镜像是否一致", verify, false},
+		{"export", "将镜像导出到 OCI 目录或 tar 包", exportImages, false},
+		{"import", "将 OCI 目录或 tar 包中的镜像推送到目标仓库", importImages, false},
+		{"helm", "迁移 helm chart 中的镜像并生成 values 覆盖文件", helmChart, true},
+		{"kustomize", "迁移 kustomize 目录中的镜像并写入 images 配置", kustomizeDir, true},
+		{"compose", "迁移 docker compose 文件中的镜像并上传到远程主机", compose, true},
+		{"robots", "查看与清理目标 Harbor 中用于拉取镜像的机器人账号", robots, false},
+		{"resume", "恢复中断或失败的运行，跳过已完成的镜像并续传未完成的 blob", resume, false},
+		{"interactive", "交互模式，拖拽 yaml 文件进行部署", interactive, false},
+	}
+}
+
+// findCommand 按名称查找子命令
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// usage 打印全局用法
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "用法: migrator [--config 配置文件] <子命令> [参数]")
+	fmt.Fprintln(w, "\n子命令:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(w, "  %-12s %s\n", "serve", "启动本地 OCI 镜像仓库")
+	fmt.Fprintf(w, "  %-12s %s\n", "secrets", "管理加密保险库中的凭据")
+	fmt.Fprintln(w, "\n不带子命令时进入交互模式，参数为 - 时从标准输入读取；使用 migrator <子命令> -h 查看参数")
+}
+
+// imageResult 单个镜像的处理结果
+type imageResult struct {
+	Source string `json:"source"`
+	Dest   string `json:"dest,omitempty"`
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+}
+
+// countFailed 返回失败的镜像数
+func countFailed(results []imageResult) int {
+	failed := 0
+	for _, result := range results {
+		if !result.OK {
+			failed++
+		}
+	}
+	return failed
+}
+
+// printImageResults 逐个镜像打印处理结果
+func printImageResults(w io.Writer, results []imageResult) {
+	for _, result := range results {
+		if result.OK {
+			fmt.Fprintf(w, "✅ %s -> %s\n", result.Source, result.Dest)
+		} else {
+			fmt.Fprintf(w, "❌ %s: %s\n", result.Source, result.Error)
+		}
+	}
+}
+
+// printJSON 以缩进的 JSON 格式输出到标准输出
+func printJSON(v interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+// readStdinLines 从标准输入逐行读取参数，忽略空行与 # 开头的注释
+func readStdinLines() ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取标准输入失败: %v", err)
+	}
+	return lines, nil
+}
+
+// expandStdinArgs 将参数中的 - 替换为从标准输入读取的各行
+func expandStdinArgs(args []string) ([]string, error) {
+	var expanded []string
+	for _, arg := range args {
+		if arg != stdinArg {
+			expanded = append(expanded, arg)
+			continue
+		}
+		lines, err := readStdinLines()
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, lines...)
+	}
+	return expanded, nil
+}
+
+// readManifest 读取 yaml 清单，path 为 - 时从标准输入读取
+func readManifest(path string) (*workload.File, error) {
+	if path != stdinArg {
+		return workload.ReadFile(path)
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("读取标准输入失败: %v", err)
+	}
+	return workload.Parse(data)
+}
+
+// manifestName 返回清单在报告与远程文件名中使用的名称
+func manifestName(path string) string {
+	if path == stdinArg {
+		return stdinName
+	}
+	return path
+}
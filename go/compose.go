@@ -0,0 +1,98 @@
+package main
+
+import (
+	"dockerImageMigrator/log"
+	"dockerImageMigrator/workload"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// composeProject 根据本地文件名生成 compose 项目名，只保留小写字母、数字、- 与 _。
+// 远程文件名带时间戳，不指定项目名时同一目录下的所有文件会被当作同一个项目
+func composeProject(localFile string) string {
+	name := strings.ToLower(strings.TrimSuffix(filepath.Base(localFile), filepath.Ext(localFile)))
+	name = strings.TrimPrefix(strings.TrimPrefix(name, "docker-compose"), "compose")
+	if name == "" || name == "." {
+		name = filepath.Base(filepath.Dir(localFile))
+	}
+	project := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return -1
+	}, strings.Trim(name, ".-_"))
+	if project == "" {
+		project = "migrator"
+	}
+	return project
+}
+
+// composeUpCommand 生成在远程主机上启动 compose 文件的命令，路径可能含空格等字符，参数都加引号
+func composeUpCommand(localFile, remotePath string) string {
+	return fmt.Sprintf("docker compose -p %s -f %s up -d", shellQuote(composeProject(localFile)), shellQuote(remotePath))
+}
+
+// compose 迁移 docker compose 文件中的镜像，改写后上传到远程主机，-up 时随后启动
+func compose(args []string) int {
+	fs := flag.NewFlagSet("compose", flag.ContinueOnError)
+	up := fs.Bool("up", false, "上传后执行 docker compose up -d")
+	noMigrate := fs.Bool("no-migrate", false, "只改写镜像地址，不迁移镜像")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: migrator compose [-up] [-no-migrate] <docker-compose.yml>...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	startJournal("compose", args)
+
+	failed := 0
+	for _, localFile := range fs.Args() {
+		file, err := workload.ReadFile(localFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", localFile, err)
+			failed++
+			continue
+		}
+		if !file.IsCompose() {
+			fmt.Fprintf(os.Stderr, "❌ %s 不是 docker compose 文件\n", localFile)
+			failed++
+			continue
+		}
+
+		log.Info(">>>>>> 开始处理 compose 文件", localFile)
+		if n := countFailed(rewriteImages(file, !*noMigrate)); n > 0 {
+			failed++
+		}
+		data, err := file.Bytes()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", localFile, err)
+			failed++
+			continue
+		}
+
+		var command func(string) string
+		if *up {
+			command = func(remotePath string) string { return composeUpCommand(localFile, remotePath) }
+		}
+		if _, _, err := remoteDeploy(localFile, string(data), command); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", localFile, err)
+			failed++
+			continue
+		}
+		fmt.Printf("👌 %s 处理结束\n", localFile)
+	}
+
+	if failed > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
@@ -0,0 +1,11 @@
+package main
+
+import "testing"
+
+func TestComposeUpCommandQuotesArguments(t *testing.T) {
+	got := composeUpCommand("my app/docker-compose.yml", "/opt/deploy dir/it's_20260101000000.yml")
+	want := `docker compose -p 'myapp' -f '/opt/deploy dir/it'\''s_20260101000000.yml' up -d`
+	if got != want {
+		t.Errorf("composeUpCommand = %s，期望 %s", got, want)
+	}
+}
@@ -0,0 +1,511 @@
+package config
+
+import (
+	"dockerImageMigrator/harbor"
+	"dockerImageMigrator/ssh"
+	"dockerImageMigrator/vault"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultFiles 未指定配置文件时在当前目录查找的文件
+var DefaultFiles = []string{"migrator.yaml", "migrator.yml", "migrator.toml"}
+
+// TLS 仓库的 TLS 设置
+type TLS struct {
+	Verify   bool   `yaml:"verify" toml:"verify"`
+	CAFile   string `yaml:"caFile" toml:"caFile"`
+	CertFile string `yaml:"certFile" toml:"certFile"`
+	KeyFile  string `yaml:"keyFile" toml:"keyFile"`
+}
+
+// Options 转换为 harbor.TLSOptions
+func (t TLS) Options() harbor.TLSOptions {
+	return harbor.TLSOptions{Verify: t.Verify, CAFile: t.CAFile, CertFile: t.CertFile, KeyFile: t.KeyFile}
+}
+
+// Registry 源仓库的凭据与 TLS 设置，host 为 * 的条目用于未单独配置的仓库
+type Registry struct {
+	Host     string `yaml:"host" toml:"host"`
+	API      string `yaml:"api" toml:"api"` // 接口地址，默认为 https://<host>
+	Username string `yaml:"username" toml:"username"`
+	Password string `yaml:"password" toml:"password"`
+	TLS      TLS    `yaml:"tls" toml:"tls"`
+}
+
+// Destination 目标 Harbor
+type Destination struct {
+	API      string `yaml:"api" toml:"api"`   // 接口地址，如 https://10.100.100.21:10080
+	Host     string `yaml:"host" toml:"host"` // 写入 yaml 的镜像地址前缀，默认取 api 的主机名
+	Username string `yaml:"username" toml:"username"`
+	Password string `yaml:"password" toml:"password"`
+	TLS      TLS    `yaml:"tls" toml:"tls"`
+}
+
+// SSHTarget 部署目标主机
+type SSHTarget struct {
+	Name      string `yaml:"name" toml:"name"`
+	Host      string `yaml:"host" toml:"host"`
+	Port      int    `yaml:"port" toml:"port"`
+	Username  string `yaml:"username" toml:"username"`
+	Password  string `yaml:"password" toml:"password"`
+	KeyFile   string `yaml:"keyFile" toml:"keyFile"`
+	RemoteDir string `yaml:"remoteDir" toml:"remoteDir"`
+}
+
+// Kubernetes 通过 API 直接部署时使用的集群，配置后 deploy 不再经由 SSH 执行 kubectl
+type Kubernetes struct {
+	Kubeconfig string     `yaml:"kubeconfig" toml:"kubeconfig"` // 默认为 KUBECONFIG 或 ~/.kube/config
+	Context    string     `yaml:"context" toml:"context"`       // 默认为 current-context
+	PullSecret PullSecret `yaml:"pullSecret" toml:"pullSecret"`
+}
+
+// 拉取凭据写入的位置
+const (
+	PullSecretPod            = "pod"            // 写入每个改写后的 pod spec
+	PullSecretServiceAccount = "serviceaccount" // 写入命名空间的 default ServiceAccount
+)
+
+// DefaultRobotDays 机器人账号默认的有效天数
+const DefaultRobotDays = 90
+
+// PullSecret 部署时在目标命名空间中创建的拉取凭据，name 为空时不创建。
+// robot 为 true 时为每个命名空间创建只读的 Harbor 机器人账号；否则使用 username，未配置时使用 destination 的凭据
+type PullSecret struct {
+	Name      string `yaml:"name" toml:"name"`
+	Target    string `yaml:"target" toml:"target"` // pod（默认）或 serviceaccount
+	Username  string `yaml:"username" toml:"username"`
+	Password  string `yaml:"password" toml:"password"`
+	Robot     bool   `yaml:"robot" toml:"robot"`
+	RobotDays int    `yaml:"robotDays" toml:"robotDays"` // 机器人账号的有效天数，默认 90，-1 表示永不过期
+}
+
+// Credentials 返回拉取凭据使用的用户名与密码
+func (p PullSecret) Credentials(dest Destination) (username, password string) {
+	if p.Username != "" {
+		return p.Username, p.Password
+	}
+	return dest.Username, dest.Password
+}
+
+// Enabled 判断是否配置了 Kubernetes API 部署
+func (k Kubernetes) Enabled() bool {
+	return k.Kubeconfig != "" || k.Context != ""
+}
+
+// Config 迁移工具的配置
+type Config struct {
+	Registries  []*Registry  `yaml:"registries" toml:"registries"`
+	Destination Destination  `yaml:"destination" toml:"destination"`
+	SSH         []*SSHTarget `yaml:"ssh" toml:"ssh"`
+	Kubernetes  Kubernetes   `yaml:"kubernetes" toml:"kubernetes"`
+
+	// DockerConfig 查找源仓库凭据的 docker 配置文件，默认为 ~/.docker/config.json
+	DockerConfig string `yaml:"dockerConfig" toml:"dockerConfig"`
+
+	// Vault 解析 vault:<名称> 引用的保险库文件，默认为 MIGRATOR_VAULT 或 ~/.migrator/vault.json
+	Vault string `yaml:"vault" toml:"vault"`
+
+	// Journal 迁移日志文件，用于中断后 resume，默认为 MIGRATOR_JOURNAL 或 ~/.migrator/journal.jsonl，
+	// 设为 off 时不记录
+	Journal string `yaml:"journal" toml:"journal"`
+
+	// Path 配置文件路径，未使用配置文件时为空
+	Path string `yaml:"-" toml:"-"`
+}
+
+// Find 返回要加载的配置文件：显式指定的路径、MIGRATOR_CONFIG，或当前目录下的默认文件
+func Find(explicit string) string {
+	if explicit != "" {
+		return explicit
+	}
+	if path := os.Getenv("MIGRATOR_CONFIG"); path != "" {
+		return path
+	}
+	for _, name := range DefaultFiles {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// Load 加载配置文件（按扩展名解析 YAML 或 TOML），应用环境变量覆盖后校验。
+// path 为空时只使用环境变量
+func Load(path string) (*Config, error) {
+	cfg := &Config{Path: path}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取配置文件失败: %v", err)
+		}
+		if strings.EqualFold(filepath.Ext(path), ".toml") {
+			err = toml.Unmarshal(data, cfg)
+		} else {
+			err = yaml.Unmarshal(data, cfg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+		}
+	}
+
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	cfg.setDefaults()
+	if err := cfg.Validate(); err != nil {
+		if path == "" {
+			return nil, fmt.Errorf("未找到配置文件（可用 --config 或 MIGRATOR_CONFIG 指定）: %v", err)
+		}
+		return nil, fmt.Errorf("配置文件 %s 无效: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// ApplyEnv 使用环境变量覆盖配置：
+// MIGRATOR_DEST_API/HOST/USERNAME/PASSWORD 覆盖目标仓库，
+// MIGRATOR_SOURCE_USERNAME/PASSWORD 覆盖默认（host 为 *）的源仓库凭据，
+// MIGRATOR_SSH_HOST/PORT/USERNAME/PASSWORD/KEY_FILE/REMOTE_DIR 覆盖第一个 SSH 目标
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	set := func(name string, field *string) {
+		if value, ok := lookup(name); ok {
+			*field = value
+		}
+	}
+
+	set("MIGRATOR_DEST_API", &c.Destination.API)
+	set("MIGRATOR_DEST_HOST", &c.Destination.Host)
+	set("MIGRATOR_DEST_USERNAME", &c.Destination.Username)
+	set("MIGRATOR_DEST_PASSWORD", &c.Destination.Password)
+
+	_, hasUser := lookup("MIGRATOR_SOURCE_USERNAME")
+	_, hasPassword := lookup("MIGRATOR_SOURCE_PASSWORD")
+	if hasUser || hasPassword {
+		fallback := c.registry("*")
+		if fallback == nil {
+			fallback = &Registry{Host: "*"}
+			c.Registries = append(c.Registries, fallback)
+		}
+		set("MIGRATOR_SOURCE_USERNAME", &fallback.Username)
+		set("MIGRATOR_SOURCE_PASSWORD", &fallback.Password)
+	}
+
+	if _, ok := lookup("MIGRATOR_SSH_HOST"); ok && len(c.SSH) == 0 {
+		c.SSH = append(c.SSH, &SSHTarget{Name: "default"})
+	}
+	if len(c.SSH) > 0 {
+		target := c.SSH[0]
+		set("MIGRATOR_SSH_HOST", &target.Host)
+		set("MIGRATOR_SSH_USERNAME", &target.Username)
+		set("MIGRATOR_SSH_PASSWORD", &target.Password)
+		set("MIGRATOR_SSH_KEY_FILE", &target.KeyFile)
+		set("MIGRATOR_SSH_REMOTE_DIR", &target.RemoteDir)
+		if value, ok := lookup("MIGRATOR_SSH_PORT"); ok {
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("环境变量 MIGRATOR_SSH_PORT 不是有效的端口: %s", value)
+			}
+			target.Port = port
+		}
+	}
+	return nil
+}
+
+// setDefaults 填充可省略的字段
+func (c *Config) setDefaults() {
+	if c.Destination.Host == "" {
+		if u, err := url.Parse(c.Destination.API); err == nil {
+			c.Destination.Host = u.Host
+		}
+	}
+	for i, target := range c.SSH {
+		if target.Name == "" && i == 0 {
+			target.Name = "default"
+		}
+		if target.Port == 0 {
+			target.Port = 22
+		}
+		if target.RemoteDir != "" && !strings.HasSuffix(target.RemoteDir, "/") {
+			target.RemoteDir += "/"
+		}
+	}
+	if c.Kubernetes.PullSecret.Target == "" {
+		c.Kubernetes.PullSecret.Target = PullSecretPod
+	}
+	if c.Kubernetes.PullSecret.RobotDays == 0 {
+		c.Kubernetes.PullSecret.RobotDays = DefaultRobotDays
+	}
+	c.expandPaths()
+}
+
+// expandPaths 展开文件路径开头的 ~/，配置文件与环境变量中的路径都可以写成 ~/.kube/config 的形式
+func (c *Config) expandPaths() {
+	paths := []*string{&c.Kubernetes.Kubeconfig, &c.DockerConfig, &c.Vault, &c.Journal}
+	tls := []*TLS{&c.Destination.TLS}
+	for _, registry := range c.Registries {
+		tls = append(tls, &registry.TLS)
+	}
+	for _, t := range tls {
+		paths = append(paths, &t.CAFile, &t.CertFile, &t.KeyFile)
+	}
+	for _, target := range c.SSH {
+		paths = append(paths, &target.KeyFile)
+	}
+	for _, path := range paths {
+		*path = ExpandHome(*path)
+	}
+}
+
+// ExpandHome 把 ~ 或以 ~/ 开头的路径展开为当前用户的主目录，其他路径与无法确定主目录时原样返回
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// Validate 校验配置，错误信息中包含出错的字段
+func (c *Config) Validate() error {
+	if err := validateAPI("destination.api", c.Destination.API); err != nil {
+		return err
+	}
+	if c.Destination.Host == "" {
+		return fmt.Errorf("destination.host 不能为空")
+	}
+	if err := validateTLS("destination.tls", c.Destination.TLS); err != nil {
+		return err
+	}
+
+	hosts := make(map[string]bool)
+	for i, registry := range c.Registries {
+		field := fmt.Sprintf("registries[%d]", i)
+		if registry.Host == "" {
+			return fmt.Errorf("%s.host 不能为空", field)
+		}
+		host := normalizeHost(registry.Host)
+		if hosts[host] {
+			return fmt.Errorf("%s.host 与前面的条目重复: %s", field, registry.Host)
+		}
+		hosts[host] = true
+		if registry.API != "" {
+			if err := validateAPI(field+".api", registry.API); err != nil {
+				return err
+			}
+		}
+		if err := validateTLS(field+".tls", registry.TLS); err != nil {
+			return err
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, target := range c.SSH {
+		field := fmt.Sprintf("ssh[%d]", i)
+		if target.Name == "" {
+			return fmt.Errorf("%s.name 不能为空", field)
+		}
+		if names[target.Name] {
+			return fmt.Errorf("%s.name 重复: %s", field, target.Name)
+		}
+		names[target.Name] = true
+		if target.Host == "" {
+			return fmt.Errorf("%s.host 不能为空", field)
+		}
+		if target.Port <= 0 || target.Port > 65535 {
+			return fmt.Errorf("%s.port 无效: %d", field, target.Port)
+		}
+		if target.Username == "" {
+			return fmt.Errorf("%s.username 不能为空", field)
+		}
+		if target.Password == "" && target.KeyFile == "" {
+			return fmt.Errorf("%s 需要配置 password 或 keyFile", field)
+		}
+		if target.RemoteDir == "" {
+			return fmt.Errorf("%s.remoteDir 不能为空", field)
+		}
+	}
+
+	if err := ValidatePullSecretTarget(c.Kubernetes.PullSecret.Target); err != nil {
+		return fmt.Errorf("kubernetes.pullSecret.target %v", err)
+	}
+	if pullSecret := c.Kubernetes.PullSecret; pullSecret.Robot && pullSecret.Username != "" {
+		return fmt.Errorf("kubernetes.pullSecret.robot 与 username 不能同时配置")
+	}
+	if days := c.Kubernetes.PullSecret.RobotDays; days < -1 {
+		return fmt.Errorf("kubernetes.pullSecret.robotDays 无效: %d", days)
+	}
+	return nil
+}
+
+// ValidatePullSecretTarget 校验拉取凭据写入的位置
+func ValidatePullSecretTarget(target string) error {
+	if target != PullSecretPod && target != PullSecretServiceAccount {
+		return fmt.Errorf("必须是 %s 或 %s: %s", PullSecretPod, PullSecretServiceAccount, target)
+	}
+	return nil
+}
+
+func validateAPI(field, api string) error {
+	if api == "" {
+		return fmt.Errorf("%s 不能为空", field)
+	}
+	u, err := url.Parse(api)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s 必须是 http:// 或 https:// 开头的地址: %s", field, api)
+	}
+	return nil
+}
+
+func validateTLS(field string, t TLS) error {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("%s.certFile 与 keyFile 必须同时配置", field)
+	}
+	if _, err := t.Options().Config(); err != nil {
+		return fmt.Errorf("%s: %v", field, err)
+	}
+	return nil
+}
+
+// secretField 可以引用保险库的字段
+type secretField struct {
+	name  string
+	value *string
+}
+
+func (c *Config) secretFields() []secretField {
+	fields := []secretField{
+		{"destination.username", &c.Destination.Username},
+		{"destination.password", &c.Destination.Password},
+		{"kubernetes.pullSecret.username", &c.Kubernetes.PullSecret.Username},
+		{"kubernetes.pullSecret.password", &c.Kubernetes.PullSecret.Password},
+	}
+	for i, registry := range c.Registries {
+		fields = append(fields,
+			secretField{fmt.Sprintf("registries[%d].username", i), &registry.Username},
+			secretField{fmt.Sprintf("registries[%d].password", i), &registry.Password})
+	}
+	for i, target := range c.SSH {
+		fields = append(fields,
+			secretField{fmt.Sprintf("ssh[%d].username", i), &target.Username},
+			secretField{fmt.Sprintf("ssh[%d].password", i), &target.Password})
+	}
+	return fields
+}
+
+// HasSecretRefs 判断配置中是否有 vault:<名称> 形式的引用
+func (c *Config) HasSecretRefs() bool {
+	for _, field := range c.secretFields() {
+		if _, ok := vault.IsRef(*field.value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveSecrets 将 vault:<名称> 形式的引用替换为 get 返回的值
+func (c *Config) ResolveSecrets(get func(name string) (string, bool)) error {
+	for _, field := range c.secretFields() {
+		name, ok := vault.IsRef(*field.value)
+		if !ok {
+			continue
+		}
+		value, ok := get(name)
+		if !ok {
+			return fmt.Errorf("%s 引用的保险库条目 %s 不存在", field.name, name)
+		}
+		*field.value = value
+	}
+	return nil
+}
+
+// normalizeHost 去掉协议与末尾的 /
+func normalizeHost(host string) string {
+	if u, err := url.Parse(host); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return strings.TrimSuffix(host, "/")
+}
+
+func (c *Config) registry(host string) *Registry {
+	for _, registry := range c.Registries {
+		if normalizeHost(registry.Host) == host {
+			return registry
+		}
+	}
+	return nil
+}
+
+// Registry 返回源仓库的配置，未单独配置时返回 host 为 * 的条目，都没有时返回 nil
+func (c *Config) Registry(host string) *Registry {
+	if registry := c.registry(normalizeHost(host)); registry != nil {
+		return registry
+	}
+	return c.registry("*")
+}
+
+// SourceHarbor 生成源仓库配置，registry 为 parseImage 返回的带协议地址
+func (c *Config) SourceHarbor(registry, path, tag string) harbor.HarborConfig {
+	source := harbor.HarborConfig{
+		HarborApi:  registry,
+		HarborHost: registry,
+		ImagePath:  path,
+		ImageTag:   tag,
+	}
+	if r := c.Registry(registry); r != nil {
+		source.Username = r.Username
+		source.Password = r.Password
+		source.TLS = r.TLS.Options()
+		if r.API != "" && r.Host != "*" {
+			source.HarborApi = strings.TrimRight(r.API, "/")
+		}
+	}
+	return source
+}
+
+// DestHarbor 生成目标仓库配置
+func (c *Config) DestHarbor() harbor.HarborConfig {
+	return harbor.HarborConfig{
+		HarborApi:  strings.TrimRight(c.Destination.API, "/"),
+		HarborHost: c.Destination.Host,
+		Username:   c.Destination.Username,
+		Password:   c.Destination.Password,
+		TLS:        c.Destination.TLS.Options(),
+	}
+}
+
+// SSHConfig 返回名为 name 的 SSH 目标，name 为空时返回第一个
+func (c *Config) SSHConfig(name string) (*ssh.SSHConfig, error) {
+	if len(c.SSH) == 0 {
+		return nil, fmt.Errorf("配置中没有 SSH 目标")
+	}
+	target := c.SSH[0]
+	if name != "" {
+		target = nil
+		for _, t := range c.SSH {
+			if t.Name == name {
+				target = t
+				break
+			}
+		}
+		if target == nil {
+			return nil, fmt.Errorf("配置中没有名为 %s 的 SSH 目标", name)
+		}
+	}
+	return &ssh.SSHConfig{
+		Host:      target.Host,
+		Port:      target.Port,
+		Username:  target.Username,
+		Password:  target.Password,
+		KeyFile:   target.KeyFile,
+		RemoteDir: target.RemoteDir,
+	}, nil
+}
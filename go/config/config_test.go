@@ -0,0 +1,219 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadExample(t *testing.T) {
+	cfg, err := Load("../migrator.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := cfg.DestHarbor()
+	if dest.HarborApi != "https://10.100.100.21:10080" || dest.HarborHost != "dockerhub.cestc.local" || dest.Username != "admin" {
+		t.Fatalf("目标仓库配置不正确: %+v", dest)
+	}
+
+	source := cfg.SourceHarbor("https://image.cestc.cn", "/digital/app", "1")
+	if source.Username != "cmq" || source.HarborApi != "https://image.cestc.cn" {
+		t.Fatalf("源仓库配置不正确: %+v", source)
+	}
+	source = cfg.SourceHarbor("https://registry.internal:5000", "/app", "1")
+	if source.HarborApi != "http://registry.internal:5000" || source.Username != "" {
+		t.Fatalf("自定义接口地址不正确: %+v", source)
+	}
+	// 未单独配置的仓库使用 * 条目
+	if source := cfg.SourceHarbor("https://other.io", "/app", "1"); source.Username != "cmq" {
+		t.Fatalf("默认凭据不正确: %+v", source)
+	}
+
+	ssh, err := cfg.SSHConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ssh.Host != "10.100.100.21" || ssh.Port != 22 || ssh.RemoteDir != "/opt/baseline/tmp/" {
+		t.Fatalf("SSH 配置不正确: %+v", ssh)
+	}
+	if _, err := cfg.SSHConfig("missing"); err == nil {
+		t.Fatal("不存在的 SSH 目标应返回错误")
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	path := writeFile(t, "migrator.toml", `
+[destination]
+api = "https://harbor.local"
+username = "admin"
+password = "secret"
+
+[[registries]]
+host = "image.cestc.cn"
+username = "cmq"
+password = "secret"
+
+[[ssh]]
+host = "10.0.0.1"
+username = "root"
+keyFile = "/root/.ssh/id_rsa"
+remoteDir = "/tmp"
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Destination.Host != "harbor.local" {
+		t.Fatalf("destination.host 应默认取 api 的主机名: %s", cfg.Destination.Host)
+	}
+	if cfg.SSH[0].Name != "default" || cfg.SSH[0].Port != 22 || cfg.SSH[0].RemoteDir != "/tmp/" {
+		t.Fatalf("SSH 默认值不正确: %+v", cfg.SSH[0])
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	cfg := &Config{}
+	env := map[string]string{
+		"MIGRATOR_DEST_API":        "https://harbor.local",
+		"MIGRATOR_DEST_PASSWORD":   "from-env",
+		"MIGRATOR_SOURCE_USERNAME": "reader",
+		"MIGRATOR_SSH_HOST":        "10.0.0.2",
+		"MIGRATOR_SSH_PORT":        "2222",
+	}
+	err := cfg.ApplyEnv(func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Destination.API != "https://harbor.local" || cfg.Destination.Password != "from-env" {
+		t.Fatalf("目标仓库未被覆盖: %+v", cfg.Destination)
+	}
+	if r := cfg.Registry("https://any.io"); r == nil || r.Username != "reader" {
+		t.Fatalf("默认源仓库凭据未被覆盖: %+v", r)
+	}
+	if len(cfg.SSH) != 1 || cfg.SSH[0].Host != "10.0.0.2" || cfg.SSH[0].Port != 2222 {
+		t.Fatalf("SSH 目标未被覆盖: %+v", cfg.SSH)
+	}
+
+	env["MIGRATOR_SSH_PORT"] = "abc"
+	if err := cfg.ApplyEnv(func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}); err == nil {
+		t.Fatal("无效端口应返回错误")
+	}
+}
+
+func TestLoadExpandsHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("MIGRATOR_SSH_KEY_FILE", "~/.ssh/id_ed25519")
+	cfg, err := Load(writeFile(t, "migrator.yaml", `
+destination:
+  api: https://harbor.local
+ssh:
+  - host: 10.0.0.2
+    username: root
+    remoteDir: /tmp/
+kubernetes:
+  kubeconfig: ~/.kube/config
+dockerConfig: ~/.docker/config.json
+vault: ~/.migrator/vault.json
+journal: ~/.migrator/journal.jsonl
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct{ got, rel string }{
+		{cfg.Kubernetes.Kubeconfig, ".kube/config"},
+		{cfg.DockerConfig, ".docker/config.json"},
+		{cfg.Vault, ".migrator/vault.json"},
+		{cfg.Journal, ".migrator/journal.jsonl"},
+		{cfg.SSH[0].KeyFile, ".ssh/id_ed25519"},
+	} {
+		if want := filepath.Join(home, tt.rel); tt.got != want {
+			t.Errorf("%s 未展开为 %s", tt.got, want)
+		}
+	}
+
+	for path, want := range map[string]string{"~": home, "/etc/ca.crt": "/etc/ca.crt", "~other/x": "~other/x", "off": "off", "": ""} {
+		if got := ExpandHome(path); got != want {
+			t.Errorf("ExpandHome(%q) = %q，期望 %q", path, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"缺少目标", "registries: []\n", "destination.api 不能为空"},
+		{"地址无协议", "destination:\n  api: harbor.local\n", "destination.api 必须是"},
+		{"重复仓库", "destination:\n  api: https://h\nregistries:\n  - host: a.io\n  - host: https://a.io\n", "registries[1].host 与前面的条目重复"},
+		{"证书不完整", "destination:\n  api: https://h\n  tls:\n    certFile: a.crt\n", "destination.tls.certFile 与 keyFile 必须同时配置"},
+		{"CA 不存在", "destination:\n  api: https://h\n  tls:\n    caFile: /nonexistent/ca.crt\n", "读取 CA 证书失败"},
+		{"SSH 缺少凭据", "destination:\n  api: https://h\nssh:\n  - host: a\n    username: root\n    remoteDir: /tmp\n", "ssh[0] 需要配置 password 或 keyFile"},
+		{"拉取凭据位置无效", "destination:\n  api: https://h\nkubernetes:\n  pullSecret:\n    name: harbor-pull\n    target: node\n", "kubernetes.pullSecret.target 必须是 pod 或 serviceaccount"},
+		{"机器人账号与用户名冲突", "destination:\n  api: https://h\nkubernetes:\n  pullSecret:\n    name: harbor-pull\n    robot: true\n    username: puller\n", "kubernetes.pullSecret.robot 与 username 不能同时配置"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeFile(t, "migrator.yaml", tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("期望错误包含 %q，得到 %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	cfg, err := Load(writeFile(t, "migrator.yaml", `
+destination:
+  api: https://harbor.local
+  username: admin
+  password: vault:harbor-prod
+ssh:
+  - host: 10.0.0.1
+    username: root
+    password: vault:ssh-root
+    remoteDir: /tmp
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.HasSecretRefs() {
+		t.Fatal("应检测到保险库引用")
+	}
+
+	secrets := map[string]string{"harbor-prod": "Harbor12345"}
+	get := func(name string) (string, bool) {
+		value, ok := secrets[name]
+		return value, ok
+	}
+	if err := cfg.ResolveSecrets(get); err == nil || !strings.Contains(err.Error(), "ssh[0].password 引用的保险库条目 ssh-root 不存在") {
+		t.Fatalf("缺少条目时的错误不正确: %v", err)
+	}
+
+	secrets["ssh-root"] = "Cestc@2024"
+	if err := cfg.ResolveSecrets(get); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Destination.Password != "Harbor12345" || cfg.SSH[0].Password != "Cestc@2024" || cfg.HasSecretRefs() {
+		t.Fatalf("引用未被替换: %+v %+v", cfg.Destination, cfg.SSH[0])
+	}
+}
@@ -0,0 +1,202 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Credential 仓库的用户名与密码
+type Credential struct {
+	Username string
+	Password string
+}
+
+// DockerConfig ~/.docker/config.json 中与凭据相关的部分
+type DockerConfig struct {
+	Auths       map[string]AuthEntry `json:"auths"`
+	CredHelpers map[string]string    `json:"credHelpers"`
+	CredsStore  string               `json:"credsStore"`
+}
+
+// AuthEntry auths 中的一个条目，auth 为 base64(username:password)
+type AuthEntry struct {
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+// Resolver 按仓库主机名查找凭据：
+// 依次尝试 credHelpers 中为该主机配置的 docker-credential-* 程序、credsStore、auths，
+// 都没有时调用 Fallback（通常为配置文件中的条目）
+type Resolver struct {
+	Docker   *DockerConfig
+	Fallback func(host string) (Credential, bool)
+
+	// helper 调用凭据程序，测试中替换
+	helper func(name, host string) (Credential, bool, error)
+
+	mu    sync.Mutex
+	cache map[string]Credential
+}
+
+// DefaultDockerConfigPath 返回 $DOCKER_CONFIG/config.json 或 ~/.docker/config.json
+func DefaultDockerConfigPath() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker", "config.json")
+}
+
+// LoadDockerConfig 读取 docker 配置文件，文件不存在时返回空配置
+func LoadDockerConfig(path string) (*DockerConfig, error) {
+	config := &DockerConfig{}
+	if path == "" {
+		return config, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取 docker 配置文件失败: %v", err)
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("解析 docker 配置文件 %s 失败: %v", path, err)
+	}
+	return config, nil
+}
+
+// NewResolver 创建凭据解析器，docker 为 nil 时只使用 fallback
+func NewResolver(docker *DockerConfig, fallback func(host string) (Credential, bool)) *Resolver {
+	if docker == nil {
+		docker = &DockerConfig{}
+	}
+	return &Resolver{Docker: docker, Fallback: fallback, helper: runHelper, cache: make(map[string]Credential)}
+}
+
+// Resolve 返回仓库的凭据，host 可以带协议；没有找到时 ok 为 false
+func (r *Resolver) Resolve(host string) (Credential, bool, error) {
+	host = normalizeHost(host)
+
+	r.mu.Lock()
+	cred, cached := r.cache[host]
+	r.mu.Unlock()
+	if cached {
+		return cred, true, nil
+	}
+
+	cred, ok, err := r.resolve(host)
+	if err != nil || !ok {
+		return Credential{}, false, err
+	}
+	r.mu.Lock()
+	r.cache[host] = cred
+	r.mu.Unlock()
+	return cred, true, nil
+}
+
+func (r *Resolver) resolve(host string) (Credential, bool, error) {
+	helper := r.Docker.CredHelpers[host]
+	if helper == "" {
+		helper = r.Docker.CredsStore
+	}
+	if helper != "" {
+		cred, ok, err := r.helper(helper, host)
+		if err != nil {
+			return Credential{}, false, err
+		}
+		if ok {
+			return cred, true, nil
+		}
+	}
+
+	for key, entry := range r.Docker.Auths {
+		if normalizeHost(key) != host {
+			continue
+		}
+		cred, err := entry.credential()
+		if err != nil {
+			return Credential{}, false, fmt.Errorf("docker 配置中 %s 的凭据无效: %v", key, err)
+		}
+		if cred.Username != "" || cred.Password != "" {
+			return cred, true, nil
+		}
+	}
+
+	if r.Fallback != nil {
+		if cred, ok := r.Fallback(host); ok {
+			return cred, true, nil
+		}
+	}
+	return Credential{}, false, nil
+}
+
+// credential 解析 auths 条目
+func (e AuthEntry) credential() (Credential, error) {
+	if e.Auth != "" {
+		decoded, err := base64.StdEncoding.DecodeString(e.Auth)
+		if err != nil {
+			return Credential{}, fmt.Errorf("auth 字段不是有效的 base64: %v", err)
+		}
+		username, password, ok := strings.Cut(string(decoded), ":")
+		if !ok {
+			return Credential{}, fmt.Errorf("auth 字段格式应为 username:password")
+		}
+		return Credential{Username: username, Password: password}, nil
+	}
+	if e.IdentityToken != "" {
+		// 与 docker 的处理一致，identity token 作为密码使用
+		return Credential{Username: e.Username, Password: e.IdentityToken}, nil
+	}
+	return Credential{Username: e.Username, Password: e.Password}, nil
+}
+
+// runHelper 调用 docker-credential-<name> get，凭据不存在时 ok 为 false
+func runHelper(name, host string) (Credential, bool, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker-credential-"+name, "get")
+	cmd.Stdin = strings.NewReader(host)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		output := strings.TrimSpace(stdout.String() + stderr.String())
+		if strings.Contains(output, "credentials not found") {
+			return Credential{}, false, nil
+		}
+		return Credential{}, false, fmt.Errorf("调用 docker-credential-%s 失败: %v: %s", name, err, output)
+	}
+
+	var resp struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return Credential{}, false, fmt.Errorf("解析 docker-credential-%s 的输出失败: %v", name, err)
+	}
+	return Credential{Username: resp.Username, Password: resp.Secret}, true, nil
+}
+
+// normalizeHost 去掉协议与路径，docker.io 统一为 index.docker.io
+func normalizeHost(host string) string {
+	if u, err := url.Parse(host); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	host, _, _ = strings.Cut(host, "/")
+	if host == "docker.io" || host == "registry-1.docker.io" {
+		host = "index.docker.io"
+	}
+	return host
+}
@@ -0,0 +1,90 @@
+package credentials
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	auth := base64.StdEncoding.EncodeToString([]byte("alice:s3cret"))
+	err := os.WriteFile(path, []byte(`{
+  "auths": {
+    "https://image.cestc.cn": {"auth": "`+auth+`"},
+    "https://index.docker.io/v1/": {"username": "bob", "identitytoken": "tok"},
+    "broken.io": {"auth": "!!"}
+  },
+  "credHelpers": {"ecr.aws": "ecr-login"},
+  "credsStore": "desktop"
+}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docker, err := LoadDockerConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []string
+	r := NewResolver(docker, func(host string) (Credential, bool) {
+		if host == "fallback.io" {
+			return Credential{Username: "cfg", Password: "cfg"}, true
+		}
+		return Credential{}, false
+	})
+	r.helper = func(name, host string) (Credential, bool, error) {
+		calls = append(calls, name+"@"+host)
+		switch {
+		case name == "ecr-login":
+			return Credential{Username: "AWS", Password: "ecr"}, true, nil
+		case name == "desktop" && host == "store.io":
+			return Credential{Username: "store", Password: "store"}, true, nil
+		case name == "desktop" && host == "failing.io":
+			return Credential{}, false, fmt.Errorf("helper failed")
+		}
+		return Credential{}, false, nil
+	}
+
+	tests := []struct {
+		host string
+		want Credential
+		ok   bool
+	}{
+		{"ecr.aws", Credential{"AWS", "ecr"}, true},
+		{"https://store.io", Credential{"store", "store"}, true},
+		{"image.cestc.cn", Credential{"alice", "s3cret"}, true},
+		{"docker.io", Credential{"bob", "tok"}, true},
+		{"fallback.io", Credential{"cfg", "cfg"}, true},
+		{"unknown.io", Credential{}, false},
+	}
+	for _, tt := range tests {
+		got, ok, err := r.Resolve(tt.host)
+		if err != nil || ok != tt.ok || got != tt.want {
+			t.Errorf("%s: 得到 %+v, %v, %v", tt.host, got, ok, err)
+		}
+	}
+
+	if _, _, err := r.Resolve("broken.io"); err == nil {
+		t.Error("无效的 auth 应返回错误")
+	}
+	if _, _, err := r.Resolve("failing.io"); err == nil {
+		t.Error("凭据程序失败应返回错误")
+	}
+
+	// 已解析的凭据会被缓存
+	n := len(calls)
+	r.Resolve("ecr.aws")
+	if len(calls) != n {
+		t.Error("重复解析不应再次调用凭据程序")
+	}
+}
+
+func TestLoadDockerConfigMissing(t *testing.T) {
+	config, err := LoadDockerConfig(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || config == nil {
+		t.Fatalf("文件不存在时应返回空配置: %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"dockerImageMigrator/config"
+	"dockerImageMigrator/kube"
+	"dockerImageMigrator/log"
+	"dockerImageMigrator/ssh"
+	"dockerImageMigrator/workload"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// deployResult 单个文件的部署结果
+type deployResult struct {
+	File       string             `json:"file"`
+	Images     []imageResult      `json:"images"`
+	Secrets    []movedSecret      `json:"secrets,omitempty"`    // 从 env 移入生成的 Secret 的明文密钥
+	Diff       []*kube.ObjectDiff `json:"diff,omitempty"`       // apply 前与集群中现有对象的差异
+	Objects    []kube.Result      `json:"objects,omitempty"`    // 通过 Kubernetes API 部署时每个对象的结果
+	Rollouts   []*kube.Rollout    `json:"rollouts,omitempty"`   // apply 后工作负载的 rollout 与 Pod 状况
+	RolledBack []kube.Result      `json:"rolledBack,omitempty"` // 部署失败后恢复或删除的对象
+	RemotePath string             `json:"remotePath,omitempty"`
+	Command    string             `json:"command,omitempty"`
+	Output     string             `json:"output,omitempty"`
+	OK         bool               `json:"ok"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// defaultRolloutTimeout apply 后默认等待工作负载 rollout 完成的时间
+const defaultRolloutTimeout = 5 * time.Minute
+
+// deployOptions 部署选项，由配置与命令行参数得到，deploy、deploy -plan 与 interactive 各自创建
+type deployOptions struct {
+	migrate        bool              // 迁移镜像，false 时只改写镜像地址
+	assumeYes      bool              // 跳过 apply 前的 diff 确认
+	rollback       bool              // apply 或 rollout 失败时自动恢复 apply 前的对象
+	rolloutTimeout time.Duration     // apply 后等待 rollout 完成的总时间，0 表示不等待
+	extractSecrets bool              // 把 env 中以明文写出的疑似密钥移入生成的 Secret
+	forceConflicts bool              // server-side apply 时接管其他字段管理者设置的字段
+	pullSecret     config.PullSecret // 在目标命名空间中创建的拉取凭据，Name 为空时不创建
+
+	robots *pullRobots // 本次部署签发的机器人账号，多个文件共用，首次需要时创建
+}
+
+// newDeployOptions 按配置生成默认的部署选项
+func newDeployOptions() *deployOptions {
+	return &deployOptions{
+		migrate:        true,
+		rollback:       true,
+		rolloutTimeout: defaultRolloutTimeout,
+		pullSecret:     cfg.Kubernetes.PullSecret,
+	}
+}
+
+// deployCommand 迁移 yaml 文件中的镜像，改写后上传到远程主机并执行 kubectl apply，
+// 启用 Kubernetes API 部署时直接对集群 server-side apply
+func deployCommand(args []string) int {
+	opts := newDeployOptions()
+	fs := flag.NewFlagSet("deploy", flag.ContinueOnError)
+	noMigrate := fs.Bool("no-migrate", false, "只改写镜像地址，不迁移镜像")
+	plan := fs.Bool("plan", false, "只输出部署计划：需要迁移的镜像与传输量、yaml diff 及将执行的命令，不写入任何内容")
+	jsonOutput := fs.Bool("json", false, "以 JSON 格式输出报告")
+	useAPI := fs.Bool("api", false, "通过 Kubernetes API 部署，不经由 SSH")
+	kubeconfig := fs.String("kubeconfig", cfg.Kubernetes.Kubeconfig, "Kubernetes API 部署使用的 kubeconfig，指定时启用 API 部署")
+	kubeContext := fs.String("context", cfg.Kubernetes.Context, "kubeconfig 中的上下文，指定时启用 API 部署")
+	fs.BoolVar(&opts.assumeYes, "yes", false, "跳过 apply 前的 diff 确认，用于自动化")
+	fs.BoolVar(&opts.rollback, "rollback", opts.rollback, "apply 或 rollout 失败时自动恢复 apply 前的对象，-rollback=false 关闭")
+	fs.DurationVar(&opts.rolloutTimeout, "timeout", opts.rolloutTimeout, "apply 后等待 Deployment/StatefulSet/DaemonSet rollout 完成的总时间，所有工作负载共用，0 表示不等待")
+	fs.StringVar(&opts.pullSecret.Name, "pull-secret", opts.pullSecret.Name, "在目标命名空间中创建或更新该名称的拉取凭据 Secret，用于拉取目标 Harbor 中的镜像")
+	fs.StringVar(&opts.pullSecret.Target, "pull-secret-target", opts.pullSecret.Target, "拉取凭据写入的位置：pod（每个 pod spec 的 imagePullSecrets）或 serviceaccount（命名空间的 default ServiceAccount）")
+	fs.BoolVar(&opts.forceConflicts, "force-conflicts", false, "Kubernetes API 部署时强制接管由其他管理者（如 kubectl apply、控制器）设置的字段，默认遇到冲突时该对象部署失败")
+	fs.BoolVar(&opts.extractSecrets, "extract-secrets", false, "把容器 env 中以明文写出的疑似密钥（按变量名与熵判断）移入生成的 Secret，改为 secretKeyRef 引用")
+	fs.BoolVar(&opts.pullSecret.Robot, "pull-robot", opts.pullSecret.Robot, "拉取凭据使用为每个命名空间创建的只读 Harbor 机器人账号，每次部署确认后签发新账号，apply 成功后删除旧账号")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: migrator deploy [-plan] [-no-migrate] [-json] [-api] [-kubeconfig 文件] [-context 上下文] [-timeout 时长] [-force-conflicts] [-pull-secret 名称] [-extract-secrets] [-yes] <yaml文件|->...")
+		fmt.Fprintln(fs.Output(), "参数为 - 时从标准输入读取 yaml 内容；compose 文件总是通过 SSH 部署")
+		fmt.Fprintln(fs.Output(), "apply 前输出与集群中现有对象的差异并请求确认，diff 与提示输出到标准错误")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := config.ValidatePullSecretTarget(opts.pullSecret.Target); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ -pull-secret-target %v\n", err)
+		return exitUsage
+	}
+	opts.migrate = !*noMigrate
+	if err := setupKube(*useAPI, *kubeconfig, *kubeContext); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+	if *plan {
+		return deployPlanCommand(fs.Args(), *jsonOutput, opts)
+	}
+	startJournal("deploy", args)
+
+	var results []*deployResult
+	failed := 0
+	for _, path := range fs.Args() {
+		result := deploy(path, opts)
+		if !result.OK {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if *jsonOutput {
+		printJSON(results)
+	} else {
+		for _, result := range results {
+			printImageResults(os.Stdout, result.Images)
+			printMovedSecrets(os.Stdout, result.Secrets)
+			printObjectResults(os.Stdout, result.Objects)
+			printRollouts(os.Stdout, result.Rollouts)
+			printRolledBack(os.Stdout, result.RolledBack)
+			if result.OK {
+				fmt.Printf("👌 %s 部署结束\n", result.File)
+			} else {
+				fmt.Printf("❌ %s 部署失败: %s\n", result.File, result.Error)
+			}
+		}
+		fmt.Printf("\n共 %d 个文件，失败 %d\n", len(results), failed)
+	}
+
+	if failed > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// deploy 迁移并改写文件中的镜像，上传到远程主机后执行 kubectl apply（compose 文件执行 docker compose up），
+// 启用 Kubernetes API 部署时直接 apply 到集群；随后等待工作负载 rollout 完成，失败时自动回滚。
+// path 为 - 时从标准输入读取
+func deploy(path string, opts *deployOptions) *deployResult {
+	localFile := manifestName(path)
+	result := &deployResult{File: localFile}
+	log.Info(">>>>>> 开始部署", localFile)
+
+	file, err := readManifest(path)
+	if err != nil {
+		log.Errorf("%v", err)
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Images = rewriteImages(file, opts.migrate)
+	if opts.extractSecrets && !file.IsCompose() {
+		if result.Secrets, err = extractSecretEnv(file); err != nil {
+			log.Errorf("%v", err)
+			result.Error = err.Error()
+			return result
+		}
+	}
+	var pullSecrets []*pullSecretDoc
+	if opts.pullSecret.Name != "" && !file.IsCompose() {
+		if pullSecrets, err = addPullSecrets(file, opts.pullSecret, deployCredentials(opts.pullSecret)); err != nil {
+			log.Errorf("%v", err)
+			result.Error = err.Error()
+			return result
+		}
+	}
+
+	// 只替换镜像字段，保留原文件的注释与格式
+	yamlBytes, err := file.Bytes()
+	if err != nil {
+		log.Errorf("%v", err)
+		result.Error = err.Error()
+		return result
+	}
+
+	if file.IsCompose() {
+		err = sshDeploy(result, file, localFile, yamlBytes)
+	} else {
+		err = applyManifest(result, file, localFile, yamlBytes, pullSecrets, opts)
+	}
+	if err != nil {
+		log.Errorf("%v", err)
+		result.Error = err.Error()
+		return result
+	}
+
+	if n := countFailed(result.Images); n > 0 {
+		result.Error = fmt.Sprintf("%d 个镜像处理失败", n)
+		return result
+	}
+	result.OK = true
+	return result
+}
+
+// sshDeploy 上传文件到远程主机并执行部署命令，远程路径、命令与输出记录到 result
+func sshDeploy(result *deployResult, file *workload.File, localFile string, yamlBytes []byte) error {
+	command := deployCommandLine(file, localFile)
+	var err error
+	result.RemotePath, result.Output, err = remoteDeploy(localFile, string(yamlBytes), command)
+	if result.RemotePath != "" {
+		result.Command = command(result.RemotePath)
+	}
+	return err
+}
+
+// remoteDeploy 将改写后的文件上传到远程主机，command 不为 nil 时随后执行其返回的命令，
+// 返回远程文件路径与命令输出
+func remoteDeploy(localFile, content string, command func(remotePath string) string) (remotePath, output string, err error) {
+	// SSH相关操作
+	config, err := cfg.SSHConfig("")
+	if err != nil {
+		return "", "", err
+	}
+	// 创建SSH客户端
+	client, err := ssh.NewSSHClient(config)
+	if err != nil {
+		return "", "", fmt.Errorf("创建SSH客户端失败: %v", err)
+	}
+	// 连接到远程服务器
+	if err := client.Connect(); err != nil {
+		return "", "", fmt.Errorf("连接到远程服务器失败: %v", err)
+	}
+	defer client.Close()
+
+	fileName := filepath.Base(localFile)
+	remotePath = remoteFilePath(config.RemoteDir, localFile, time.Now())
+
+	log.Infof("正在传输文件: %s\n", fileName)
+	if err := client.WriteStringToFile(content, remotePath); err != nil {
+		return "", "", fmt.Errorf("文件传输失败 %s: %v", fileName, err)
+	}
+	log.Infof("成功传输文件 %s 到 %s\n", fileName, remotePath)
+
+	if command == nil {
+		return remotePath, "", nil
+	}
+	output, err = client.ExecuteCommand(command(remotePath))
+	if err != nil {
+		return remotePath, output, fmt.Errorf("执行命令失败: %v", err)
+	}
+	log.Infof("命令输出:\n%s\n", output)
+	return remotePath, output, nil
+}
+
+// remoteFilePath 生成上传到远程主机的文件路径，在文件名和后缀之间加上时间戳，避免覆盖之前上传的文件
+func remoteFilePath(remoteDir, localFile string, now time.Time) string {
+	// 1. 获取文件名（带后缀）
+	fileName := filepath.Base(localFile) // "backend-portal-front.yaml"
+	// 2. 分离文件名和后缀
+	name := strings.TrimSuffix(fileName, filepath.Ext(fileName)) // "backend-portal-front"
+	ext := filepath.Ext(fileName)                                // ".yaml"
+
+	// 3. 在文件名和后缀之间添加内容
+	return fmt.Sprintf("%s%s_%s%s", remoteDir, name, now.Format("20060102150405"), ext)
+}
+
+// deployCommandLine 返回部署文件时在远程主机上执行的命令
+func deployCommandLine(file *workload.File, localFile string) func(remotePath string) string {
+	if file.IsCompose() {
+		return func(remotePath string) string { return composeUpCommand(localFile, remotePath) }
+	}
+	return func(remotePath string) string { return "kubectl apply -f " + shellQuote(remotePath) }
+}
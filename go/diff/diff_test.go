@@ -0,0 +1,41 @@
+package diff
+
+import "testing"
+
+func TestUnified(t *testing.T) {
+	a := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+	b := "a\nb\nc\nD\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	want := `--- old.yaml
++++ new.yaml
+@@ -1,7 +1,7 @@
+ a
+ b
+ c
+-d
++D
+ e
+ f
+ g
+@@ -9,3 +9,4 @@
+ i
+ j
+ k
++l
+`
+	if got := Unified("old.yaml", "new.yaml", []byte(a), []byte(b)); got != want {
+		t.Fatalf("diff 不正确:\n%s", got)
+	}
+}
+
+func TestUnifiedEqual(t *testing.T) {
+	if got := Unified("a", "b", []byte("x\n"), []byte("x\n")); got != "" {
+		t.Fatalf("内容相同时应返回空字符串: %q", got)
+	}
+}
+
+func TestUnifiedNoTrailingNewline(t *testing.T) {
+	want := "--- a\n+++ b\n@@ -1 +1 @@\n-x\n\\ No newline at end of file\n+y\n\\ No newline at end of file\n"
+	if got := Unified("a", "b", []byte("x"), []byte("y")); got != want {
+		t.Fatalf("diff 不正确:\n%q", got)
+	}
+}
@@ -0,0 +1,235 @@
+package harbor_test
+
+import (
+	"bytes"
+	"dockerImageMigrator/harbor"
+	"dockerImageMigrator/server"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 认证模式
+const (
+	authNone   = ""
+	authBasic  = "basic"
+	authBearer = "bearer"
+)
+
+// fault 注入到匹配请求上的故障
+type fault struct {
+	method   string
+	contains string // 请求路径包含该子串时命中
+	status   int    // 直接返回的状态码，如 500、429
+	truncate bool   // 只返回一半响应体
+	corrupt  bool   // 篡改响应体内容，使 digest 校验失败
+	times    int    // 命中次数，0 表示一直生效
+}
+
+// fakeRegistry 进程内的假仓库，复用 server 包的 OCI Distribution 实现，
+// 在外层增加 Basic/Bearer 认证、请求记录和故障注入
+type fakeRegistry struct {
+	*httptest.Server
+	Store *harbor.MemoryRegistry
+
+	auth     string
+	username string
+	password string
+
+	mu       sync.Mutex
+	faults   []*fault
+	requests []string
+}
+
+func newFakeRegistry(t *testing.T, auth string) *fakeRegistry {
+	t.Helper()
+	store := harbor.NewMemoryRegistry()
+	backend, err := server.NewServer(store, t.TempDir())
+	if err != nil {
+		t.Fatalf("创建假仓库失败: %v", err)
+	}
+
+	f := &fakeRegistry{Store: store, auth: auth, username: "admin", password: "Harbor12345"}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			f.serveToken(w, r)
+			return
+		}
+		f.record(r)
+		if !f.authorized(w, r) {
+			return
+		}
+		f.serveWithFaults(w, r, backend)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// inject 注册一个故障
+func (f *fakeRegistry) inject(flt fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = append(f.faults, &flt)
+}
+
+// count 统计方法与路径匹配的请求数
+func (f *fakeRegistry) count(method, contains string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, req := range f.requests {
+		if strings.HasPrefix(req, method+" ") && strings.Contains(req, contains) {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fakeRegistry) record(r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+}
+
+// matchFault 找到命中的故障并扣减剩余次数
+func (f *fakeRegistry) matchFault(r *http.Request) *fault {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, flt := range f.faults {
+		if flt.method != "" && flt.method != r.Method {
+			continue
+		}
+		if !strings.Contains(r.URL.Path, flt.contains) {
+			continue
+		}
+		if flt.times > 0 {
+			flt.times--
+			if flt.times == 0 {
+				f.faults = append(f.faults[:i], f.faults[i+1:]...)
+			}
+		}
+		return flt
+	}
+	return nil
+}
+
+func (f *fakeRegistry) authorized(w http.ResponseWriter, r *http.Request) bool {
+	switch f.auth {
+	case authBasic:
+		if username, password, ok := r.BasicAuth(); ok && username == f.username && password == f.password {
+			return true
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="fake"`)
+	case authBearer:
+		if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer token-") {
+			return true
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake"`, f.URL))
+	default:
+		return true
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+	return false
+}
+
+// serveToken 模拟 token 服务，用 Basic 凭据换取 bearer token
+func (f *fakeRegistry) serveToken(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	if !ok || username != f.username || password != f.password {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"token": "token-" + r.URL.Query().Get("scope")})
+}
+
+func (f *fakeRegistry) serveWithFaults(w http.ResponseWriter, r *http.Request, backend http.Handler) {
+	flt := f.matchFault(r)
+	if flt == nil {
+		backend.ServeHTTP(w, r)
+		return
+	}
+	if flt.status != 0 {
+		w.WriteHeader(flt.status)
+		return
+	}
+
+	rec := httptest.NewRecorder()
+	backend.ServeHTTP(rec, r)
+	body := rec.Body.Bytes()
+	for key, values := range rec.Header() {
+		w.Header()[key] = values
+	}
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	w.WriteHeader(rec.Code)
+
+	switch {
+	case flt.truncate:
+		// 声明的长度大于实际写出的内容，客户端会读到 unexpected EOF
+		w.Write(body[:len(body)/2])
+	case flt.corrupt && len(body) > 0:
+		corrupted := append([]byte(nil), body...)
+		corrupted[0] ^= 0xff
+		w.Write(corrupted)
+	default:
+		w.Write(body)
+	}
+}
+
+// testImage 测试用镜像的内容
+type testImage struct {
+	manifest []byte
+	config   []byte
+	layers   [][]byte
+}
+
+// newTestImage 构造一个 Docker v2 镜像，layers 为各层内容
+func newTestImage(t *testing.T, layers ...string) *testImage {
+	t.Helper()
+	img := &testImage{config: []byte(fmt.Sprintf(`{"architecture":"amd64","layers":%d}`, len(layers)))}
+	manifest := harbor.Manifest{
+		MediaType:     harbor.MediaTypeDockerManifest,
+		SchemaVersion: 2,
+		Config: harbor.Descriptor{
+			MediaType: "application/vnd.docker.container.image.v1+json",
+			Size:      int64(len(img.config)),
+			Digest:    harbor.Digest(img.config),
+		},
+	}
+	for _, layer := range layers {
+		data := []byte(layer)
+		img.layers = append(img.layers, data)
+		manifest.Layers = append(manifest.Layers, harbor.Descriptor{
+			MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip",
+			Size:      int64(len(data)),
+			Digest:    harbor.Digest(data),
+		})
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("序列化 manifest 失败: %v", err)
+	}
+	img.manifest = data
+	return img
+}
+
+// push 将镜像直接写入仓库存储
+func (img *testImage) push(t *testing.T, reg harbor.Registry, repo, tag string) {
+	t.Helper()
+	for _, blob := range append([][]byte{img.config}, img.layers...) {
+		if err := reg.PutBlob(repo, harbor.Digest(blob), int64(len(blob)), bytes.NewReader(blob)); err != nil {
+			t.Fatalf("写入 blob 失败: %v", err)
+		}
+	}
+	if err := reg.PutManifest(repo, tag, harbor.MediaTypeDockerManifest, img.manifest); err != nil {
+		t.Fatalf("写入 manifest 失败: %v", err)
+	}
+}
+
+// digest 返回 manifest 的 digest
+func (img *testImage) digest() string {
+	return harbor.Digest(img.manifest)
+}
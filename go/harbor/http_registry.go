@@ -0,0 +1,513 @@
+package harbor
+
+import (
+	"bytes"
+	"dockerImageMigrator/log"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// manifestAccept 获取 manifest 时声明支持的媒体类型
+var manifestAccept = strings.Join([]string{
+	MediaTypeDockerManifest,
+	MediaTypeDockerManifestList,
+	MediaTypeOCIManifest,
+	MediaTypeOCIIndex,
+}, ", ")
+
+// HTTPRegistry 通过 Docker Registry v2 API 访问的远程仓库（Harbor、Docker Hub 等）
+type HTTPRegistry struct {
+	BaseURL  string
+	Username string
+	Password string
+
+	client *http.Client
+	mu     sync.Mutex
+	tokens map[string]string // scope -> bearer token
+}
+
+// NewHTTPRegistry 创建远程仓库客户端，baseURL 形如 https://harbor.example.com
+func NewHTTPRegistry(baseURL, username, password string) *HTTPRegistry {
+	return &HTTPRegistry{
+		BaseURL:  strings.TrimRight(baseURL, "/"),
+		Username: username,
+		Password: password,
+		client:   createHTTPClient(TLSOptions{}),
+		tokens:   make(map[string]string),
+	}
+}
+
+// NewHTTPRegistryFromConfig 使用 HarborConfig 中的地址、凭据与 TLS 设置创建远程仓库客户端
+func NewHTTPRegistryFromConfig(config HarborConfig) *HTTPRegistry {
+	r := NewHTTPRegistry(config.HarborApi, config.Username, config.Password)
+	r.client = createHTTPClient(config.TLS)
+	return r
+}
+
+func (r *HTTPRegistry) url(repo, format string, args ...interface{}) string {
+	return fmt.Sprintf("%s/v2/%s/%s", r.BaseURL, repoName(repo), fmt.Sprintf(format, args...))
+}
+
+// do 发送请求并处理认证：默认使用 Basic 认证，遇到 Bearer 质询时换取 token 后重试
+func (r *HTTPRegistry) do(req *http.Request, repo string, push bool) (*http.Response, error) {
+	scope := fmt.Sprintf("repository:%s:pull", repoName(repo))
+	if push {
+		scope += ",push"
+	}
+	r.authorize(req, scope)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	token, err := r.fetchToken(challenge, scope)
+	if err != nil {
+		return nil, fmt.Errorf("获取 bearer token 失败: %v", err)
+	}
+	r.mu.Lock()
+	r.tokens[scope] = token
+	r.mu.Unlock()
+
+	// 流式请求体无法重放，此时只能依赖之前缓存的 token
+	if req.Body != nil && req.GetBody == nil {
+		return nil, fmt.Errorf("请求需要 bearer 认证且请求体无法重放")
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	r.authorize(retry, scope)
+	return r.client.Do(retry)
+}
+
+// authorize 为请求设置认证头，优先使用已缓存的 bearer token
+func (r *HTTPRegistry) authorize(req *http.Request, scope string) {
+	r.mu.Lock()
+	token, ok := r.tokens[scope]
+	r.mu.Unlock()
+	if ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return
+	}
+	if r.Username != "" || r.Password != "" {
+		req.Header.Set("Authorization", "Basic "+basicAuth(r.Username, r.Password))
+	}
+}
+
+// fetchToken 根据 WWW-Authenticate 质询向 token 服务换取 bearer token
+func (r *HTTPRegistry) fetchToken(challenge, scope string) (string, error) {
+	params := parseChallenge(challenge[len("bearer "):])
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("质询缺少 realm: %s", challenge)
+	}
+	if params["scope"] != "" {
+		scope = params["scope"]
+	}
+
+	tokenURL, err := url.Parse(realm)
+	if err != nil {
+		return "", fmt.Errorf("解析 realm 失败: %v", err)
+	}
+	query := tokenURL.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", scope)
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest("GET", tokenURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if r.Username != "" || r.Password != "" {
+		req.SetBasicAuth(r.Username, r.Password)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token 服务返回状态码 %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("解析 token 响应失败: %v", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+	return "", fmt.Errorf("token 响应为空")
+}
+
+// parseChallenge 解析 key="value" 形式的质询参数
+func parseChallenge(s string) map[string]string {
+	params := make(map[string]string)
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ,")
+		eq := strings.Index(s, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = s[eq+1:]
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.Index(s[1:], `"`)
+			if end < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+		} else {
+			end := strings.Index(s, ",")
+			if end < 0 {
+				value, s = s, ""
+			} else {
+				value, s = s[:end], s[end:]
+			}
+		}
+		params[key] = value
+	}
+	return params
+}
+
+// GetManifest 获取 manifest 原始内容
+func (r *HTTPRegistry) GetManifest(repo, reference string) ([]byte, string, error) {
+	manifestURL := r.url(repo, "manifests/%s", reference)
+	req, err := http.NewRequest("GET", manifestURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("创建获取 manifest 请求失败: %v", err)
+	}
+	req.Header.Set("Accept", manifestAccept)
+
+	resp, err := r.do(req, repo, false)
+	if err != nil {
+		return nil, "", fmt.Errorf("发送获取 manifest 请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, "", fmt.Errorf("获取 manifest 失败: 状态码 %d - %s", resp.StatusCode, string(body))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("读取 manifest 失败: %v", err)
+	}
+	mediaType := resp.Header.Get("Content-Type")
+	if i := strings.Index(mediaType, ";"); i >= 0 {
+		mediaType = mediaType[:i]
+	}
+	if mediaType == "" || mediaType == "application/json" || mediaType == "text/plain" {
+		mediaType = DetectMediaType(data)
+	}
+	return data, mediaType, nil
+}
+
+// ManifestExists 通过 HEAD 请求检查 manifest 是否存在
+func (r *HTTPRegistry) ManifestExists(repo, reference string) (bool, error) {
+	req, err := http.NewRequest("HEAD", r.url(repo, "manifests/%s", reference), nil)
+	if err != nil {
+		return false, fmt.Errorf("创建检查镜像请求失败: %v", err)
+	}
+	req.Header.Set("Accept", manifestAccept)
+
+	resp, err := r.do(req, repo, false)
+	if err != nil {
+		return false, fmt.Errorf("发送检查镜像请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("检查镜像失败: 状态码 %d", resp.StatusCode)
+	}
+}
+
+// PutManifest 注册 manifest
+func (r *HTTPRegistry) PutManifest(repo, reference, mediaType string, data []byte) error {
+	manifestURL := r.url(repo, "manifests/%s", reference)
+	req, err := http.NewRequest("PUT", manifestURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("创建 manifest 注册请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", mediaType)
+
+	log.Infof("[INFO] 注册 manifest: %s", manifestURL)
+	resp, err := r.do(req, repo, true)
+	if err != nil {
+		return fmt.Errorf("发送 manifest 注册请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
+		log.Info("[INFO] Manifest 注册成功")
+		return nil
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("Manifest 注册失败: 状态码 %d - %s", resp.StatusCode, string(body))
+}
+
+// BlobExists 检查 blob 是否已存在
+func (r *HTTPRegistry) BlobExists(repo, digest string) (bool, error) {
+	req, err := http.NewRequest("HEAD", r.url(repo, "blobs/%s", digest), nil)
+	if err != nil {
+		return false, fmt.Errorf("创建 HEAD 请求失败: %v", err)
+	}
+
+	resp, err := r.do(req, repo, false)
+	if err != nil {
+		return false, fmt.Errorf("发送 HEAD 请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("HEAD 请求返回状态码 %d", resp.StatusCode)
+	}
+}
+
+// StatBlob 通过 HEAD 请求获取 blob 大小
+func (r *HTTPRegistry) StatBlob(repo, digest string) (int64, error) {
+	req, err := http.NewRequest("HEAD", r.url(repo, "blobs/%s", digest), nil)
+	if err != nil {
+		return 0, fmt.Errorf("创建 HEAD 请求失败: %v", err)
+	}
+
+	resp, err := r.do(req, repo, false)
+	if err != nil {
+		return 0, fmt.Errorf("发送 HEAD 请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.ContentLength, nil
+	case http.StatusNotFound:
+		return 0, ErrNotFound
+	default:
+		return 0, fmt.Errorf("HEAD 请求返回状态码 %d", resp.StatusCode)
+	}
+}
+
+// GetBlob 以流的方式下载 blob
+func (r *HTTPRegistry) GetBlob(repo, digest string) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", r.url(repo, "blobs/%s", digest), nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建 GET 请求失败: %v", err)
+	}
+
+	resp, err := r.do(req, repo, false)
+	if err != nil {
+		return nil, fmt.Errorf("发送 GET 请求失败: %v", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("下载 blob 失败: 状态码 %d - %s", resp.StatusCode, resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+// PutBlob 创建上传会话后以单次 PUT 流式上传 blob
+func (r *HTTPRegistry) PutBlob(repo, digest string, size int64, reader io.Reader) error {
+	location, err := r.startUpload(repo)
+	if err != nil {
+		return err
+	}
+
+	uploadURL, err := r.resolveLocation(location)
+	if err != nil {
+		return err
+	}
+	query := uploadURL.Query()
+	query.Set("digest", digest)
+	uploadURL.RawQuery = query.Encode()
+
+	putReq, err := http.NewRequest("PUT", uploadURL.String(), reader)
+	if err != nil {
+		return fmt.Errorf("创建 PUT 请求失败: %v", err)
+	}
+	putReq.Header.Set("Content-Type", "application/octet-stream")
+	if size >= 0 {
+		putReq.ContentLength = size
+	}
+
+	putResp, err := r.do(putReq, repo, true)
+	if err != nil {
+		return fmt.Errorf("发送 PUT 请求失败: %v", err)
+	}
+	defer putResp.Body.Close()
+
+	if putResp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(putResp.Body)
+		return fmt.Errorf("上传失败: 状态码 %d - %s", putResp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// MountBlob 尝试从 fromRepo 跨仓库挂载 blob
+func (r *HTTPRegistry) MountBlob(repo, fromRepo, digest string) (bool, error) {
+	query := url.Values{}
+	query.Set("mount", digest)
+	query.Set("from", repoName(fromRepo))
+
+	req, err := http.NewRequest("POST", r.url(repo, "blobs/uploads/?%s", query.Encode()), nil)
+	if err != nil {
+		return false, fmt.Errorf("创建挂载请求失败: %v", err)
+	}
+	resp, err := r.do(req, repo, true)
+	if err != nil {
+		return false, fmt.Errorf("发送挂载请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return true, nil
+	case http.StatusAccepted:
+		// 仓库不支持挂载时会开启普通上传会话，这里直接放弃该会话
+		if location := resp.Header.Get("Location"); location != "" {
+			if cancelURL, err := r.resolveLocation(location); err == nil {
+				if cancel, err := http.NewRequest("DELETE", cancelURL.String(), nil); err == nil {
+					if cancelResp, err := r.do(cancel, repo, true); err == nil {
+						cancelResp.Body.Close()
+					}
+				}
+			}
+		}
+		return false, nil
+	default:
+		return false, fmt.Errorf("挂载 blob 失败: 状态码 %d", resp.StatusCode)
+	}
+}
+
+// ListTags 列出仓库下的所有 tag，自动处理分页
+func (r *HTTPRegistry) ListTags(repo string) ([]string, error) {
+	var tags []string
+	next := r.url(repo, "tags/list")
+	for next != "" {
+		req, err := http.NewRequest("GET", next, nil)
+		if err != nil {
+			return nil, fmt.Errorf("创建获取 tag 列表请求失败: %v", err)
+		}
+		resp, err := r.do(req, repo, false)
+		if err != nil {
+			return nil, fmt.Errorf("发送获取 tag 列表请求失败: %v", err)
+		}
+
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			return nil, ErrNotFound
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("获取 tag 列表失败: 状态码 %d", resp.StatusCode)
+		}
+
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("解析 tag 列表失败: %v", err)
+		}
+		tags = append(tags, page.Tags...)
+
+		next = ""
+		if link := resp.Header.Get("Link"); link != "" {
+			start, end := strings.Index(link, "<"), strings.Index(link, ">")
+			if start >= 0 && end > start && strings.Contains(link, `rel="next"`) {
+				nextURL, err := r.resolveLocation(link[start+1 : end])
+				if err != nil {
+					return nil, err
+				}
+				next = nextURL.String()
+			}
+		}
+	}
+	return tags, nil
+}
+
+// startUpload 创建上传会话，返回 Location 头
+func (r *HTTPRegistry) startUpload(repo string) (string, error) {
+	req, err := http.NewRequest("POST", r.url(repo, "blobs/uploads/"), nil)
+	if err != nil {
+		return "", fmt.Errorf("创建上传会话请求失败: %v", err)
+	}
+
+	resp, err := r.do(req, repo, true)
+	if err != nil {
+		return "", fmt.Errorf("发送上传会话请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return "", fmt.Errorf("创建上传会话失败: 状态码 %d - %s", resp.StatusCode, resp.Status)
+	}
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return "", fmt.Errorf("上传会话响应缺少 Location 头")
+	}
+	return location, nil
+}
+
+// resolveLocation 将可能为相对路径的 Location 解析为绝对地址
+func (r *HTTPRegistry) resolveLocation(location string) (*url.URL, error) {
+	base, err := url.Parse(r.BaseURL + "/")
+	if err != nil {
+		return nil, fmt.Errorf("解析仓库地址失败: %v", err)
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("解析 Location 失败: %v", err)
+	}
+	return base.ResolveReference(ref), nil
+}
@@ -0,0 +1,168 @@
+package harbor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// memoryManifest 内存中保存的 manifest
+type memoryManifest struct {
+	data      []byte
+	mediaType string
+}
+
+// MemoryRegistry 完全保存在内存中的仓库，适合测试或临时中转
+type MemoryRegistry struct {
+	mu        sync.RWMutex
+	blobs     map[string][]byte
+	manifests map[string]memoryManifest    // digest -> manifest
+	tags      map[string]map[string]string // repo -> tag -> digest
+}
+
+// NewMemoryRegistry 创建空的内存仓库
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string]memoryManifest),
+		tags:      make(map[string]map[string]string),
+	}
+}
+
+// resolve 将 tag 解析为 digest，调用方需持有读锁
+func (m *MemoryRegistry) resolve(repo, reference string) (string, bool) {
+	if isDigest(reference) {
+		_, ok := m.manifests[reference]
+		return reference, ok
+	}
+	digest, ok := m.tags[repoName(repo)][reference]
+	return digest, ok
+}
+
+// GetManifest 读取 manifest
+func (m *MemoryRegistry) GetManifest(repo, reference string) ([]byte, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	digest, ok := m.resolve(repo, reference)
+	if !ok {
+		return nil, "", ErrNotFound
+	}
+	manifest := m.manifests[digest]
+	return append([]byte(nil), manifest.data...), manifest.mediaType, nil
+}
+
+// ManifestExists 检查 manifest 是否存在
+func (m *MemoryRegistry) ManifestExists(repo, reference string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.resolve(repo, reference)
+	return ok, nil
+}
+
+// PutManifest 保存 manifest
+func (m *MemoryRegistry) PutManifest(repo, reference, mediaType string, data []byte) error {
+	digest := Digest(data)
+	if isDigest(reference) && reference != digest {
+		return fmt.Errorf("manifest digest 不匹配: 期望 %s，实际 %s", reference, digest)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.manifests[digest] = memoryManifest{data: append([]byte(nil), data...), mediaType: mediaType}
+	if !isDigest(reference) {
+		name := repoName(repo)
+		if m.tags[name] == nil {
+			m.tags[name] = make(map[string]string)
+		}
+		m.tags[name][reference] = digest
+	}
+	return nil
+}
+
+// BlobExists 检查 blob 是否存在
+func (m *MemoryRegistry) BlobExists(_, digest string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.blobs[digest]
+	return ok, nil
+}
+
+// StatBlob 返回 blob 大小
+func (m *MemoryRegistry) StatBlob(_, digest string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data, ok := m.blobs[digest]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return int64(len(data)), nil
+}
+
+// GetBlob 读取 blob
+func (m *MemoryRegistry) GetBlob(_, digest string) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data, ok := m.blobs[digest]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// PutBlob 写入 blob 并校验 digest 与大小
+func (m *MemoryRegistry) PutBlob(_, digest string, size int64, reader io.Reader) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("读取 blob 失败: %v", err)
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return fmt.Errorf("blob 大小不匹配: 期望 %d，实际 %d", size, len(data))
+	}
+	if actual := Digest(data); actual != digest {
+		return fmt.Errorf("blob digest 不匹配: 期望 %s，实际 %s", digest, actual)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blobs[digest] = data
+	return nil
+}
+
+// MountBlob 所有仓库共享 blob，存在即视为挂载成功
+func (m *MemoryRegistry) MountBlob(repo, _, digest string) (bool, error) {
+	return m.BlobExists(repo, digest)
+}
+
+// ListTags 列出仓库下的 tag
+func (m *MemoryRegistry) ListTags(repo string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tags, ok := m.tags[repoName(repo)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result := make([]string, 0, len(tags))
+	for tag := range tags {
+		result = append(result, tag)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// Repositories 列出所有带 tag 的仓库
+func (m *MemoryRegistry) Repositories() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	repos := make([]string, 0, len(m.tags))
+	for repo := range m.tags {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	return repos, nil
+}
@@ -0,0 +1,227 @@
+package harbor_test
+
+import (
+	"bytes"
+	"dockerImageMigrator/harbor"
+	"dockerImageMigrator/log"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	log.Init()
+	os.Exit(m.Run())
+}
+
+// config 生成指向假仓库的 HarborConfig
+func (f *fakeRegistry) config(path, tag string) harbor.HarborConfig {
+	return harbor.HarborConfig{
+		HarborApi:  f.URL,
+		HarborHost: f.Listener.Addr().String(),
+		Username:   f.username,
+		Password:   f.password,
+		ImagePath:  path,
+		ImageTag:   tag,
+	}
+}
+
+func TestCheckImageExists(t *testing.T) {
+	for _, auth := range []string{authNone, authBasic, authBearer} {
+		t.Run("auth="+auth, func(t *testing.T) {
+			reg := newFakeRegistry(t, auth)
+			newTestImage(t, "layer-a").push(t, reg.Store, "digital/dev/app", "v1")
+
+			exists, err := harbor.CheckImageExists(reg.URL, "/digital/dev/app", "v1", reg.username, reg.password)
+			if err != nil || !exists {
+				t.Fatalf("期望镜像存在，得到 exists=%v err=%v", exists, err)
+			}
+
+			exists, err = harbor.CheckImageExists(reg.URL, "/digital/dev/app", "v2", reg.username, reg.password)
+			if err != nil || exists {
+				t.Fatalf("期望镜像不存在，得到 exists=%v err=%v", exists, err)
+			}
+		})
+	}
+}
+
+func TestCheckImageExistsErrors(t *testing.T) {
+	reg := newFakeRegistry(t, authBasic)
+	newTestImage(t, "layer-a").push(t, reg.Store, "digital/dev/app", "v1")
+
+	if _, err := harbor.CheckImageExists(reg.URL, "/digital/dev/app", "v1", reg.username, "wrong"); err == nil {
+		t.Fatal("密码错误时期望返回错误")
+	}
+
+	reg.inject(fault{method: http.MethodHead, contains: "/manifests/", status: http.StatusTooManyRequests, times: 1})
+	if _, err := harbor.CheckImageExists(reg.URL, "/digital/dev/app", "v1", reg.username, reg.password); err == nil {
+		t.Fatal("429 时期望返回错误")
+	}
+}
+
+func TestMigrateImage(t *testing.T) {
+	for _, auth := range []string{authBasic, authBearer} {
+		t.Run("auth="+auth, func(t *testing.T) {
+			src := newFakeRegistry(t, auth)
+			dst := newFakeRegistry(t, auth)
+			img := newTestImage(t, "layer-a", "layer-b", "layer-c")
+			img.push(t, src.Store, "digital/dev/app", "v1")
+
+			err := harbor.MigrateImage(src.config("/digital/dev/app", "v1"), dst.config("/digital/dev/app", "v1"))
+			if err != nil {
+				t.Fatalf("迁移失败: %v", err)
+			}
+
+			data, _, err := dst.Store.GetManifest("digital/dev/app", "v1")
+			if err != nil {
+				t.Fatalf("目标仓库缺少 manifest: %v", err)
+			}
+			if harbor.Digest(data) != img.digest() {
+				t.Fatalf("manifest digest 不一致: %s != %s", harbor.Digest(data), img.digest())
+			}
+			for _, blob := range append([][]byte{img.config}, img.layers...) {
+				if ok, _ := dst.Store.BlobExists("digital/dev/app", harbor.Digest(blob)); !ok {
+					t.Fatalf("目标仓库缺少 blob %s", harbor.Digest(blob))
+				}
+			}
+		})
+	}
+}
+
+func TestMigrateImageSkipsExistingBlobs(t *testing.T) {
+	src := newFakeRegistry(t, authBasic)
+	dst := newFakeRegistry(t, authBasic)
+	img := newTestImage(t, "layer-a", "layer-b")
+	img.push(t, src.Store, "digital/dev/app", "v1")
+	img.push(t, dst.Store, "digital/dev/app", "old")
+
+	if err := harbor.MigrateImage(src.config("/digital/dev/app", "v1"), dst.config("/digital/dev/app", "v1")); err != nil {
+		t.Fatalf("迁移失败: %v", err)
+	}
+
+	if n := dst.count(http.MethodPost, "/blobs/uploads"); n != 0 {
+		t.Fatalf("blob 已存在时不应上传，实际创建了 %d 个上传会话", n)
+	}
+	if n := src.count(http.MethodGet, "/blobs/"); n != 0 {
+		t.Fatalf("blob 已存在时不应下载，实际下载了 %d 次", n)
+	}
+	if ok, _ := dst.Store.ManifestExists("digital/dev/app", "v1"); !ok {
+		t.Fatal("目标仓库缺少新 tag")
+	}
+}
+
+func TestMigrateImageSourceMissing(t *testing.T) {
+	src := newFakeRegistry(t, authBasic)
+	dst := newFakeRegistry(t, authBasic)
+
+	if err := harbor.MigrateImage(src.config("/digital/dev/app", "v1"), dst.config("/digital/dev/app", "v1")); err == nil {
+		t.Fatal("源镜像不存在时期望返回错误")
+	}
+	if n := dst.count(http.MethodPut, "/manifests/"); n != 0 {
+		t.Fatalf("源镜像不存在时不应写入目标仓库")
+	}
+}
+
+func TestMigrateImageFailures(t *testing.T) {
+	tests := []struct {
+		name  string
+		onSrc bool
+		fault fault
+	}{
+		{"源仓库下载 blob 返回 500", true, fault{method: http.MethodGet, contains: "/blobs/sha256:", status: http.StatusInternalServerError}},
+		{"源仓库获取 manifest 返回 429", true, fault{method: http.MethodGet, contains: "/manifests/", status: http.StatusTooManyRequests}},
+		{"源仓库 blob 响应被截断", true, fault{method: http.MethodGet, contains: "/blobs/sha256:", truncate: true}},
+		{"源仓库 blob 内容与 digest 不符", true, fault{method: http.MethodGet, contains: "/blobs/sha256:", corrupt: true}},
+		{"目标仓库创建上传会话返回 429", false, fault{method: http.MethodPost, contains: "/blobs/uploads", status: http.StatusTooManyRequests}},
+		{"目标仓库上传 blob 返回 503", false, fault{method: http.MethodPut, contains: "/blobs/uploads", status: http.StatusServiceUnavailable}},
+		{"目标仓库注册 manifest 返回 500", false, fault{method: http.MethodPut, contains: "/manifests/", status: http.StatusInternalServerError}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := newFakeRegistry(t, authBasic)
+			dst := newFakeRegistry(t, authBasic)
+			newTestImage(t, "layer-a", "layer-b").push(t, src.Store, "digital/dev/app", "v1")
+
+			if tt.onSrc {
+				src.inject(tt.fault)
+			} else {
+				dst.inject(tt.fault)
+			}
+
+			err := harbor.MigrateImage(src.config("/digital/dev/app", "v1"), dst.config("/digital/dev/app", "v1"))
+			if err == nil {
+				t.Fatal("期望迁移失败")
+			}
+			if ok, _ := dst.Store.ManifestExists("digital/dev/app", "v1"); ok {
+				t.Fatal("迁移失败时目标仓库不应出现该 tag")
+			}
+		})
+	}
+}
+
+func TestHTTPRegistryBlobs(t *testing.T) {
+	reg := newFakeRegistry(t, authBearer)
+	client := harbor.NewHTTPRegistry(reg.URL, reg.username, reg.password)
+	data := []byte("hello blob")
+	digest := harbor.Digest(data)
+
+	if ok, err := client.BlobExists("/digital/dev/app", digest); err != nil || ok {
+		t.Fatalf("上传前 blob 不应存在: ok=%v err=%v", ok, err)
+	}
+	if _, err := client.GetBlob("/digital/dev/app", digest); err != harbor.ErrNotFound {
+		t.Fatalf("期望 ErrNotFound，得到 %v", err)
+	}
+
+	if err := client.PutBlob("/digital/dev/app", digest, int64(len(data)), bytes.NewReader(data)); err != nil {
+		t.Fatalf("上传 blob 失败: %v", err)
+	}
+	if ok, err := client.BlobExists("/digital/dev/app", digest); err != nil || !ok {
+		t.Fatalf("上传后 blob 应存在: ok=%v err=%v", ok, err)
+	}
+
+	reader, err := client.GetBlob("/digital/dev/app", digest)
+	if err != nil {
+		t.Fatalf("下载 blob 失败: %v", err)
+	}
+	got, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatalf("读取 blob 失败: %v", err)
+	}
+	if string(got) != string(data) {
+		t.Fatalf("blob 内容不一致: %q", got)
+	}
+
+	if err := client.PutBlob("/digital/dev/app", harbor.Digest([]byte("other")), -1, strings.NewReader("tampered")); err == nil {
+		t.Fatal("digest 不匹配时期望上传失败")
+	}
+
+	mounted, err := client.MountBlob("/digital/prod/app", "/digital/dev/app", digest)
+	if err != nil || !mounted {
+		t.Fatalf("期望挂载成功: mounted=%v err=%v", mounted, err)
+	}
+}
+
+func TestMigrateImageMountsWithinSameRegistry(t *testing.T) {
+	reg := newFakeRegistry(t, authBasic)
+	img := newTestImage(t, "layer-a", "layer-b")
+	img.push(t, reg.Store, "digital/dev/app", "v1")
+	// 假仓库的 blob 在所有仓库间共享，让目标仓库的存在性检查返回不存在以走到挂载
+	reg.inject(fault{method: http.MethodHead, contains: "/digital/prod/app/blobs/", status: http.StatusNotFound})
+
+	if err := harbor.MigrateImage(reg.config("/digital/dev/app", "v1"), reg.config("/digital/prod/app", "v1")); err != nil {
+		t.Fatalf("迁移失败: %v", err)
+	}
+	if n := reg.count(http.MethodPost, "/digital/prod/app/blobs/uploads/"); n != 3 {
+		t.Errorf("config 与每个层都应尝试挂载，实际 %d 次", n)
+	}
+	if n := reg.count(http.MethodPut, "/blobs/uploads/") + reg.count(http.MethodPatch, "/blobs/uploads/"); n != 0 {
+		t.Errorf("同一仓库内应挂载而不是上传，实际上传 %d 次", n)
+	}
+	if ok, _ := reg.Store.ManifestExists("digital/prod/app", "v1"); !ok {
+		t.Error("目标仓库缺少 manifest")
+	}
+}
@@ -0,0 +1,355 @@
+package harbor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// OCI 布局中使用的注解，镜像名沿用 containerd 导出时的约定
+const (
+	AnnotationRefName   = "org.opencontainers.image.ref.name"
+	AnnotationImageName = "io.containerd.image.name"
+)
+
+// ociIndex 对应 OCI 布局根目录下的 index.json
+type ociIndex struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Manifests     []Descriptor `json:"manifests"`
+}
+
+// OCILayout 以 OCI Image Layout 目录存储镜像，多个仓库共享同一个 blobs 目录
+type OCILayout struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+// NewOCILayout 打开 OCI 布局目录，不存在时自动初始化
+func NewOCILayout(dir string) (*OCILayout, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755); err != nil {
+		return nil, fmt.Errorf("创建 OCI 目录失败: %v", err)
+	}
+
+	layoutFile := filepath.Join(dir, "oci-layout")
+	if _, err := os.Stat(layoutFile); os.IsNotExist(err) {
+		if err := os.WriteFile(layoutFile, []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644); err != nil {
+			return nil, fmt.Errorf("写入 oci-layout 失败: %v", err)
+		}
+	}
+
+	l := &OCILayout{Dir: dir}
+	if _, err := os.Stat(l.indexPath()); os.IsNotExist(err) {
+		if err := l.writeIndex(&ociIndex{SchemaVersion: 2, MediaType: MediaTypeOCIIndex}); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (l *OCILayout) indexPath() string {
+	return filepath.Join(l.Dir, "index.json")
+}
+
+func (l *OCILayout) blobPath(digest string) (string, error) {
+	algorithm, hexPart, ok := strings.Cut(digest, ":")
+	if !ok || algorithm != "sha256" || len(hexPart) != sha256.Size*2 {
+		return "", fmt.Errorf("非法的 digest: %s", digest)
+	}
+	return filepath.Join(l.Dir, "blobs", algorithm, hexPart), nil
+}
+
+func (l *OCILayout) readIndex() (*ociIndex, error) {
+	data, err := os.ReadFile(l.indexPath())
+	if err != nil {
+		return nil, fmt.Errorf("读取 index.json 失败: %v", err)
+	}
+	var index ociIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("解析 index.json 失败: %v", err)
+	}
+	return &index, nil
+}
+
+func (l *OCILayout) writeIndex(index *ociIndex) error {
+	if index.Manifests == nil {
+		index.Manifests = []Descriptor{}
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化 index.json 失败: %v", err)
+	}
+	tmp := l.indexPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("写入 index.json 失败: %v", err)
+	}
+	return os.Rename(tmp, l.indexPath())
+}
+
+// imageName 返回 index.json 中记录的镜像名（repo:tag）
+func imageName(repo, tag string) string {
+	return repoName(repo) + ":" + tag
+}
+
+// lookup 在 index.json 中查找 repo:tag 对应的描述符
+func (l *OCILayout) lookup(repo, tag string) (*Descriptor, error) {
+	index, err := l.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	name := imageName(repo, tag)
+	for i, desc := range index.Manifests {
+		if desc.Annotations[AnnotationImageName] == name {
+			return &index.Manifests[i], nil
+		}
+	}
+	// 兼容其他工具导出的单镜像布局：只有 ref.name 注解
+	for i, desc := range index.Manifests {
+		if desc.Annotations[AnnotationImageName] == "" && desc.Annotations[AnnotationRefName] == tag {
+			return &index.Manifests[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetManifest 读取 manifest
+func (l *OCILayout) GetManifest(repo, reference string) ([]byte, string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	digest, mediaType := reference, ""
+	if !isDigest(reference) {
+		desc, err := l.lookup(repo, reference)
+		if err != nil {
+			return nil, "", err
+		}
+		digest, mediaType = desc.Digest, desc.MediaType
+	}
+
+	path, err := l.blobPath(digest)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("读取 manifest 失败: %v", err)
+	}
+	if mediaType == "" {
+		mediaType = DetectMediaType(data)
+	}
+	return data, mediaType, nil
+}
+
+// ManifestExists 检查 manifest 是否存在
+func (l *OCILayout) ManifestExists(repo, reference string) (bool, error) {
+	if isDigest(reference) {
+		return l.BlobExists(repo, reference)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.lookup(repo, reference)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// PutManifest 保存 manifest，reference 为 tag 时同时更新 index.json
+func (l *OCILayout) PutManifest(repo, reference, mediaType string, data []byte) error {
+	digest := Digest(data)
+	if isDigest(reference) && reference != digest {
+		return fmt.Errorf("manifest digest 不匹配: 期望 %s，实际 %s", reference, digest)
+	}
+	if err := l.writeBlob(digest, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	if isDigest(reference) {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	index, err := l.readIndex()
+	if err != nil {
+		return err
+	}
+	name := imageName(repo, reference)
+	manifests := index.Manifests[:0]
+	for _, desc := range index.Manifests {
+		if desc.Annotations[AnnotationImageName] != name {
+			manifests = append(manifests, desc)
+		}
+	}
+	index.Manifests = append(manifests, Descriptor{
+		MediaType: mediaType,
+		Size:      int64(len(data)),
+		Digest:    digest,
+		Annotations: map[string]string{
+			AnnotationImageName: name,
+			AnnotationRefName:   reference,
+		},
+	})
+	return l.writeIndex(index)
+}
+
+// BlobExists 检查 blob 是否存在
+func (l *OCILayout) BlobExists(_, digest string) (bool, error) {
+	path, err := l.blobPath(digest)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// StatBlob 返回 blob 文件大小
+func (l *OCILayout) StatBlob(_, digest string) (int64, error) {
+	path, err := l.blobPath(digest)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// GetBlob 打开 blob 文件
+func (l *OCILayout) GetBlob(_, digest string) (io.ReadCloser, error) {
+	path, err := l.blobPath(digest)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+// PutBlob 写入 blob，写入过程中校验 digest 与大小
+func (l *OCILayout) PutBlob(_, digest string, size int64, reader io.Reader) error {
+	if size >= 0 {
+		reader = &sizeCheckReader{reader: reader, expected: size}
+	}
+	return l.writeBlob(digest, reader)
+}
+
+// MountBlob 所有仓库共享 blobs 目录，blob 存在即视为挂载成功
+func (l *OCILayout) MountBlob(repo, _, digest string) (bool, error) {
+	return l.BlobExists(repo, digest)
+}
+
+// ListTags 列出 index.json 中属于该仓库的 tag
+func (l *OCILayout) ListTags(repo string) ([]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	index, err := l.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	prefix := repoName(repo) + ":"
+	var tags []string
+	for _, desc := range index.Manifests {
+		if name := desc.Annotations[AnnotationImageName]; strings.HasPrefix(name, prefix) {
+			tags = append(tags, strings.TrimPrefix(name, prefix))
+		}
+	}
+	if len(tags) == 0 {
+		return nil, ErrNotFound
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// Repositories 列出布局中的所有仓库
+func (l *OCILayout) Repositories() ([]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	index, err := l.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var repos []string
+	for _, desc := range index.Manifests {
+		name := desc.Annotations[AnnotationImageName]
+		if i := strings.LastIndex(name, ":"); i > 0 && !seen[name[:i]] {
+			seen[name[:i]] = true
+			repos = append(repos, name[:i])
+		}
+	}
+	sort.Strings(repos)
+	return repos, nil
+}
+
+// writeBlob 先写临时文件并计算 digest，校验通过后再原子重命名
+func (l *OCILayout) writeBlob(digest string, reader io.Reader) error {
+	path, err := l.blobPath(digest)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		_, err = io.Copy(io.Discard, reader)
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), reader); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入 blob 失败: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入 blob 失败: %v", err)
+	}
+
+	actual := "sha256:" + hex.EncodeToString(hash.Sum(nil))
+	if actual != digest {
+		return fmt.Errorf("blob digest 不匹配: 期望 %s，实际 %s", digest, actual)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// sizeCheckReader 在读到 EOF 时校验实际读取的字节数
+type sizeCheckReader struct {
+	reader   io.Reader
+	expected int64
+	read     int64
+}
+
+func (s *sizeCheckReader) Read(p []byte) (int, error) {
+	n, err := s.reader.Read(p)
+	s.read += int64(n)
+	if s.read > s.expected || (err == io.EOF && s.read != s.expected) {
+		return n, fmt.Errorf("blob 大小不匹配: 期望 %d，实际至少 %d", s.expected, s.read)
+	}
+	return n, err
+}
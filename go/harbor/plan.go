@@ -0,0 +1,96 @@
+package harbor
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// CopyPlan 复制一个镜像前的预估，只查询源与目标仓库，不写入任何内容
+type CopyPlan struct {
+	SourceDigest string       `json:"sourceDigest"`
+	Exists       bool         `json:"exists"`                 // 目标 tag 已存在，不需要迁移
+	Blobs        int          `json:"blobs"`                  // 镜像引用的 blob 总数（去重）
+	MissingBlobs []Descriptor `json:"missingBlobs,omitempty"` // 目标端缺失、需要传输的 blob
+	Bytes        int64        `json:"bytes"`                  // 需要传输的字节数
+}
+
+// PlanCopy 计算将 src 中的 srcRepo:srcRef 复制为 dst 中的 dstRepo:dstTag 需要传输的内容。
+// 目标 tag 已存在时与 MigrateImage 一样视为无需迁移，不再检查 blob
+func PlanCopy(src Registry, srcRepo, srcRef string, dst Registry, dstRepo, dstTag string) (*CopyPlan, error) {
+	data, mediaType, err := src.GetManifest(srcRepo, srcRef)
+	if err != nil {
+		return nil, fmt.Errorf("获取源 manifest 失败: %v", err)
+	}
+	plan := &CopyPlan{SourceDigest: Digest(data)}
+
+	plan.Exists, err = dst.ManifestExists(dstRepo, dstTag)
+	if err != nil {
+		return nil, fmt.Errorf("检查目标镜像失败: %v", err)
+	}
+	if plan.Exists {
+		return plan, nil
+	}
+
+	seen := make(map[string]bool)
+	if err := planManifestContent(src, srcRepo, dst, dstRepo, mediaType, data, seen, plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// PlanMigration 使用 HarborConfig 中的凭据计算一次迁移需要传输的内容
+func PlanMigration(source, dest HarborConfig) (*CopyPlan, error) {
+	return PlanCopy(NewHTTPRegistryFromConfig(source), source.ImagePath, source.ImageTag,
+		NewHTTPRegistryFromConfig(dest), dest.ImagePath, dest.ImageTag)
+}
+
+// planManifestContent 逐个检查 manifest 引用的 blob 在目标端是否存在
+func planManifestContent(src Registry, srcRepo string, dst Registry, dstRepo, mediaType string, data []byte, seen map[string]bool, plan *CopyPlan) error {
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("解析 manifest 失败: %v", err)
+	}
+
+	if IsIndexMediaType(mediaType) {
+		for _, child := range manifest.Manifests {
+			childData, childType, err := src.GetManifest(srcRepo, child.Digest)
+			if err != nil {
+				return fmt.Errorf("获取子 manifest %s 失败: %v", child.Digest, err)
+			}
+			if err := planManifestContent(src, srcRepo, dst, dstRepo, childType, childData, seen, plan); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	blobs := manifest.Layers
+	if manifest.Config.Digest != "" {
+		blobs = append([]Descriptor{manifest.Config}, blobs...)
+	}
+	for _, desc := range blobs {
+		if seen[desc.Digest] {
+			continue
+		}
+		seen[desc.Digest] = true
+		plan.Blobs++
+
+		exists, err := dst.BlobExists(dstRepo, desc.Digest)
+		if err != nil {
+			return fmt.Errorf("检查 blob %s 失败: %v", desc.Digest, err)
+		}
+		if exists {
+			continue
+		}
+		if desc.Size <= 0 {
+			if size, err := src.StatBlob(srcRepo, desc.Digest); err == nil {
+				desc.Size = size
+			}
+		}
+		plan.MissingBlobs = append(plan.MissingBlobs, Descriptor{MediaType: desc.MediaType, Size: desc.Size, Digest: desc.Digest})
+		if desc.Size > 0 {
+			plan.Bytes += desc.Size
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package harbor_test
+
+import (
+	"bytes"
+	"dockerImageMigrator/harbor"
+	"testing"
+)
+
+func TestPlanCopy(t *testing.T) {
+	src := harbor.NewMemoryRegistry()
+	img := newTestImage(t, "layer-a", "layer-bb")
+	img.push(t, src, "digital/dev/app", "v1")
+
+	dst := harbor.NewMemoryRegistry()
+	// 目标端已有一个层
+	if err := dst.PutBlob("library/app", harbor.Digest(img.layers[0]), int64(len(img.layers[0])), bytes.NewReader(img.layers[0])); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := harbor.PlanCopy(src, "digital/dev/app", "v1", dst, "library/app", "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantBytes := int64(len(img.config) + len(img.layers[1]))
+	if plan.Exists || plan.Blobs != 3 || len(plan.MissingBlobs) != 2 || plan.Bytes != wantBytes {
+		t.Fatalf("计划不正确: %+v", plan)
+	}
+	if plan.SourceDigest != img.digest() {
+		t.Fatalf("源 digest 不正确: %s", plan.SourceDigest)
+	}
+
+	// 计划不应写入目标端
+	if exists, _ := dst.ManifestExists("library/app", "v1"); exists {
+		t.Fatal("计划不应写入 manifest")
+	}
+	if exists, _ := dst.BlobExists("library/app", harbor.Digest(img.config)); exists {
+		t.Fatal("计划不应写入 blob")
+	}
+
+	if err := harbor.CopyImage(src, "digital/dev/app", "v1", dst, "library/app", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	plan, err = harbor.PlanCopy(src, "digital/dev/app", "v1", dst, "library/app", "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Exists || len(plan.MissingBlobs) != 0 || plan.Bytes != 0 {
+		t.Fatalf("目标已存在时不需要传输: %+v", plan)
+	}
+
+	if _, err := harbor.PlanCopy(src, "digital/dev/app", "missing", dst, "library/app", "v1"); err == nil {
+		t.Fatal("源镜像不存在时期望返回错误")
+	}
+}
@@ -0,0 +1,287 @@
+package harbor
+
+import (
+	"crypto/sha256"
+	"dockerImageMigrator/log"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// 常见的 manifest 媒体类型
+const (
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+// ErrNotFound 表示 manifest 或 blob 在仓库中不存在
+var ErrNotFound = errors.New("not found")
+
+// Registry 抽象了一个镜像仓库，镜像的字节可以存放在 Harbor、本地目录、tar 包或内存中。
+// repo 参数允许带前导斜杠（如 HarborConfig.ImagePath 中的 "/digital/dev/app"），
+// reference 可以是 tag，也可以是 "sha256:..." 形式的 digest。
+type Registry interface {
+	// GetManifest 获取 manifest 原始内容及其媒体类型，不存在时返回 ErrNotFound
+	GetManifest(repo, reference string) ([]byte, string, error)
+	// ManifestExists 检查 manifest 是否存在
+	ManifestExists(repo, reference string) (bool, error)
+	// PutManifest 以 reference（tag 或 digest）写入 manifest
+	PutManifest(repo, reference, mediaType string, data []byte) error
+	// BlobExists 检查 blob 是否存在
+	BlobExists(repo, digest string) (bool, error)
+	// StatBlob 返回 blob 的大小，不存在时返回 ErrNotFound
+	StatBlob(repo, digest string) (int64, error)
+	// GetBlob 读取 blob，不存在时返回 ErrNotFound，调用方负责关闭
+	GetBlob(repo, digest string) (io.ReadCloser, error)
+	// PutBlob 写入 blob，size 未知时传 -1
+	PutBlob(repo, digest string, size int64, reader io.Reader) error
+	// MountBlob 尝试从同一仓库的 fromRepo 挂载 blob，返回是否挂载成功
+	MountBlob(repo, fromRepo, digest string) (bool, error)
+	// ListTags 列出仓库下的所有 tag
+	ListTags(repo string) ([]string, error)
+}
+
+// Descriptor 描述 manifest 中引用的一个内容
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Size        int64             `json:"size"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// CopyImage 将 src 中的 srcRepo:srcRef 复制为 dst 中的 dstRepo:dstTag。
+// manifest 按原始字节写入，保证目标端 digest 与源端一致；多架构镜像会逐个复制子 manifest。
+func CopyImage(src Registry, srcRepo, srcRef string, dst Registry, dstRepo, dstTag string) error {
+	return CopyImageWithJournal(src, srcRepo, srcRef, dst, dstRepo, dstTag, nil)
+}
+
+// CopyImageWithJournal 与 CopyImage 相同，并在 journal 中记录每个 blob 的状态：
+// 已完成的 blob 不再检查存在性，目标为远程仓库时分块上传，中断后从上次确认的位置续传
+func CopyImageWithJournal(src Registry, srcRepo, srcRef string, dst Registry, dstRepo, dstTag string, journal BlobJournal) error {
+	data, mediaType, err := src.GetManifest(srcRepo, srcRef)
+	if err != nil {
+		return fmt.Errorf("获取源 manifest 失败: %v", err)
+	}
+
+	if err := copyManifestContent(src, srcRepo, dst, dstRepo, mediaType, data, journal); err != nil {
+		return err
+	}
+
+	if err := dst.PutManifest(dstRepo, dstTag, mediaType, data); err != nil {
+		return fmt.Errorf("注册 manifest 失败: %v", err)
+	}
+	return nil
+}
+
+// copyManifestContent 复制 manifest 引用的全部内容（子 manifest 或 blob）
+func copyManifestContent(src Registry, srcRepo string, dst Registry, dstRepo, mediaType string, data []byte, journal BlobJournal) error {
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("解析 manifest 失败: %v", err)
+	}
+
+	if IsIndexMediaType(mediaType) {
+		for _, child := range manifest.Manifests {
+			childData, childType, err := src.GetManifest(srcRepo, child.Digest)
+			if err != nil {
+				return fmt.Errorf("获取子 manifest %s 失败: %v", child.Digest, err)
+			}
+			if err := copyManifestContent(src, srcRepo, dst, dstRepo, childType, childData, journal); err != nil {
+				return err
+			}
+			if err := dst.PutManifest(dstRepo, child.Digest, childType, childData); err != nil {
+				return fmt.Errorf("注册子 manifest %s 失败: %v", child.Digest, err)
+			}
+		}
+		return nil
+	}
+
+	// 并发迁移 config 与所有层
+	var wg sync.WaitGroup
+	errChan := make(chan error, len(manifest.Layers)+1) // +1 for config
+	sem := make(chan struct{}, MaxWorkers)
+
+	copyOne := func(desc Descriptor, fileType string) {
+		defer wg.Done()
+		sem <- struct{}{}
+		defer func() { <-sem }()
+
+		if err := copyBlob(src, srcRepo, dst, dstRepo, desc, fileType, journal); err != nil {
+			errChan <- fmt.Errorf("迁移 %s 失败: %v", fileType, err)
+		}
+	}
+
+	if manifest.Config.Digest != "" {
+		wg.Add(1)
+		go copyOne(manifest.Config, "config.json")
+	}
+	for i, layer := range manifest.Layers {
+		wg.Add(1)
+		go copyOne(layer, fmt.Sprintf("layer%d.tar.gz", i+1))
+	}
+
+	wg.Wait()
+	close(errChan)
+
+	var errs []error
+	for err := range errChan {
+		log.Infof("[ERROR] %v", err)
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("部分 blob 迁移失败: %v", errors.Join(errs...))
+	}
+	return nil
+}
+
+// copyBlob 复制单个 blob，目标端已存在时跳过，源与目标为同一仓库时优先尝试挂载；
+// journal 不为 nil 时记录 blob 状态，并跳过其中已完成的 blob
+func copyBlob(src Registry, srcRepo string, dst Registry, dstRepo string, desc Descriptor, fileType string, journal BlobJournal) error {
+	if journal != nil && journal.BlobDone(dstRepo, desc.Digest) {
+		log.Infof("%s %s 已在上次运行中完成，跳过。", fileType, desc.Digest)
+		return nil
+	}
+
+	exists, err := dst.BlobExists(dstRepo, desc.Digest)
+	if err != nil {
+		return fmt.Errorf("检查 blob 存在性失败: %v", err)
+	}
+	if exists {
+		log.Infof("%s %s 已存在，跳过上传。", fileType, desc.Digest)
+		if journal != nil {
+			journal.RecordBlob(dstRepo, desc.Digest, desc.Size, BlobDone, nil, nil)
+		}
+		return nil
+	}
+
+	if sameRegistry(src, dst) && repoName(srcRepo) != repoName(dstRepo) {
+		mounted, err := dst.MountBlob(dstRepo, srcRepo, desc.Digest)
+		if err != nil {
+			log.Warnf("挂载 %s 失败，改为上传: %v", desc.Digest, err)
+		} else if mounted {
+			log.Infof("%s %s 挂载成功", fileType, desc.Digest)
+			if journal != nil {
+				journal.RecordBlob(dstRepo, desc.Digest, desc.Size, BlobDone, nil, nil)
+			}
+			return nil
+		}
+	}
+
+	if err := uploadBlob(src, srcRepo, dst, dstRepo, desc, journal); err != nil {
+		if journal != nil {
+			journal.RecordBlob(dstRepo, desc.Digest, desc.Size, BlobFailed, nil, err)
+		}
+		return err
+	}
+	if journal != nil {
+		journal.RecordBlob(dstRepo, desc.Digest, desc.Size, BlobDone, nil, nil)
+	}
+	log.Infof("[INFO] %s 上传成功", fileType)
+	return nil
+}
+
+// sameRegistry 判断 src 与 dst 是否为同一仓库：同一实例，或接口地址相同的两个远程仓库客户端
+func sameRegistry(src, dst Registry) bool {
+	if src == dst {
+		return true
+	}
+	a, ok := src.(*HTTPRegistry)
+	b, ok2 := dst.(*HTTPRegistry)
+	return ok && ok2 && normalizeBaseURL(a.BaseURL) == normalizeBaseURL(b.BaseURL)
+}
+
+// normalizeBaseURL 统一接口地址的大小写、默认端口与末尾斜杠，无法解析时原样返回
+func normalizeBaseURL(baseURL string) string {
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil || u.Host == "" {
+		return baseURL
+	}
+	scheme, host := strings.ToLower(u.Scheme), strings.ToLower(u.Host)
+	if scheme == "https" {
+		host = strings.TrimSuffix(host, ":443")
+	} else if scheme == "http" {
+		host = strings.TrimSuffix(host, ":80")
+	}
+	return scheme + "://" + host + u.Path
+}
+
+// uploadBlob 上传 blob。有 journal 且目标为远程仓库时，超过一个分块（或大小未知）的 blob 以及续传的上传
+// 分块上传并记录会话位置，其余 blob 一次上传
+func uploadBlob(src Registry, srcRepo string, dst Registry, dstRepo string, desc Descriptor, journal BlobJournal) error {
+	var session *UploadSession
+	if journal != nil {
+		session = journal.BlobSession(dstRepo, desc.Digest)
+	}
+	if remote, ok := dst.(*HTTPRegistry); ok && journal != nil && (session != nil || desc.Size <= 0 || desc.Size > UploadChunkSize) {
+		progress := func(session UploadSession) {
+			journal.RecordBlob(dstRepo, desc.Digest, desc.Size, BlobTransferring, &session, nil)
+		}
+		if err := remote.UploadBlob(dstRepo, desc.Digest, openBlobAt(src, srcRepo, desc.Digest), session, progress); err != nil {
+			return fmt.Errorf("上传失败: %v", err)
+		}
+		return nil
+	}
+
+	if journal != nil {
+		journal.RecordBlob(dstRepo, desc.Digest, desc.Size, BlobTransferring, nil, nil)
+	}
+	reader, err := src.GetBlob(srcRepo, desc.Digest)
+	if err != nil {
+		return fmt.Errorf("下载失败: %v", err)
+	}
+	defer reader.Close()
+
+	size := desc.Size
+	if size <= 0 {
+		size = -1
+	}
+	if err := dst.PutBlob(dstRepo, desc.Digest, size, reader); err != nil {
+		return fmt.Errorf("上传失败: %v", err)
+	}
+	return nil
+}
+
+// IsIndexMediaType 判断媒体类型是否为多架构索引
+func IsIndexMediaType(mediaType string) bool {
+	return mediaType == MediaTypeDockerManifestList || mediaType == MediaTypeOCIIndex
+}
+
+// DetectMediaType 在仓库未返回 Content-Type 时，根据 manifest 内容推断媒体类型
+func DetectMediaType(data []byte) string {
+	var probe struct {
+		MediaType string          `json:"mediaType"`
+		Manifests json.RawMessage `json:"manifests"`
+	}
+	if err := json.Unmarshal(data, &probe); err == nil {
+		if probe.MediaType != "" {
+			return probe.MediaType
+		}
+		if probe.Manifests != nil {
+			return MediaTypeOCIIndex
+		}
+	}
+	return MediaTypeOCIManifest
+}
+
+// Digest 计算内容的 sha256 digest
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// isDigest 判断 reference 是否为 digest
+func isDigest(reference string) bool {
+	return strings.HasPrefix(reference, "sha256:")
+}
+
+// repoName 去掉仓库路径的首尾斜杠
+func repoName(repo string) string {
+	return strings.Trim(repo, "/")
+}
@@ -0,0 +1,132 @@
+package harbor_test
+
+import (
+	"bytes"
+	"dockerImageMigrator/harbor"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyImageAcrossBackends(t *testing.T) {
+	dir := t.TempDir()
+	img := newTestImage(t, "layer-a", "layer-b")
+
+	mem := harbor.NewMemoryRegistry()
+	img.push(t, mem, "/digital/dev/app", "v1")
+
+	layout, err := harbor.NewOCILayout(filepath.Join(dir, "layout"))
+	if err != nil {
+		t.Fatalf("创建 OCI 布局失败: %v", err)
+	}
+	if err := harbor.CopyImage(mem, "/digital/dev/app", "v1", layout, "/mirror/app", "v1"); err != nil {
+		t.Fatalf("复制到 OCI 布局失败: %v", err)
+	}
+
+	archivePath := filepath.Join(dir, "images.tar")
+	archive, err := harbor.OpenTarArchive(archivePath)
+	if err != nil {
+		t.Fatalf("打开归档失败: %v", err)
+	}
+	if err := harbor.CopyImage(layout, "/mirror/app", "v1", archive, "/mirror/app", "v1"); err != nil {
+		t.Fatalf("复制到归档失败: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("关闭归档失败: %v", err)
+	}
+
+	archive, err = harbor.OpenTarArchive(archivePath)
+	if err != nil {
+		t.Fatalf("重新打开归档失败: %v", err)
+	}
+	defer archive.Close()
+	tags, err := archive.ListTags("mirror/app")
+	if err != nil || len(tags) != 1 || tags[0] != "v1" {
+		t.Fatalf("归档中的 tag 不正确: %v %v", tags, err)
+	}
+
+	back := harbor.NewMemoryRegistry()
+	if err := harbor.CopyImage(archive, "/mirror/app", "v1", back, "/digital/dev/app", "v2"); err != nil {
+		t.Fatalf("从归档复制失败: %v", err)
+	}
+	data, mediaType, err := back.GetManifest("/digital/dev/app", "v2")
+	if err != nil {
+		t.Fatalf("读取 manifest 失败: %v", err)
+	}
+	if !bytes.Equal(data, img.manifest) || mediaType != harbor.MediaTypeDockerManifest {
+		t.Fatalf("往返复制后 manifest 不一致: %s", mediaType)
+	}
+}
+
+func TestCopyImageIndex(t *testing.T) {
+	src := harbor.NewMemoryRegistry()
+	amd64 := newTestImage(t, "amd64-layer")
+	arm64 := newTestImage(t, "arm64-layer")
+	amd64.push(t, src, "app", amd64.digest())
+	arm64.push(t, src, "app", arm64.digest())
+
+	index, err := json.Marshal(harbor.Manifest{
+		MediaType:     harbor.MediaTypeOCIIndex,
+		SchemaVersion: 2,
+		Manifests: []harbor.Descriptor{
+			{MediaType: harbor.MediaTypeDockerManifest, Size: int64(len(amd64.manifest)), Digest: amd64.digest()},
+			{MediaType: harbor.MediaTypeDockerManifest, Size: int64(len(arm64.manifest)), Digest: arm64.digest()},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.PutManifest("app", "multi", harbor.MediaTypeOCIIndex, index); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := newFakeRegistry(t, authNone)
+	client := harbor.NewHTTPRegistry(dst.URL, "", "")
+	if err := harbor.CopyImage(src, "app", "multi", client, "mirror/app", "multi"); err != nil {
+		t.Fatalf("复制多架构镜像失败: %v", err)
+	}
+
+	for _, img := range []*testImage{amd64, arm64} {
+		if ok, _ := dst.Store.ManifestExists("mirror/app", img.digest()); !ok {
+			t.Fatalf("目标仓库缺少子 manifest %s", img.digest())
+		}
+	}
+	data, mediaType, err := client.GetManifest("mirror/app", "multi")
+	if err != nil || !bytes.Equal(data, index) || mediaType != harbor.MediaTypeOCIIndex {
+		t.Fatalf("索引不一致: type=%s err=%v", mediaType, err)
+	}
+}
+
+func TestCopyImageToTarArchive(t *testing.T) {
+	layers := make([]string, 2*harbor.MaxWorkers)
+	for i := range layers {
+		layers[i] = fmt.Sprintf("layer-%d", i)
+	}
+	img := newTestImage(t, layers...)
+	mem := harbor.NewMemoryRegistry()
+	img.push(t, mem, "app", "v1")
+
+	archivePath := filepath.Join(t.TempDir(), "images.tar")
+	archive, err := harbor.OpenTarArchive(archivePath)
+	if err != nil {
+		t.Fatalf("打开归档失败: %v", err)
+	}
+	if err := harbor.CopyImage(mem, "app", "v1", archive, "mirror/app", "v1"); err != nil {
+		t.Fatalf("复制到归档失败: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("关闭归档失败: %v", err)
+	}
+
+	archive, err = harbor.OpenTarArchive(archivePath)
+	if err != nil {
+		t.Fatalf("重新打开归档失败: %v", err)
+	}
+	defer archive.Close()
+	for _, layer := range img.layers {
+		if ok, err := archive.BlobExists("mirror/app", harbor.Digest(layer)); err != nil || !ok {
+			t.Fatalf("归档中缺少层 %s: %v", layer, err)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package harbor
+
+import (
+	"bytes"
+	"dockerImageMigrator/log"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// UploadChunkSize 分块上传时每个 PATCH 请求的大小
+var UploadChunkSize int64 = 8 << 20
+
+// blob 状态，与迁移日志中的状态一致
+const (
+	BlobTransferring = "transferring"
+	BlobDone         = "done"
+	BlobFailed       = "failed"
+)
+
+// UploadSession 未完成的分块上传会话，Offset 为仓库已确认接收的字节数
+type UploadSession struct {
+	Location string `json:"location"`
+	Offset   int64  `json:"offset"`
+}
+
+// BlobJournal 记录复制过程中每个 blob 的状态，进程中断后据此跳过已完成的 blob 并续传未完成的上传。
+// repo 为目标仓库中的路径，实现需要支持并发调用
+type BlobJournal interface {
+	// BlobDone 返回 blob 是否已确认写入目标仓库
+	BlobDone(repo, digest string) bool
+	// BlobSession 返回 blob 未完成的上传会话，没有时返回 nil
+	BlobSession(repo, digest string) *UploadSession
+	// RecordBlob 记录 blob 状态，传输中时 session 为当前的上传会话
+	RecordBlob(repo, digest string, size int64, state string, session *UploadSession, err error)
+}
+
+// GetBlobFrom 从 offset 开始下载 blob，仓库不支持 Range 请求时跳过前 offset 个字节
+func (r *HTTPRegistry) GetBlobFrom(repo, digest string, offset int64) (io.ReadCloser, error) {
+	if offset == 0 {
+		return r.GetBlob(repo, digest)
+	}
+	req, err := http.NewRequest("GET", r.url(repo, "blobs/%s", digest), nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建 GET 请求失败: %v", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+
+	resp, err := r.do(req, repo, false)
+	if err != nil {
+		return nil, fmt.Errorf("发送 GET 请求失败: %v", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusOK:
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("跳过已上传的内容失败: %v", err)
+		}
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("下载 blob 失败: 状态码 %d - %s", resp.StatusCode, resp.Status)
+	}
+}
+
+// UploadBlob 以 PATCH 分块上传 blob，每确认一块调用 progress 记录会话位置。
+// session 不为空时先查询该会话已接收的字节数并从该位置继续，会话失效时重新开始；
+// open 返回从 offset 开始的 blob 内容
+func (r *HTTPRegistry) UploadBlob(repo, digest string, open func(offset int64) (io.ReadCloser, error), session *UploadSession, progress func(UploadSession)) error {
+	var current UploadSession
+	if session != nil && session.Location != "" {
+		offset, location, err := r.uploadStatus(repo, session.Location)
+		if err != nil {
+			log.Warnf("上传会话已失效，重新上传 %s: %v", digest, err)
+		} else {
+			current = UploadSession{Location: location, Offset: offset}
+			log.Infof("继续上传 %s，已上传 %d 字节", digest, offset)
+		}
+	}
+	if current.Location == "" {
+		location, err := r.startUpload(repo)
+		if err != nil {
+			return err
+		}
+		current = UploadSession{Location: location}
+	}
+	if progress != nil {
+		progress(current)
+	}
+
+	reader, err := open(current.Offset)
+	if err != nil {
+		return fmt.Errorf("下载失败: %v", err)
+	}
+	defer reader.Close()
+
+	chunk := make([]byte, UploadChunkSize)
+	for {
+		n, readErr := io.ReadFull(reader, chunk)
+		if n > 0 {
+			location, err := r.patchChunk(repo, current, chunk[:n])
+			if err != nil {
+				return err
+			}
+			current = UploadSession{Location: location, Offset: current.Offset + int64(n)}
+			if progress != nil {
+				progress(current)
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("下载失败: %v", readErr)
+		}
+	}
+
+	uploadURL, err := r.resolveLocation(current.Location)
+	if err != nil {
+		return err
+	}
+	query := uploadURL.Query()
+	query.Set("digest", digest)
+	uploadURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest("PUT", uploadURL.String(), http.NoBody)
+	if err != nil {
+		return fmt.Errorf("创建 PUT 请求失败: %v", err)
+	}
+	resp, err := r.do(req, repo, true)
+	if err != nil {
+		return fmt.Errorf("发送 PUT 请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("上传失败: 状态码 %d - %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// patchChunk 上传一块内容，返回仓库给出的新会话地址
+func (r *HTTPRegistry) patchChunk(repo string, session UploadSession, data []byte) (string, error) {
+	uploadURL, err := r.resolveLocation(session.Location)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("PATCH", uploadURL.String(), bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("创建 PATCH 请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Range", fmt.Sprintf("%d-%d", session.Offset, session.Offset+int64(len(data))-1))
+
+	resp, err := r.do(req, repo, true)
+	if err != nil {
+		return "", fmt.Errorf("发送 PATCH 请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("分块上传失败: 状态码 %d - %s", resp.StatusCode, string(body))
+	}
+	if location := resp.Header.Get("Location"); location != "" {
+		return location, nil
+	}
+	return session.Location, nil
+}
+
+// uploadStatus 查询上传会话已接收的字节数。
+// 仓库对空会话与只收到 1 字节的会话都返回 Range: 0-0，无法区分时视为会话失效
+func (r *HTTPRegistry) uploadStatus(repo, location string) (int64, string, error) {
+	uploadURL, err := r.resolveLocation(location)
+	if err != nil {
+		return 0, "", err
+	}
+	req, err := http.NewRequest("GET", uploadURL.String(), nil)
+	if err != nil {
+		return 0, "", fmt.Errorf("创建查询上传状态请求失败: %v", err)
+	}
+	resp, err := r.do(req, repo, true)
+	if err != nil {
+		return 0, "", fmt.Errorf("查询上传状态失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return 0, "", fmt.Errorf("查询上传状态失败: 状态码 %d", resp.StatusCode)
+	}
+
+	_, end, ok := strings.Cut(resp.Header.Get("Range"), "-")
+	last, err := strconv.ParseInt(end, 10, 64)
+	if !ok || err != nil || last <= 0 {
+		return 0, "", fmt.Errorf("无法确定已上传的字节数: Range %q", resp.Header.Get("Range"))
+	}
+	if next := resp.Header.Get("Location"); next != "" {
+		location = next
+	}
+	return last + 1, location, nil
+}
+
+// openBlobAt 返回从 offset 开始读取 blob 的函数，源仓库支持时使用 Range 请求
+func openBlobAt(src Registry, repo, digest string) func(offset int64) (io.ReadCloser, error) {
+	return func(offset int64) (io.ReadCloser, error) {
+		if remote, ok := src.(*HTTPRegistry); ok {
+			return remote.GetBlobFrom(repo, digest, offset)
+		}
+		reader, err := src.GetBlob(repo, digest)
+		if err != nil {
+			return nil, err
+		}
+		if seeker, ok := reader.(io.Seeker); ok {
+			if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+				reader.Close()
+				return nil, err
+			}
+			return reader, nil
+		}
+		if _, err := io.CopyN(io.Discard, reader, offset); err != nil {
+			reader.Close()
+			return nil, err
+		}
+		return reader, nil
+	}
+}
@@ -0,0 +1,147 @@
+package harbor_test
+
+import (
+	"bytes"
+	"dockerImageMigrator/harbor"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memoryJournal 在内存中记录 blob 状态的 BlobJournal
+type memoryJournal struct {
+	mu       sync.Mutex
+	states   map[string]string
+	sessions map[string]*harbor.UploadSession
+}
+
+func newMemoryJournal() *memoryJournal {
+	return &memoryJournal{states: make(map[string]string), sessions: make(map[string]*harbor.UploadSession)}
+}
+
+func (m *memoryJournal) BlobDone(repo, digest string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.states[digest] == harbor.BlobDone
+}
+
+func (m *memoryJournal) BlobSession(repo, digest string) *harbor.UploadSession {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sessions[digest]
+}
+
+func (m *memoryJournal) RecordBlob(repo, digest string, size int64, state string, session *harbor.UploadSession, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[digest] = state
+	if session != nil {
+		m.sessions[digest] = session
+	}
+}
+
+// failingSource 读取指定 blob 时在 limit 字节后返回错误，模拟传输中断
+type failingSource struct {
+	harbor.Registry
+	digest string
+	limit  int64
+}
+
+func (f *failingSource) GetBlob(repo, digest string) (io.ReadCloser, error) {
+	reader, err := f.Registry.GetBlob(repo, digest)
+	if err != nil || digest != f.digest {
+		return reader, err
+	}
+	return io.NopCloser(io.MultiReader(io.LimitReader(reader, f.limit), errReader{})), nil
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errors.New("connection reset") }
+
+func TestCopyImageWithJournalResumesUpload(t *testing.T) {
+	defer func(size int64) { harbor.UploadChunkSize = size }(harbor.UploadChunkSize)
+	harbor.UploadChunkSize = 4
+
+	src := harbor.NewMemoryRegistry()
+	img := newTestImage(t, "small", strings.Repeat("0123456789", 3))
+	img.push(t, src, "digital/dev/app", "v1")
+	bigLayer := harbor.Digest(img.layers[1])
+
+	fake := newFakeRegistry(t, authBasic)
+	dst := harbor.NewHTTPRegistry(fake.URL, "admin", "Harbor12345")
+	journal := newMemoryJournal()
+
+	broken := &failingSource{Registry: src, digest: bigLayer, limit: 10}
+	if err := harbor.CopyImageWithJournal(broken, "digital/dev/app", "v1", dst, "library/app", "v1", journal); err == nil {
+		t.Fatal("传输中断时期望返回错误")
+	}
+	session := journal.BlobSession("library/app", bigLayer)
+	if session == nil || session.Offset != 10 {
+		t.Fatalf("期望记录已上传 10 字节的会话: %+v", session)
+	}
+	if journal.states[bigLayer] != harbor.BlobFailed || journal.states[harbor.Digest(img.config)] != harbor.BlobDone {
+		t.Fatalf("blob 状态不正确: %v", journal.states)
+	}
+
+	postsBefore := fake.count("POST", "/blobs/uploads/")
+	headsBefore := fake.count("HEAD", "/blobs/")
+	if err := harbor.CopyImageWithJournal(src, "digital/dev/app", "v1", dst, "library/app", "v1", journal); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.count("POST", "/blobs/uploads/") - postsBefore; n != 0 {
+		t.Fatalf("续传不应创建新的上传会话，实际 %d 次", n)
+	}
+	if n := fake.count("HEAD", "/blobs/") - headsBefore; n != 1 {
+		t.Fatalf("已完成的 blob 不应再检查存在性，实际 HEAD %d 次", n)
+	}
+
+	data, err := fake.Store.GetBlob("library/app", bigLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer data.Close()
+	content, _ := io.ReadAll(data)
+	if !bytes.Equal(content, img.layers[1]) {
+		t.Fatalf("续传后的内容不一致: %q", content)
+	}
+	if result := harbor.VerifyImage(src, "digital/dev/app", "v1", dst, "library/app", "v1", true); !result.OK() {
+		t.Fatalf("续传后校验失败: %v", result.Problems)
+	}
+}
+
+func TestCopyImageWithJournalUploadsSmallBlobsAtOnce(t *testing.T) {
+	defer func(size int64) { harbor.UploadChunkSize = size }(harbor.UploadChunkSize)
+	harbor.UploadChunkSize = 16
+
+	src := harbor.NewMemoryRegistry()
+	img := newTestImage(t, "small", strings.Repeat("0123456789", 3))
+	img.push(t, src, "digital/dev/app", "v1")
+
+	fake := newFakeRegistry(t, authBasic)
+	dst := harbor.NewHTTPRegistry(fake.URL, "admin", "Harbor12345")
+	if err := harbor.CopyImageWithJournal(src, "digital/dev/app", "v1", dst, "library/app", "v1", newMemoryJournal()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 只有超过一个分块的 blob 分块上传
+	blobs := append([][]byte{img.config}, img.layers...)
+	large, chunks := 0, 0
+	for _, blob := range blobs {
+		if size := int64(len(blob)); size > harbor.UploadChunkSize {
+			large++
+			chunks += int((size + harbor.UploadChunkSize - 1) / harbor.UploadChunkSize)
+		}
+	}
+	if large == 0 || large == len(blobs) {
+		t.Fatalf("测试镜像应同时包含大小 blob: %d", large)
+	}
+	if n := fake.count("PATCH", "/blobs/uploads/"); n != chunks {
+		t.Errorf("期望 %d 个大 blob 共分 %d 块上传，实际 PATCH %d 次", large, chunks, n)
+	}
+	if result := harbor.VerifyImage(src, "digital/dev/app", "v1", dst, "library/app", "v1", true); !result.OK() {
+		t.Fatalf("校验失败: %v", result.Problems)
+	}
+}
@@ -0,0 +1,308 @@
+package harbor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RobotPrefix 迁移工具创建的机器人账号的名称前缀，Harbor 会再加上自己的前缀（默认 robot$）
+const RobotPrefix = "migrator-"
+
+// NeverExpire 机器人账号永不过期的有效期
+const NeverExpire = -1
+
+// robotPageSize 列出机器人账号时每页的数量
+const robotPageSize = 100
+
+// Robot Harbor 系统级机器人账号
+type Robot struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"` // 完整名称，如 robot$migrator-1a2b3c4d.apps.20260101120000000
+	Description string    `json:"description,omitempty"`
+	Secret      string    `json:"-"`        // 只在创建时返回
+	Projects    []string  `json:"projects"` // 可以拉取的项目
+	Disabled    bool      `json:"disabled,omitempty"`
+	Created     time.Time `json:"created"`
+	ExpiresAt   time.Time `json:"expiresAt"` // 零值表示永不过期
+}
+
+// ShortName 去掉 Harbor 前缀后的名称
+func (r *Robot) ShortName() string {
+	return r.Name[strings.LastIndex(r.Name, "$")+1:]
+}
+
+// Managed 判断是否为迁移工具创建的账号
+func (r *Robot) Managed() bool {
+	return strings.HasPrefix(r.ShortName(), RobotPrefix)
+}
+
+// Expired 判断在 now 时是否已过期
+func (r *Robot) Expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+}
+
+// Stale 判断账号是否已失效（过期或被禁用），可以清理
+func (r *Robot) Stale(now time.Time) bool {
+	return r.Expired(now) || r.Disabled
+}
+
+// Covers 判断账号是否可以拉取所有 projects
+func (r *Robot) Covers(projects []string) bool {
+	have := make(map[string]bool, len(r.Projects))
+	for _, project := range r.Projects {
+		have[project] = true
+	}
+	for _, project := range projects {
+		if !have[project] {
+			return false
+		}
+	}
+	return true
+}
+
+// robotModel Harbor API 中的机器人账号
+type robotModel struct {
+	ID           int64             `json:"id,omitempty"`
+	Name         string            `json:"name"`
+	Description  string            `json:"description,omitempty"`
+	Secret       string            `json:"secret,omitempty"`
+	Level        string            `json:"level,omitempty"`
+	Duration     int               `json:"duration"`
+	Disable      bool              `json:"disable"`
+	ExpiresAt    int64             `json:"expires_at,omitempty"`
+	CreationTime string            `json:"creation_time,omitempty"`
+	Permissions  []robotPermission `json:"permissions"`
+}
+
+type robotPermission struct {
+	Kind      string        `json:"kind"`
+	Namespace string        `json:"namespace"`
+	Access    []robotAccess `json:"access"`
+}
+
+type robotAccess struct {
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+}
+
+func (m *robotModel) robot() *Robot {
+	robot := &Robot{ID: m.ID, Name: m.Name, Description: m.Description, Secret: m.Secret, Disabled: m.Disable}
+	for _, permission := range m.Permissions {
+		if permission.Kind == "project" {
+			robot.Projects = append(robot.Projects, permission.Namespace)
+		}
+	}
+	sort.Strings(robot.Projects)
+	if created, err := time.Parse(time.RFC3339, m.CreationTime); err == nil {
+		robot.Created = created
+	}
+	if m.ExpiresAt > 0 {
+		robot.ExpiresAt = time.Unix(m.ExpiresAt, 0)
+	}
+	return robot
+}
+
+// API 通过 Harbor API v2.0 管理目标 Harbor，需要管理员或有机器人账号管理权限的用户
+type API struct {
+	BaseURL  string
+	Username string
+	Password string
+
+	client *http.Client
+}
+
+// NewAPI 使用 HarborConfig 中的接口地址、凭据与 TLS 设置创建 Harbor API 客户端
+func NewAPI(config HarborConfig) *API {
+	return &API{
+		BaseURL:  strings.TrimRight(config.HarborApi, "/"),
+		Username: config.Username,
+		Password: config.Password,
+		client:   createHTTPClient(config.TLS),
+	}
+}
+
+// do 发送 JSON 请求，out 不为 nil 时解析响应
+func (a *API) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, a.BaseURL+"/api/v2.0"+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if a.Username != "" || a.Password != "" {
+		req.Header.Set("Authorization", "Basic "+basicAuth(a.Username, a.Password))
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return apiError(resp.StatusCode, data)
+	}
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("解析 %s %s 的响应失败: %v", method, path, err)
+		}
+	}
+	return nil
+}
+
+// apiError 从 Harbor 的错误响应 {"errors":[{"code","message"}]} 中取出信息
+func apiError(status int, data []byte) error {
+	var body struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(data, &body) == nil && len(body.Errors) > 0 {
+		return fmt.Errorf("HTTP %d: %s", status, body.Errors[0].Message)
+	}
+	return fmt.Errorf("HTTP %d: %s", status, strings.TrimSpace(string(data)))
+}
+
+// ListRobots 列出所有系统级机器人账号
+func (a *API) ListRobots() ([]*Robot, error) {
+	var robots []*Robot
+	for page := 1; ; page++ {
+		var models []robotModel
+		query := url.Values{"page": {fmt.Sprint(page)}, "page_size": {fmt.Sprint(robotPageSize)}}
+		if err := a.do("GET", "/robots?"+query.Encode(), nil, &models); err != nil {
+			return nil, fmt.Errorf("列出机器人账号失败: %v", err)
+		}
+		for i := range models {
+			robots = append(robots, models[i].robot())
+		}
+		if len(models) < robotPageSize {
+			return robots, nil
+		}
+	}
+}
+
+// CreatePullRobot 创建只能拉取 projects 中镜像的机器人账号，days 为有效天数，NeverExpire 表示永不过期。
+// 返回的账号带有 Secret
+func (a *API) CreatePullRobot(name string, projects []string, days int, description string) (*Robot, error) {
+	model := robotModel{Name: name, Description: description, Level: "system", Duration: days}
+	for _, project := range projects {
+		model.Permissions = append(model.Permissions, robotPermission{
+			Kind:      "project",
+			Namespace: project,
+			Access:    []robotAccess{{Resource: "repository", Action: "pull"}},
+		})
+	}
+	var created robotModel
+	if err := a.do("POST", "/robots", model, &created); err != nil {
+		return nil, fmt.Errorf("创建机器人账号 %s 失败: %v", name, err)
+	}
+	robot := model.robot()
+	robot.ID, robot.Name, robot.Secret = created.ID, created.Name, created.Secret
+	if created.ExpiresAt > 0 {
+		robot.ExpiresAt = time.Unix(created.ExpiresAt, 0)
+	}
+	if parsed, err := time.Parse(time.RFC3339, created.CreationTime); err == nil {
+		robot.Created = parsed
+	}
+	return robot, nil
+}
+
+// DeleteRobot 删除机器人账号
+func (a *API) DeleteRobot(robot *Robot) error {
+	if err := a.do("DELETE", fmt.Sprintf("/robots/%d", robot.ID), nil, nil); err != nil {
+		return fmt.Errorf("删除机器人账号 %s 失败: %v", robot.Name, err)
+	}
+	return nil
+}
+
+// PullRobotName 返回为集群 cluster 的命名空间 namespace 签发的机器人账号名称 RobotPrefix+cluster.namespace.<时间>。
+// 命名空间名称不含 .，cluster 由调用方保证不含 .。每次签发都创建新账号，不刷新旧账号的密码，新凭据生效前旧凭据仍然可用
+func PullRobotName(cluster, namespace string, now time.Time) string {
+	return fmt.Sprintf("%s%s.%s.%s%03d", RobotPrefix, cluster, namespace, now.Format("20060102150405"), now.Nanosecond()/int(time.Millisecond))
+}
+
+// Owner 返回签发账号时的集群与命名空间，不是按 PullRobotName 命名的账号返回空
+func (r *Robot) Owner() (cluster, namespace string) {
+	name, ok := strings.CutPrefix(r.ShortName(), RobotPrefix)
+	if !ok {
+		return "", ""
+	}
+	parts := strings.Split(name, ".")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+// issuedFor 判断账号是否为集群 cluster 的命名空间 namespace 签发
+func (r *Robot) issuedFor(cluster, namespace string) bool {
+	c, ns := r.Owner()
+	return ns != "" && c == cluster && ns == namespace
+}
+
+// IssuePullRobot 为集群 cluster 的命名空间 namespace 创建新的机器人账号，可以拉取 projects 以及为该命名空间签发的
+// 其他有效账号的项目（之前部署到同一命名空间的其他工作负载仍需要它们）。旧账号保持不变，新凭据生效后由调用方 RevokePullRobots
+func (a *API) IssuePullRobot(cluster, namespace string, projects []string, days int, now time.Time) (*Robot, error) {
+	robots, err := a.ListRobots()
+	if err != nil {
+		return nil, err
+	}
+	wanted := append([]string(nil), projects...)
+	for _, robot := range robots {
+		if robot.issuedFor(cluster, namespace) && !robot.Stale(now) {
+			wanted = append(wanted, robot.Projects...)
+		}
+	}
+	return a.CreatePullRobot(PullRobotName(cluster, namespace, now), uniqueSorted(wanted), days, "由 migrator 创建的只读拉取账号")
+}
+
+// RevokePullRobots 删除为集群 cluster 的命名空间 namespace 签发的、keep 以外的机器人账号，返回已删除的账号
+func (a *API) RevokePullRobots(cluster, namespace string, keep *Robot) ([]*Robot, error) {
+	robots, err := a.ListRobots()
+	if err != nil {
+		return nil, err
+	}
+	var revoked []*Robot
+	for _, robot := range robots {
+		if !robot.issuedFor(cluster, namespace) || robot.ID == keep.ID {
+			continue
+		}
+		if err := a.DeleteRobot(robot); err != nil {
+			return revoked, err
+		}
+		revoked = append(revoked, robot)
+	}
+	return revoked, nil
+}
+
+func uniqueSorted(values []string) []string {
+	sort.Strings(values)
+	result := values[:0]
+	for i, value := range values {
+		if i == 0 || value != values[i-1] {
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,196 @@
+package harbor_test
+
+import (
+	"dockerImageMigrator/harbor"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRobots 模拟 Harbor /api/v2.0/robots 接口
+type fakeRobots struct {
+	mu     sync.Mutex
+	robots map[int64]map[string]interface{}
+	nextID int64
+	now    time.Time
+}
+
+func newFakeRobots(t *testing.T, now time.Time) (*fakeRobots, *harbor.API) {
+	f := &fakeRobots{robots: make(map[int64]map[string]interface{}), nextID: 1, now: now}
+	server := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(server.Close)
+	return f, harbor.NewAPI(harbor.HarborConfig{HarborApi: server.URL, Username: "admin", Password: "Harbor12345"})
+}
+
+func (f *fakeRobots) add(name string, projects []string, expiresAt int64, disabled bool) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var permissions []interface{}
+	for _, project := range projects {
+		permissions = append(permissions, map[string]interface{}{"kind": "project", "namespace": project})
+	}
+	id := f.nextID
+	f.nextID++
+	f.robots[id] = map[string]interface{}{
+		"id": id, "name": "robot$" + name, "level": "system", "disable": disabled, "expires_at": expiresAt,
+		"creation_time": f.now.UTC().Format(time.RFC3339), "permissions": permissions,
+	}
+	return id
+}
+
+func (f *fakeRobots) error(w http.ResponseWriter, code int, message string) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{"errors": []interface{}{map[string]string{"code": "ERR", "message": message}}})
+}
+
+func (f *fakeRobots) serve(w http.ResponseWriter, r *http.Request) {
+	if user, password, _ := r.BasicAuth(); user != "admin" || password != "Harbor12345" {
+		f.error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	id, _ := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/v2.0/robots/"), 10, 64)
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/api/v2.0/robots":
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+		f.mu.Lock()
+		var list []interface{}
+		for i := int64(1); i < f.nextID; i++ {
+			if robot, ok := f.robots[i]; ok {
+				list = append(list, robot)
+			}
+		}
+		f.mu.Unlock()
+		start, end := (page-1)*size, page*size
+		if start > len(list) {
+			start = len(list)
+		}
+		if end > len(list) {
+			end = len(list)
+		}
+		json.NewEncoder(w).Encode(append([]interface{}{}, list[start:end]...))
+	case r.Method == "POST" && r.URL.Path == "/api/v2.0/robots":
+		var body struct {
+			Name        string
+			Level       string
+			Duration    int
+			Permissions []struct {
+				Kind, Namespace string
+				Access          []struct{ Resource, Action string }
+			}
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		var projects []string
+		for _, permission := range body.Permissions {
+			if len(permission.Access) != 1 || permission.Access[0].Action != "pull" {
+				f.error(w, http.StatusBadRequest, "expected pull-only access")
+				return
+			}
+			projects = append(projects, permission.Namespace)
+		}
+		expiresAt := int64(-1)
+		if body.Duration > 0 {
+			expiresAt = f.now.AddDate(0, 0, body.Duration).Unix()
+		}
+		id := f.add(body.Name, projects, expiresAt, false)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id": id, "name": "robot$" + body.Name, "secret": fmt.Sprintf("secret-%d", id),
+			"expires_at": expiresAt, "creation_time": f.now.UTC().Format(time.RFC3339),
+		})
+	case r.Method == "DELETE" && id > 0:
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.robots[id]; !ok {
+			f.error(w, http.StatusNotFound, "not found")
+			return
+		}
+		delete(f.robots, id)
+	default:
+		f.error(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func TestIssueAndRevokePullRobots(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake, api := newFakeRobots(t, now)
+	fake.add("someone-else", []string{"app"}, -1, false)
+	fake.add("migrator-c1.apps.20250101000000000", []string{"web"}, -1, false)
+	fake.add("migrator-c1.apps.20250101000000001", []string{"old"}, now.Add(-time.Hour).Unix(), false)
+	fake.add("migrator-c2.apps.20250101000000000", []string{"other"}, -1, false)
+	fake.add("migrator-c1.apps-v2.20250101000000000", []string{"v2"}, -1, false)
+	fake.add("migrator-apps", []string{"web"}, -1, false)
+
+	robot, err := api.IssuePullRobot("c1", "apps", []string{"app"}, 30, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cluster, namespace := robot.Owner(); robot.Name != "robot$migrator-c1.apps.20260101000000000" || robot.Secret != "secret-7" || cluster != "c1" || namespace != "apps" {
+		t.Errorf("创建的账号错误: %+v", robot)
+	}
+	// 合并同一集群同一命名空间有效账号的项目，已过期账号以及其他集群、其他命名空间的项目不合并
+	if strings.Join(robot.Projects, ",") != "app,web" || !robot.ExpiresAt.Equal(now.AddDate(0, 0, 30)) {
+		t.Errorf("项目或有效期错误: %+v", robot)
+	}
+
+	robots, err := api.ListRobots()
+	if err != nil || len(robots) != 7 {
+		t.Fatalf("签发新账号时不应删除旧账号: %v, %v", robots, err)
+	}
+
+	revoked, err := api.RevokePullRobots("c1", "apps", robot)
+	if err != nil || len(revoked) != 2 {
+		t.Fatalf("应删除 c1 中 apps 的两个旧账号: %v, %v", revoked, err)
+	}
+	robots, err = api.ListRobots()
+	if err != nil || len(robots) != 5 {
+		t.Fatalf("应剩下五个账号: %v, %v", robots, err)
+	}
+	names := make([]string, len(robots))
+	for i, r := range robots {
+		names[i] = r.ShortName()
+	}
+	want := "someone-else,migrator-c2.apps.20250101000000000,migrator-c1.apps-v2.20250101000000000,migrator-apps,migrator-c1.apps.20260101000000000"
+	if strings.Join(names, ",") != want {
+		t.Errorf("保留的账号错误: %v", names)
+	}
+	// 不按 PullRobotName 命名的账号不属于任何命名空间
+	if cluster, namespace := robots[3].Owner(); cluster != "" || namespace != "" {
+		t.Errorf("%s 不应有所属命名空间: %s, %s", robots[3].Name, cluster, namespace)
+	}
+}
+
+func TestListRobotsPagesAndStale(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake, api := newFakeRobots(t, now)
+	for i := 0; i < 150; i++ {
+		fake.add(fmt.Sprintf("migrator-ns%d", i), []string{"app"}, now.Add(time.Duration(i-1)*time.Hour).Unix(), i == 149)
+	}
+	robots, err := api.ListRobots()
+	if err != nil || len(robots) != 150 {
+		t.Fatalf("应分页列出全部账号: %d, %v", len(robots), err)
+	}
+	stale := 0
+	for _, robot := range robots {
+		if robot.Stale(now) {
+			stale++
+		}
+	}
+	// ns0、ns1 已过期，ns149 被禁用
+	if stale != 3 {
+		t.Errorf("应有 3 个失效的账号，实际 %d", stale)
+	}
+
+	if err := api.DeleteRobot(robots[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.DeleteRobot(robots[0]); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("删除不存在的账号应报错: %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package harbor
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// TarArchive 以 tar 包形式存放的 OCI 布局。
+// 打开时解压到临时目录，写入过的归档在 Close 时重新打包。
+type TarArchive struct {
+	*OCILayout
+	Path string
+
+	dirty atomic.Bool // 复制镜像时多个 goroutine 并发写入 blob
+}
+
+// OpenTarArchive 打开 tar 归档，文件不存在时创建一个空归档
+func OpenTarArchive(path string) (*TarArchive, error) {
+	tmpDir, err := os.MkdirTemp("", "harbor-archive-*")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %v", err)
+	}
+
+	if file, err := os.Open(path); err == nil {
+		err = extractTar(file, tmpDir)
+		file.Close()
+		if err != nil {
+			os.RemoveAll(tmpDir)
+			return nil, fmt.Errorf("解压归档 %s 失败: %v", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		os.RemoveAll(tmpDir)
+		return nil, fmt.Errorf("打开归档 %s 失败: %v", path, err)
+	}
+
+	layout, err := NewOCILayout(tmpDir)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, err
+	}
+	return &TarArchive{OCILayout: layout, Path: path}, nil
+}
+
+// PutManifest 写入 manifest 并标记归档需要重新打包
+func (t *TarArchive) PutManifest(repo, reference, mediaType string, data []byte) error {
+	t.dirty.Store(true)
+	return t.OCILayout.PutManifest(repo, reference, mediaType, data)
+}
+
+// PutBlob 写入 blob 并标记归档需要重新打包
+func (t *TarArchive) PutBlob(repo, digest string, size int64, reader io.Reader) error {
+	t.dirty.Store(true)
+	return t.OCILayout.PutBlob(repo, digest, size, reader)
+}
+
+// Close 有写入时重新打包归档，并清理临时目录
+func (t *TarArchive) Close() error {
+	defer os.RemoveAll(t.Dir)
+	if !t.dirty.Load() {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(t.Path), filepath.Base(t.Path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("创建归档失败: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := writeTar(tmp, t.Dir); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入归档失败: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入归档失败: %v", err)
+	}
+	return os.Rename(tmp.Name(), t.Path)
+}
+
+// extractTar 将 tar 流解压到 dir，拒绝越出目标目录的路径
+func extractTar(reader io.Reader, dir string) error {
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("归档中包含非法路径: %s", header.Name)
+		}
+		target := filepath.Join(dir, name)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(file, tr)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// writeTar 将 dir 下的所有文件打包为 tar 流
+func writeTar(writer io.Writer, dir string) error {
+	tw := tar.NewWriter(writer)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		// 跳过未完成的临时文件
+		if strings.HasPrefix(info.Name(), ".upload-") || strings.HasSuffix(info.Name(), ".tmp") {
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
@@ -0,0 +1,142 @@
+package harbor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// VerifyResult 一次镜像校验的结果
+type VerifyResult struct {
+	Source       string   `json:"source"`
+	Dest         string   `json:"dest"`
+	SourceDigest string   `json:"sourceDigest,omitempty"`
+	DestDigest   string   `json:"destDigest,omitempty"`
+	BlobsChecked int      `json:"blobsChecked"`
+	Problems     []string `json:"problems,omitempty"`
+}
+
+// OK 没有发现任何问题时返回 true
+func (r *VerifyResult) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *VerifyResult) addProblem(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// VerifyImage 校验 dst 中的 dstRepo:dstRef 是否与 src 中的 srcRepo:srcRef 一致：
+// 比较 manifest digest，并确认目标端存在所有引用的 blob 且大小正确，rehash 为 true 时重新计算 blob 的 sha256
+func VerifyImage(src Registry, srcRepo, srcRef string, dst Registry, dstRepo, dstRef string, rehash bool) *VerifyResult {
+	result := &VerifyResult{
+		Source: repoName(srcRepo) + ":" + srcRef,
+		Dest:   repoName(dstRepo) + ":" + dstRef,
+	}
+
+	srcData, _, err := src.GetManifest(srcRepo, srcRef)
+	if err != nil {
+		result.addProblem("获取源 manifest 失败: %v", err)
+		return result
+	}
+	result.SourceDigest = Digest(srcData)
+
+	dstData, dstType, err := dst.GetManifest(dstRepo, dstRef)
+	if errors.Is(err, ErrNotFound) {
+		result.addProblem("目标镜像不存在")
+		return result
+	}
+	if err != nil {
+		result.addProblem("获取目标 manifest 失败: %v", err)
+		return result
+	}
+	result.DestDigest = Digest(dstData)
+
+	if result.SourceDigest != result.DestDigest {
+		result.addProblem("manifest digest 不一致: 源 %s，目标 %s", result.SourceDigest, result.DestDigest)
+	}
+	verifyManifestContent(dst, dstRepo, dstType, dstData, rehash, result)
+	return result
+}
+
+// VerifyMigration 使用 HarborConfig 中的凭据校验一次迁移
+func VerifyMigration(source, dest HarborConfig, rehash bool) *VerifyResult {
+	result := VerifyImage(NewHTTPRegistryFromConfig(source), source.ImagePath, source.ImageTag,
+		NewHTTPRegistryFromConfig(dest), dest.ImagePath, dest.ImageTag, rehash)
+	result.Source = source.HarborHost + source.ImagePath + ":" + source.ImageTag
+	result.Dest = dest.HarborHost + dest.ImagePath + ":" + dest.ImageTag
+	return result
+}
+
+// verifyManifestContent 检查目标端 manifest 引用的内容是否完整
+func verifyManifestContent(dst Registry, repo, mediaType string, data []byte, rehash bool, result *VerifyResult) {
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		result.addProblem("解析 manifest 失败: %v", err)
+		return
+	}
+
+	if IsIndexMediaType(mediaType) {
+		for _, child := range manifest.Manifests {
+			childData, childType, err := dst.GetManifest(repo, child.Digest)
+			if err != nil {
+				result.addProblem("子 manifest %s 缺失: %v", child.Digest, err)
+				continue
+			}
+			if actual := Digest(childData); actual != child.Digest {
+				result.addProblem("子 manifest %s 内容不一致，实际 digest %s", child.Digest, actual)
+			}
+			verifyManifestContent(dst, repo, childType, childData, rehash, result)
+		}
+		return
+	}
+
+	blobs := manifest.Layers
+	if manifest.Config.Digest != "" {
+		blobs = append([]Descriptor{manifest.Config}, blobs...)
+	}
+	for _, desc := range blobs {
+		result.BlobsChecked++
+		if err := verifyBlob(dst, repo, desc, rehash); err != nil {
+			result.addProblem("blob %s: %v", desc.Digest, err)
+		}
+	}
+}
+
+// verifyBlob 检查单个 blob 的存在性、大小，以及可选的内容哈希
+func verifyBlob(dst Registry, repo string, desc Descriptor, rehash bool) error {
+	size, err := dst.StatBlob(repo, desc.Digest)
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("目标端不存在")
+	}
+	if err != nil {
+		return err
+	}
+	if size >= 0 && desc.Size > 0 && size != desc.Size {
+		return fmt.Errorf("大小不一致: 期望 %d，实际 %d", desc.Size, size)
+	}
+	if !rehash {
+		return nil
+	}
+
+	reader, err := dst.GetBlob(repo, desc.Digest)
+	if err != nil {
+		return fmt.Errorf("下载失败: %v", err)
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, reader)
+	if err != nil {
+		return fmt.Errorf("读取失败: %v", err)
+	}
+	if desc.Size > 0 && n != desc.Size {
+		return fmt.Errorf("内容大小不一致: 期望 %d，实际 %d", desc.Size, n)
+	}
+	if actual := "sha256:" + hex.EncodeToString(hash.Sum(nil)); actual != desc.Digest {
+		return fmt.Errorf("内容哈希不一致: 实际 %s", actual)
+	}
+	return nil
+}
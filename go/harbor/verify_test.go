@@ -0,0 +1,55 @@
+package harbor_test
+
+import (
+	"dockerImageMigrator/harbor"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyImage(t *testing.T) {
+	src := harbor.NewMemoryRegistry()
+	img := newTestImage(t, "layer-a", "layer-b")
+	img.push(t, src, "digital/dev/app", "v1")
+
+	dir := t.TempDir()
+	dst, err := harbor.NewOCILayout(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := harbor.CopyImage(src, "digital/dev/app", "v1", dst, "digital/dev/app", "v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	result := harbor.VerifyImage(src, "digital/dev/app", "v1", dst, "digital/dev/app", "v1", true)
+	if !result.OK() || result.BlobsChecked != 3 || result.SourceDigest != result.DestDigest {
+		t.Fatalf("期望校验通过: %+v", result)
+	}
+
+	if result := harbor.VerifyImage(src, "digital/dev/app", "v1", dst, "digital/dev/app", "v2", false); result.OK() {
+		t.Fatal("目标 tag 不存在时期望校验失败")
+	}
+
+	// 篡改一个层的内容但保持大小不变，只有 rehash 能发现
+	layerDigest := harbor.Digest(img.layers[0])
+	blobPath := filepath.Join(dir, "blobs", "sha256", strings.TrimPrefix(layerDigest, "sha256:"))
+	if err := os.WriteFile(blobPath, []byte("layer-x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if result := harbor.VerifyImage(src, "digital/dev/app", "v1", dst, "digital/dev/app", "v1", false); !result.OK() {
+		t.Fatalf("不重新计算哈希时不应发现篡改: %v", result.Problems)
+	}
+	if result := harbor.VerifyImage(src, "digital/dev/app", "v1", dst, "digital/dev/app", "v1", true); result.OK() {
+		t.Fatal("rehash 时期望发现内容被篡改")
+	}
+
+	// 删除一个层
+	if err := os.Remove(blobPath); err != nil {
+		t.Fatal(err)
+	}
+	result = harbor.VerifyImage(src, "digital/dev/app", "v1", dst, "digital/dev/app", "v1", false)
+	if result.OK() || len(result.Problems) != 1 {
+		t.Fatalf("期望报告一个缺失的 blob: %v", result.Problems)
+	}
+}
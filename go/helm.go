@@ -0,0 +1,182 @@
+package main
+
+import (
+	"dockerImageMigrator/diff"
+	"dockerImageMigrator/helm"
+	"dockerImageMigrator/log"
+	"dockerImageMigrator/workload"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stringList 可重复指定的字符串参数
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// helmChart 渲染 chart，迁移其中引用的镜像，并生成指向目标仓库的 values 覆盖文件或直接修改 values.yaml
+func helmChart(args []string) int {
+	fs := flag.NewFlagSet("helm", flag.ContinueOnError)
+	var valueFiles, sets stringList
+	fs.Var(&valueFiles, "f", "values 文件，可重复指定")
+	fs.Var(&sets, "set", "helm --set 参数，可重复指定")
+	release := fs.String("release", "release", "release 名称")
+	namespace := fs.String("n", "", "命名空间")
+	output := fs.String("o", "values-migrated.yaml", "values 覆盖文件的输出路径")
+	patch := fs.Bool("patch", false, "直接修改 chart 目录中的 values.yaml，而不是生成覆盖文件")
+	noMigrate := fs.Bool("no-migrate", false, "只生成改写结果，不迁移镜像")
+	helmBin := fs.String("helm", "helm", "helm 可执行文件")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: migrator helm [-f values.yaml]... [-set k=v]... [-o 覆盖文件 | -patch] [-no-migrate] <chart目录|chart.tgz>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	chart := fs.Arg(0)
+	if *patch && helm.IsArchive(chart) {
+		fmt.Fprintln(os.Stderr, "❌ -patch 只支持 chart 目录，.tgz 包请使用覆盖文件")
+		return exitUsage
+	}
+	startJournal("helm", args)
+
+	rendered, err := helm.Render(chart, helm.RenderOptions{
+		Helm:       *helmBin,
+		Release:    *release,
+		Namespace:  *namespace,
+		ValueFiles: valueFiles,
+		Set:        sets,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailed
+	}
+	renderedFile, err := workload.Parse(rendered)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 解析渲染结果失败: %v\n", err)
+		return exitFailed
+	}
+
+	// 迁移渲染结果中引用的每个镜像
+	failed := 0
+	resolved := make(map[string]*resolvedImage)
+	for _, field := range renderedFile.AllImages(imagePathRules) {
+		// chart 中常用 Docker Hub 简写，与 values 中的镜像一样补全后再匹配
+		image := workload.NormalizeImage(field.Value)
+		if _, ok := resolved[image]; ok {
+			continue
+		}
+		r, ok := resolveImage(image, !*noMigrate)
+		if !ok {
+			failed++
+		}
+		if r != nil {
+			resolved[image] = r
+		}
+	}
+
+	// 在 chart 默认 values 与用户指定的 values 中查找镜像配置
+	appVersion, err := helm.AppVersion(chart)
+	if err != nil {
+		log.Errorf("读取 appVersion 失败，未指定 tag 的镜像将无法匹配: %v", err)
+	}
+	defaults, err := helm.ReadFile(chart, "values.yaml")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailed
+	}
+	valuesFile, err := workload.Parse(defaults)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 解析 values.yaml 失败: %v\n", err)
+		return exitFailed
+	}
+	var images []*helm.ValueImage
+	for _, doc := range valuesFile.Docs {
+		images = append(images, helm.FindImages(doc, appVersion)...)
+	}
+	if !*patch {
+		for _, file := range valueFiles {
+			userValues, err := workload.ReadFile(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %s: %v\n", file, err)
+				return exitFailed
+			}
+			for _, doc := range userValues.Docs {
+				images = append(images, helm.FindImages(doc, appVersion)...)
+			}
+		}
+	}
+
+	replacements := make(map[*helm.ValueImage]helm.Replacement)
+	matched := make(map[string]bool)
+	for _, image := range images {
+		r, ok := resolved[image.Image]
+		if !ok {
+			continue
+		}
+		matched[image.Image] = true
+		replacements[image] = helm.Replacement{
+			Host:       r.dest.HarborHost,
+			Repository: strings.TrimPrefix(r.dest.ImagePath, "/"),
+			Tag:        r.dest.ImageTag,
+			Digest:     r.digest,
+		}
+	}
+	for image := range resolved {
+		if !matched[image] {
+			log.Errorf("镜像 %s 未在 values 中找到对应的 image 配置，需要手动修改", image)
+			failed++
+		}
+	}
+
+	if *patch {
+		for _, image := range images {
+			if r, ok := replacements[image]; ok {
+				if err := image.Apply(valuesFile, r); err != nil {
+					log.Errorf("%v", err)
+					failed++
+				}
+			}
+		}
+		data, err := valuesFile.Bytes()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitFailed
+		}
+		path := filepath.Join(chart, "values.yaml")
+		fmt.Print(diff.Unified(path, path, defaults, data))
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ 写入 %s 失败: %v\n", path, err)
+			return exitFailed
+		}
+	} else {
+		data, err := helm.Override(images, replacements)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitFailed
+		}
+		if err := os.WriteFile(*output, data, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ 写入 %s 失败: %v\n", *output, err)
+			return exitFailed
+		}
+		fmt.Printf("已生成 values 覆盖文件 %s，部署时追加 -f %s\n", *output, *output)
+	}
+
+	fmt.Printf("\n共 %d 个镜像，失败 %d\n", len(resolved), failed)
+	if failed > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
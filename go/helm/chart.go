@@ -0,0 +1,115 @@
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// RenderOptions helm template 的参数
+type RenderOptions struct {
+	Helm       string   // helm 可执行文件，默认从 PATH 中查找
+	Release    string   // release 名称
+	Namespace  string   // 命名空间
+	ValueFiles []string // -f 指定的 values 文件
+	Set        []string // --set 指定的值
+}
+
+// Render 调用 helm template 在本地渲染 chart（目录或 .tgz），返回渲染出的 yaml
+func Render(chart string, opts RenderOptions) ([]byte, error) {
+	helm := opts.Helm
+	if helm == "" {
+		helm = "helm"
+	}
+	release := opts.Release
+	if release == "" {
+		release = "release"
+	}
+
+	args := []string{"template", release, chart}
+	if opts.Namespace != "" {
+		args = append(args, "--namespace", opts.Namespace)
+	}
+	for _, file := range opts.ValueFiles {
+		args = append(args, "-f", file)
+	}
+	for _, value := range opts.Set {
+		args = append(args, "--set", value)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(helm, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("渲染 chart %s 失败: %v: %s", chart, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// IsArchive 判断 chart 是否为 .tgz 包
+func IsArchive(chart string) bool {
+	return strings.HasSuffix(chart, ".tgz") || strings.HasSuffix(chart, ".tar.gz")
+}
+
+// ReadFile 读取 chart 根目录下的文件，chart 可以是目录或 .tgz 包
+func ReadFile(chart, name string) ([]byte, error) {
+	if !IsArchive(chart) {
+		data, err := os.ReadFile(filepath.Join(chart, name))
+		if err != nil {
+			return nil, fmt.Errorf("读取 chart 文件失败: %v", err)
+		}
+		return data, nil
+	}
+
+	file, err := os.Open(chart)
+	if err != nil {
+		return nil, fmt.Errorf("打开 chart 包失败: %v", err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("解压 chart 包失败: %v", err)
+	}
+	defer gz.Close()
+
+	// chart 包中的文件都在 <chart名>/ 目录下
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取 chart 包失败: %v", err)
+		}
+		parts := strings.SplitN(strings.TrimPrefix(header.Name, "./"), "/", 2)
+		if len(parts) == 2 && parts[1] == name {
+			return io.ReadAll(tr)
+		}
+	}
+	return nil, fmt.Errorf("chart 包 %s 中没有 %s", chart, name)
+}
+
+// AppVersion 返回 Chart.yaml 中的 appVersion，镜像未指定 tag 时 chart 通常以它为默认值
+func AppVersion(chart string) (string, error) {
+	data, err := ReadFile(chart, "Chart.yaml")
+	if err != nil {
+		return "", err
+	}
+	var meta struct {
+		AppVersion string `yaml:"appVersion"`
+	}
+	if err := yaml.Unmarshal(data, &meta); err != nil {
+		return "", fmt.Errorf("解析 Chart.yaml 失败: %v", err)
+	}
+	return meta.AppVersion, nil
+}
@@ -0,0 +1,216 @@
+package helm
+
+import (
+	"bytes"
+	"dockerImageMigrator/workload"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"strings"
+)
+
+// ValueImage values 中按常见约定描述的一个镜像：
+// 含 registry/repository/tag/digest 字段的映射，或值为完整镜像地址的 image 字段
+type ValueImage struct {
+	Keys  []string // 在 values 中的路径
+	Image string   // 按约定拼出的完整镜像地址
+
+	registry, repository, tag, digest *yaml.Node
+	scalar                            *yaml.Node
+}
+
+// Path 返回 . 分隔的路径
+func (v *ValueImage) Path() string {
+	return strings.Join(v.Keys, ".")
+}
+
+// Replacement 镜像在目标仓库中的位置
+type Replacement struct {
+	Host       string // 目标仓库地址，如 harbor.local
+	Repository string // 不带前导 / 的仓库路径
+	Tag        string
+	Digest     string // 按规则固定 digest 时非空
+}
+
+// Image 返回完整的镜像地址
+func (r Replacement) Image() string {
+	if r.Digest != "" {
+		return r.Host + "/" + r.Repository + "@" + r.Digest
+	}
+	return r.Host + "/" + r.Repository + ":" + r.Tag
+}
+
+// FindImages 在 values 文档中查找镜像配置，appVersion 为未指定 tag 时的默认值
+func FindImages(values *yaml.Node, appVersion string) []*ValueImage {
+	var result []*ValueImage
+	if values.Kind == yaml.DocumentNode {
+		if len(values.Content) == 0 {
+			return nil
+		}
+		values = values.Content[0]
+	}
+	findImages(values, nil, appVersion, &result)
+	return result
+}
+
+func findImages(node *yaml.Node, keys []string, appVersion string, result *[]*ValueImage) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+
+	if repository := workload.Get(node, "repository"); repository != nil && repository.Kind == yaml.ScalarNode && repository.Value != "" {
+		image := &ValueImage{
+			Keys:       keys,
+			registry:   scalar(workload.Get(node, "registry")),
+			repository: repository,
+			tag:        scalar(workload.Get(node, "tag")),
+			digest:     scalar(workload.Get(node, "digest")),
+		}
+		image.Image = workload.NormalizeImage(image.compose(appVersion))
+		*result = append(*result, image)
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		value := node.Content[i+1]
+		childKeys := append(append([]string(nil), keys...), key)
+		if value.Kind == yaml.ScalarNode {
+			if isImageKey(key) && strings.Contains(value.Value, "/") {
+				*result = append(*result, &ValueImage{Keys: childKeys, Image: workload.NormalizeImage(value.Value), scalar: value})
+			}
+			continue
+		}
+		findImages(value, childKeys, appVersion, result)
+	}
+}
+
+// isImageKey 判断字段名是否为镜像，如 image、sidecarImage
+func isImageKey(key string) bool {
+	return key == "image" || strings.HasSuffix(key, "Image")
+}
+
+func scalar(node *yaml.Node) *yaml.Node {
+	if node != nil && node.Kind == yaml.ScalarNode {
+		return node
+	}
+	return nil
+}
+
+// compose 按 [registry/]repository[:tag][@digest] 拼出镜像地址
+func (v *ValueImage) compose(appVersion string) string {
+	image := v.repository.Value
+	if v.registry != nil && v.registry.Value != "" {
+		image = strings.TrimSuffix(v.registry.Value, "/") + "/" + image
+	}
+	tag := appVersion
+	if v.tag != nil && v.tag.Value != "" {
+		tag = v.tag.Value
+	}
+	if tag != "" {
+		image += ":" + tag
+	}
+	if v.digest != nil && v.digest.Value != "" {
+		image += "@" + v.digest.Value
+	}
+	return image
+}
+
+// fields 返回覆盖该镜像所需的字段
+func (v *ValueImage) fields(r Replacement) [][2]string {
+	if v.scalar != nil {
+		return [][2]string{{v.Keys[len(v.Keys)-1], r.Image()}}
+	}
+
+	var fields [][2]string
+	if v.registry != nil {
+		fields = append(fields, [2]string{"registry", r.Host}, [2]string{"repository", r.Repository})
+	} else {
+		fields = append(fields, [2]string{"repository", r.Host + "/" + r.Repository})
+	}
+	fields = append(fields, [2]string{"tag", r.Tag})
+	if r.Digest != "" && v.digest != nil {
+		fields = append(fields, [2]string{"digest", r.Digest})
+	}
+	return fields
+}
+
+// Apply 在 values 文件中原地修改该镜像，file 必须是 FindImages 所用文档所在的文件
+func (v *ValueImage) Apply(file *workload.File, r Replacement) error {
+	if v.scalar != nil {
+		file.Set(v.scalar, r.Image())
+		return nil
+	}
+	if v.tag == nil && r.Digest == "" {
+		return fmt.Errorf("%s 缺少 tag 字段，无法原地修改，请使用覆盖文件", v.Path())
+	}
+
+	if v.registry != nil {
+		file.Set(v.registry, r.Host)
+		file.Set(v.repository, r.Repository)
+	} else {
+		file.Set(v.repository, r.Host+"/"+r.Repository)
+	}
+	if v.tag != nil {
+		file.Set(v.tag, r.Tag)
+	}
+	if r.Digest != "" && v.digest != nil {
+		file.Set(v.digest, r.Digest)
+	}
+	return nil
+}
+
+// Override 生成 values 覆盖文件，按 images 的顺序输出
+func Override(images []*ValueImage, replacements map[*ValueImage]Replacement) ([]byte, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	for _, image := range images {
+		r, ok := replacements[image]
+		if !ok {
+			continue
+		}
+		parent := root
+		keys := image.Keys
+		if image.scalar != nil {
+			keys = keys[:len(keys)-1]
+		}
+		for _, key := range keys {
+			parent = child(parent, key)
+		}
+		for _, field := range image.fields(r) {
+			setScalar(parent, field[0], field[1])
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return nil, fmt.Errorf("序列化 values 覆盖文件失败: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("序列化 values 覆盖文件失败: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// child 返回映射中 key 对应的映射节点，不存在时创建
+func child(node *yaml.Node, key string) *yaml.Node {
+	if value := workload.Get(node, key); value != nil && value.Kind == yaml.MappingNode {
+		return value
+	}
+	value := &yaml.Node{Kind: yaml.MappingNode}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	return value
+}
+
+// setScalar 设置字符串字段，数字形式的 tag 会加引号，避免被 helm 解析为数字
+func setScalar(node *yaml.Node, key, value string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+			return
+		}
+	}
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+}
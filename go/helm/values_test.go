@@ -0,0 +1,171 @@
+package helm
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"dockerImageMigrator/workload"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const values = `# 默认 values
+image:
+  registry: registry.local
+  repository: demo/app
+  tag: "1.0"   # 版本
+  pullPolicy: IfNotPresent
+sidecar:
+  image:
+    repository: registry.local/demo/sidecar
+initImage: registry.local/demo/init:2
+replicaCount: 1
+`
+
+func parseValues(t *testing.T) (*workload.File, []*ValueImage) {
+	t.Helper()
+	f, err := workload.Parse([]byte(values))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, FindImages(f.Docs[0], "3.1")
+}
+
+func TestFindImages(t *testing.T) {
+	_, images := parseValues(t)
+	want := map[string]string{
+		"image":         "registry.local/demo/app:1.0",
+		"sidecar.image": "registry.local/demo/sidecar:3.1",
+		"initImage":     "registry.local/demo/init:2",
+	}
+	if len(images) != len(want) {
+		t.Fatalf("期望 %d 个镜像，得到 %d", len(want), len(images))
+	}
+	for _, image := range images {
+		if want[image.Path()] != image.Image {
+			t.Errorf("%s: 得到 %s，期望 %s", image.Path(), image.Image, want[image.Path()])
+		}
+	}
+}
+
+func TestFindImagesDockerHubShortNames(t *testing.T) {
+	const chart = `image:
+  repository: nginx
+  tag: "1.25"
+metrics:
+  image:
+    repository: bitnami/nginx-exporter
+    tag: 0.11.0
+proxy:
+  image:
+    registry: docker.io
+    repository: envoyproxy/envoy
+    tag: v1.29.0
+sidecarImage: busybox/busybox:1.36
+`
+	f, err := workload.Parse([]byte(chart))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"image":         "registry-1.docker.io/library/nginx:1.25",
+		"metrics.image": "registry-1.docker.io/bitnami/nginx-exporter:0.11.0",
+		"proxy.image":   "registry-1.docker.io/envoyproxy/envoy:v1.29.0",
+		"sidecarImage":  "registry-1.docker.io/busybox/busybox:1.36",
+	}
+	images := FindImages(f.Docs[0], "")
+	if len(images) != len(want) {
+		t.Fatalf("期望 %d 个镜像，得到 %d", len(want), len(images))
+	}
+	for _, image := range images {
+		if want[image.Path()] != image.Image {
+			t.Errorf("%s: 得到 %s，期望 %s", image.Path(), image.Image, want[image.Path()])
+		}
+	}
+}
+
+func TestOverride(t *testing.T) {
+	_, images := parseValues(t)
+	replacements := make(map[*ValueImage]Replacement)
+	for _, image := range images {
+		replacements[image] = Replacement{Host: "harbor.local", Repository: "lib/" + image.Path(), Tag: "1.0"}
+	}
+
+	data, err := Override(images, replacements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `image:
+  registry: harbor.local
+  repository: lib/image
+  tag: "1.0"
+sidecar:
+  image:
+    repository: harbor.local/lib/sidecar.image
+    tag: "1.0"
+initImage: harbor.local/lib/initImage:1.0
+`
+	if string(data) != want {
+		t.Fatalf("覆盖文件不正确:\n%s", data)
+	}
+}
+
+func TestApply(t *testing.T) {
+	f, images := parseValues(t)
+	r := Replacement{Host: "harbor.local", Repository: "lib/app", Tag: "1.0"}
+	if err := images[0].Apply(f, r); err != nil {
+		t.Fatal(err)
+	}
+	// sidecar 没有 tag 字段，无法原地修改
+	if err := images[1].Apply(f, r); err == nil {
+		t.Fatal("缺少 tag 字段时应返回错误")
+	}
+	if err := images[2].Apply(f, r); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.NewReplacer(
+		"registry: registry.local", "registry: harbor.local",
+		"repository: demo/app", "repository: lib/app",
+		"initImage: registry.local/demo/init:2", "initImage: harbor.local/lib/app:1.0",
+	).Replace(values)
+	if string(data) != want {
+		t.Fatalf("values.yaml 不正确:\n%s", data)
+	}
+}
+
+func TestReadFileFromArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "demo-0.1.0.tgz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	for name, content := range map[string]string{
+		"demo/Chart.yaml":  "name: demo\nappVersion: \"3.1\"\n",
+		"demo/values.yaml": values,
+	} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+	file.Close()
+
+	data, err := ReadFile(path, "values.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != values {
+		t.Fatalf("values.yaml 内容不正确: %s", data)
+	}
+	if version, err := AppVersion(path); err != nil || version != "3.1" {
+		t.Fatalf("appVersion 不正确: %q, %v", version, err)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"dockerImageMigrator/log"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// interactive 交互模式：逐行读取拖拽进来的 yaml 文件并部署，输入 exit 退出
+func interactive(args []string) int {
+	opts := newDeployOptions()
+	fs := flag.NewFlagSet("interactive", flag.ContinueOnError)
+	fs.BoolVar(&opts.assumeYes, "yes", false, "跳过 apply 前的 diff 确认")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: migrator interactive [-yes]")
+		fmt.Fprintln(fs.Output(), "逐行输入 yaml 文件路径，多个路径以空格分隔，含空格的路径用引号括起或以 \\ 转义")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if err := setupKube(false, cfg.Kubernetes.Kubeconfig, cfg.Kubernetes.Context); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+
+	const promptMessage = ">>> 请拖拽k8s yaml文件进来"
+
+	fmt.Println(promptMessage)
+	// 与 apply 前的确认共用标准输入，终端上每次读取一行，确认时不会丢失输入
+	scanner := bufio.NewScanner(stdinReader)
+
+	failed := 0
+	for scanner.Scan() {
+		input := scanner.Text()
+
+		if strings.ToLower(strings.TrimSpace(input)) == "exit" {
+			break
+		}
+
+		// 处理所有输入的文件
+		for _, path := range splitPaths(input) {
+			result := deploy(path, opts)
+			printMovedSecrets(os.Stdout, result.Secrets)
+			printObjectResults(os.Stdout, result.Objects)
+			printRollouts(os.Stdout, result.Rollouts)
+			printRolledBack(os.Stdout, result.RolledBack)
+			if result.OK {
+				fmt.Printf("👌 %s 部署结束\n\n\n", path)
+			} else {
+				failed++
+				fmt.Printf("❌ %s 部署失败: %s\n\n\n", path, result.Error)
+			}
+		}
+
+		fmt.Println(promptMessage)
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Infof("读取输入错误: %v\n", err)
+		return exitFailed
+	}
+	if failed > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// splitPaths 拆分一行中拖拽进来的多个路径。
+// 终端拖拽时含空格的路径会被引号括起（Windows、GNOME）或以反斜杠转义空格（macOS），
+// 反斜杠只在转义空白与引号时生效，Windows 路径中的分隔符保持不变
+func splitPaths(input string) []string {
+	var paths []string
+	var current strings.Builder
+	inPath := false
+	var quote rune
+
+	runes := []rune(input)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inPath = true
+		case r == '\\' && i+1 < len(runes) && strings.ContainsRune(" \t'\"", runes[i+1]):
+			i++
+			current.WriteRune(runes[i])
+			inPath = true
+		case r == ' ' || r == '\t':
+			if inPath {
+				paths = append(paths, current.String())
+				current.Reset()
+				inPath = false
+			}
+		default:
+			current.WriteRune(r)
+			inPath = true
+		}
+	}
+	if inPath {
+		paths = append(paths, current.String())
+	}
+	return paths
+}
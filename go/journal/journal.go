@@ -0,0 +1,325 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"dockerImageMigrator/harbor"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// State 镜像或 blob 的迁移状态
+type State string
+
+const (
+	Planned      State = "planned"
+	Transferring State = harbor.BlobTransferring
+	Done         State = harbor.BlobDone
+	Failed       State = harbor.BlobFailed
+)
+
+// 日志条目的类型
+const (
+	kindRun    = "run"    // 开始一次运行，记录子命令与参数
+	kindResume = "resume" // 恢复之前的运行
+	kindFinish = "finish" // 运行结束，记录退出码
+	kindImage  = "image"
+	kindBlob   = "blob"
+)
+
+// Entry 日志中的一行
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Run      string    `json:"run"`
+	Kind     string    `json:"kind"`
+	Args     []string  `json:"args,omitempty"`
+	Dir      string    `json:"dir,omitempty"` // 运行时的工作目录，恢复时参数中的相对路径以此为准
+	ExitCode int       `json:"exitCode,omitempty"`
+	Image    string    `json:"image,omitempty"`    // 源镜像地址
+	Registry string    `json:"registry,omitempty"` // blob 所在的目标仓库地址
+	Dest     string    `json:"dest,omitempty"`     // 目标镜像地址或 blob 所在的目标仓库路径
+	Digest   string    `json:"digest,omitempty"`
+	Size     int64     `json:"size,omitempty"`
+	State    State     `json:"state,omitempty"`
+	Upload   string    `json:"upload,omitempty"` // 未完成的上传会话地址
+	Offset   int64     `json:"offset,omitempty"` // 上传会话已确认的字节数
+	Error    string    `json:"error,omitempty"`
+}
+
+// Run 日志中记录的一次运行
+type Run struct {
+	ID       string
+	Args     []string
+	Dir      string
+	Started  time.Time
+	Finished bool
+	ExitCode int
+	Images   map[string]State // 源镜像 -> 本次运行中的最新状态
+}
+
+// Unfinished 判断运行是否需要恢复：进程中断没有结束记录，或结束时有失败
+func (r *Run) Unfinished() bool {
+	return !r.Finished || r.ExitCode != 0
+}
+
+// Counts 按状态统计镜像数
+func (r *Run) Counts() map[State]int {
+	counts := make(map[State]int)
+	for _, state := range r.Images {
+		counts[state]++
+	}
+	return counts
+}
+
+// Journal 追加写入的迁移日志（JSON lines），每行写入后立即同步到磁盘，
+// 进程在任意位置中断后都能从日志恢复镜像与 blob 的状态
+type Journal struct {
+	Path string
+
+	mu     sync.Mutex
+	file   *os.File
+	run    string
+	runs   []*Run
+	images map[string]State  // 运行|源镜像|目标镜像 -> 最新状态
+	blobs  map[string]*Entry // 运行|目标仓库|路径|digest -> 最新条目
+}
+
+// DefaultPath 返回 MIGRATOR_JOURNAL 或 ~/.migrator/journal.jsonl
+func DefaultPath() string {
+	if path := os.Getenv("MIGRATOR_JOURNAL"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "journal.jsonl"
+	}
+	return filepath.Join(home, ".migrator", "journal.jsonl")
+}
+
+// Open 读取已有的日志并以追加方式打开，文件不存在时创建
+func Open(path string) (*Journal, error) {
+	j := &Journal{Path: path, images: make(map[string]State), blobs: make(map[string]*Entry)}
+
+	if data, err := os.ReadFile(path); err == nil {
+		j.replay(data)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取迁移日志失败: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("创建迁移日志目录失败: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("打开迁移日志失败: %v", err)
+	}
+	j.file = file
+	return j, nil
+}
+
+// replay 按顺序重放日志，进程中断时写了一半的最后一行会被忽略
+func (j *Journal) replay(data []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		j.apply(&entry)
+	}
+}
+
+// apply 将一条记录合并到内存中的状态
+func (j *Journal) apply(entry *Entry) {
+	switch entry.Kind {
+	case kindRun:
+		j.runs = append(j.runs, &Run{ID: entry.Run, Args: entry.Args, Dir: entry.Dir, Started: entry.Time, Images: make(map[string]State)})
+	case kindResume:
+		if run := j.find(entry.Run); run != nil {
+			run.Finished = false
+		}
+	case kindFinish:
+		if run := j.find(entry.Run); run != nil {
+			run.Finished = true
+			run.ExitCode = entry.ExitCode
+		}
+	case kindImage:
+		j.images[imageKey(entry.Run, entry.Image, entry.Dest)] = entry.State
+		if run := j.find(entry.Run); run != nil {
+			run.Images[entry.Image] = entry.State
+		}
+	case kindBlob:
+		key := blobKey(entry.Run, entry.Registry, entry.Dest, entry.Digest)
+		// 上传失败时保留之前的会话，下次从已确认的位置续传
+		if previous := j.blobs[key]; previous != nil && entry.State == Failed && entry.Upload == "" {
+			entry.Upload, entry.Offset = previous.Upload, previous.Offset
+		}
+		j.blobs[key] = entry
+	}
+}
+
+func (j *Journal) find(id string) *Run {
+	for i := len(j.runs) - 1; i >= 0; i-- {
+		if j.runs[i].ID == id {
+			return j.runs[i]
+		}
+	}
+	return nil
+}
+
+func imageKey(run, image, dest string) string {
+	return run + "|" + image + "|" + dest
+}
+
+func blobKey(run, registry, repo, digest string) string {
+	return run + "|" + registry + "|" + strings.Trim(repo, "/") + "|" + digest
+}
+
+// record 写入一条记录并同步到磁盘
+func (j *Journal) record(entry Entry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry.Time = time.Now()
+	if entry.Run == "" {
+		entry.Run = j.run
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("序列化迁移日志失败: %v", err)
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("写入迁移日志失败: %v", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("写入迁移日志失败: %v", err)
+	}
+	j.apply(&entry)
+	return nil
+}
+
+// Start 开始一次新的运行，args 为子命令及其参数，dir 为工作目录
+func (j *Journal) Start(args []string, dir string) (string, error) {
+	id := time.Now().Format("20060102150405.000000")
+	if err := j.record(Entry{Run: id, Kind: kindRun, Args: args, Dir: dir}); err != nil {
+		return "", err
+	}
+	j.mu.Lock()
+	j.run = id
+	j.mu.Unlock()
+	return id, nil
+}
+
+// Resume 继续之前的运行，之后的记录都归入该运行
+func (j *Journal) Resume(id string) error {
+	if err := j.record(Entry{Run: id, Kind: kindResume}); err != nil {
+		return err
+	}
+	j.mu.Lock()
+	j.run = id
+	j.mu.Unlock()
+	return nil
+}
+
+// Finish 记录当前运行结束
+func (j *Journal) Finish(exitCode int) error {
+	return j.record(Entry{Kind: kindFinish, ExitCode: exitCode})
+}
+
+// Close 关闭日志文件
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// Runs 返回日志中的全部运行，按开始时间排序
+func (j *Journal) Runs() []*Run {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]*Run(nil), j.runs...)
+}
+
+// LastUnfinished 返回最近一次需要恢复的运行，没有时返回 nil
+func (j *Journal) LastUnfinished() *Run {
+	runs := j.Runs()
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].Unfinished() {
+			return runs[i]
+		}
+	}
+	return nil
+}
+
+// Find 按 ID 查找运行
+func (j *Journal) Find(id string) *Run {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.find(id)
+}
+
+// ImageState 返回当前运行中源镜像迁移到目标镜像的最新状态，没有记录时返回空。
+// 状态只在同一次运行内有效，新的运行总是重新检查目标仓库
+func (j *Journal) ImageState(image, dest string) State {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.images[imageKey(j.run, image, dest)]
+}
+
+// RecordImage 记录镜像状态
+func (j *Journal) RecordImage(image, dest string, state State, err error) error {
+	entry := Entry{Kind: kindImage, Image: image, Dest: dest, State: state}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	return j.record(entry)
+}
+
+// Blobs 返回记录目标仓库 registry 中 blob 状态的 harbor.BlobJournal
+func (j *Journal) Blobs(registry string) harbor.BlobJournal {
+	return &blobJournal{journal: j, registry: strings.TrimRight(registry, "/")}
+}
+
+// blobJournal 限定在一个目标仓库上的 blob 日志
+type blobJournal struct {
+	journal  *Journal
+	registry string
+}
+
+func (b *blobJournal) entry(repo, digest string) *Entry {
+	b.journal.mu.Lock()
+	defer b.journal.mu.Unlock()
+	return b.journal.blobs[blobKey(b.journal.run, b.registry, repo, digest)]
+}
+
+// BlobDone 返回 blob 是否已确认写入目标仓库
+func (b *blobJournal) BlobDone(repo, digest string) bool {
+	entry := b.entry(repo, digest)
+	return entry != nil && entry.State == Done
+}
+
+// BlobSession 返回 blob 未完成的上传会话
+func (b *blobJournal) BlobSession(repo, digest string) *harbor.UploadSession {
+	entry := b.entry(repo, digest)
+	if entry == nil || entry.State == Done || entry.Upload == "" {
+		return nil
+	}
+	return &harbor.UploadSession{Location: entry.Upload, Offset: entry.Offset}
+}
+
+// RecordBlob 记录 blob 状态，写入日志失败只影响续传，不中断迁移
+func (b *blobJournal) RecordBlob(repo, digest string, size int64, state string, session *harbor.UploadSession, err error) {
+	entry := Entry{Kind: kindBlob, Registry: b.registry, Dest: strings.Trim(repo, "/"), Digest: digest, Size: size, State: State(state)}
+	if session != nil {
+		entry.Upload = session.Location
+		entry.Offset = session.Offset
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	b.journal.record(entry)
+}
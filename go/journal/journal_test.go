@@ -0,0 +1,84 @@
+package journal
+
+import (
+	"dockerImageMigrator/harbor"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := j.Start([]string{"migrate", "image.cestc.cn/x/app:1.0"}, "/work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.RecordImage("image.cestc.cn/x/app:1.0", "harbor.local/x/app:1.0", Transferring, nil)
+	blobs := j.Blobs("https://harbor.local/")
+	blobs.RecordBlob("/x/app", "sha256:aaa", 10, harbor.BlobDone, nil, nil)
+	blobs.RecordBlob("/x/app", "sha256:bbb", 20, harbor.BlobTransferring, &harbor.UploadSession{Location: "/v2/x/app/blobs/uploads/1", Offset: 8}, nil)
+	j.Close()
+
+	// 模拟进程在写入一行时中断
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"time":"2024-01-01T00:00:00Z","run":"` + id + `","kind":"blob","dig`)
+	file.Close()
+
+	j, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	run := j.LastUnfinished()
+	if run == nil || run.ID != id || len(run.Args) != 2 || run.Dir != "/work" {
+		t.Fatalf("期望找到未完成的运行: %+v", run)
+	}
+	if err := j.Resume(id); err != nil {
+		t.Fatal(err)
+	}
+	if state := j.ImageState("image.cestc.cn/x/app:1.0", "harbor.local/x/app:1.0"); state != Transferring {
+		t.Fatalf("镜像状态不正确: %s", state)
+	}
+
+	blobs = j.Blobs("https://harbor.local")
+	if !blobs.BlobDone("x/app", "sha256:aaa") || blobs.BlobDone("x/app", "sha256:bbb") {
+		t.Fatal("blob 完成状态不正确")
+	}
+	if session := blobs.BlobSession("x/app", "sha256:bbb"); session == nil || session.Offset != 8 {
+		t.Fatalf("期望恢复上传会话: %+v", session)
+	}
+
+	// 失败时保留会话，下次继续续传
+	blobs.RecordBlob("x/app", "sha256:bbb", 20, harbor.BlobFailed, nil, errors.New("timeout"))
+	if session := blobs.BlobSession("x/app", "sha256:bbb"); session == nil || session.Offset != 8 {
+		t.Fatalf("失败后应保留上传会话: %+v", session)
+	}
+
+	blobs.RecordBlob("x/app", "sha256:bbb", 20, harbor.BlobDone, nil, nil)
+	j.RecordImage("image.cestc.cn/x/app:1.0", "harbor.local/x/app:1.0", Done, nil)
+	if err := j.Finish(0); err != nil {
+		t.Fatal(err)
+	}
+	if run := j.LastUnfinished(); run != nil {
+		t.Fatalf("运行已完成，不应再需要恢复: %+v", run)
+	}
+	if counts := j.Find(id).Counts(); counts[Done] != 1 {
+		t.Fatalf("镜像统计不正确: %v", counts)
+	}
+
+	// 新的运行不沿用之前的状态
+	if _, err := j.Start([]string{"migrate"}, "/work"); err != nil {
+		t.Fatal(err)
+	}
+	if j.ImageState("image.cestc.cn/x/app:1.0", "harbor.local/x/app:1.0") != "" || blobs.BlobDone("x/app", "sha256:aaa") {
+		t.Fatal("新的运行不应沿用之前运行的状态")
+	}
+}
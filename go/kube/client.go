@@ -0,0 +1,341 @@
+package kube
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FieldManager server-side apply 使用的字段管理者名称
+const FieldManager = "migrator"
+
+// ErrNotFound 对象或资源类型不存在
+var ErrNotFound = errors.New("对象不存在")
+
+// UnknownKindError 集群中没有 apiVersion 下的 kind，如 CRD 尚未创建
+type UnknownKindError struct {
+	APIVersion string
+	Kind       string
+}
+
+func (e *UnknownKindError) Error() string {
+	return fmt.Sprintf("集群不支持 %s/%s", e.APIVersion, e.Kind)
+}
+
+// Action 单个对象的 apply 结果
+type Action string
+
+const (
+	Created    Action = "created"
+	Configured Action = "configured"
+	Unchanged  Action = "unchanged"
+	Failed     Action = "error"
+)
+
+// Result 单个对象的 apply 结果
+type Result struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	Action     Action `json:"action"`
+	Error      string `json:"error,omitempty"`
+	Conflict   bool   `json:"conflict,omitempty"` // 与其他字段管理者冲突而未 apply
+}
+
+// String 按 kubectl apply 的格式显示，如 deployment.apps/web configured
+func (r Result) String() string {
+	name := ObjectRef{APIVersion: r.APIVersion, Kind: r.Kind, Namespace: r.Namespace, Name: r.Name}.String()
+	if r.Error != "" {
+		return name + " " + string(r.Action) + ": " + r.Error
+	}
+	return name + " " + string(r.Action)
+}
+
+// Resource API 资源类型
+type Resource struct {
+	Name       string `json:"name"` // 复数形式的资源名，如 deployments
+	Namespaced bool   `json:"namespaced"`
+	Kind       string `json:"kind"`
+}
+
+// Client 直接访问 Kubernetes API 的客户端
+type Client struct {
+	Server    string
+	Context   string
+	Namespace string // 对象未指定命名空间时使用
+
+	http     *http.Client
+	token    string
+	username string
+	password string
+
+	mu        sync.Mutex
+	resources map[string][]Resource // groupVersion -> 资源列表
+}
+
+// NewClient 按 kubeconfig 中的连接参数创建客户端
+func NewClient(config *Config) *Client {
+	return &Client{
+		Server:    config.Server,
+		Context:   config.Context,
+		Namespace: config.Namespace,
+		http: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: config.TLS, Proxy: http.ProxyFromEnvironment},
+		},
+		token:     config.Token,
+		username:  config.Username,
+		password:  config.Password,
+		resources: make(map[string][]Resource),
+	}
+}
+
+// statusError API 返回的 Status 对象
+type statusError struct {
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+}
+
+// do 发送请求并读取响应，返回状态码与响应内容
+func (c *Client) do(method, path, contentType string, body []byte) (int, []byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.Server+path, reader)
+	if err != nil {
+		return 0, nil, fmt.Errorf("创建 %s 请求失败: %v", method, err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("请求 Kubernetes API 失败: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("读取 Kubernetes API 响应失败: %v", err)
+	}
+	return resp.StatusCode, data, nil
+}
+
+// apiError 将非 2xx 响应转换为错误，优先使用 Status 中的 message
+func apiError(status int, body []byte) error {
+	if status == http.StatusNotFound {
+		return ErrNotFound
+	}
+	var s statusError
+	if json.Unmarshal(body, &s) == nil && s.Message != "" {
+		return fmt.Errorf("%s (状态码 %d)", s.Message, status)
+	}
+	return fmt.Errorf("状态码 %d - %s", status, strings.TrimSpace(string(body)))
+}
+
+// Resource 通过 discovery 查找 apiVersion 下 kind 对应的资源，结果按 groupVersion 缓存。
+// 缓存中找不到时重新查询，同一次部署中先 apply 的 CRD 定义的类型也能找到
+func (c *Client) Resource(apiVersion, kind string) (*Resource, error) {
+	c.mu.Lock()
+	resources := c.resources[apiVersion]
+	c.mu.Unlock()
+	if resource := findResource(resources, kind); resource != nil {
+		return resource, nil
+	}
+
+	resources, err := c.discover(apiVersion)
+	if err != nil {
+		return nil, err
+	}
+	if resource := findResource(resources, kind); resource != nil {
+		return resource, nil
+	}
+	return nil, &UnknownKindError{APIVersion: apiVersion, Kind: kind}
+}
+
+func findResource(resources []Resource, kind string) *Resource {
+	for i := range resources {
+		if resources[i].Kind == kind {
+			return &resources[i]
+		}
+	}
+	return nil
+}
+
+// discover 查询 groupVersion 下的资源列表并更新缓存，groupVersion 不存在时返回空列表
+func (c *Client) discover(apiVersion string) ([]Resource, error) {
+	status, body, err := c.do("GET", groupVersionPath(apiVersion), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	var resources []Resource
+	if status != http.StatusOK {
+		if err := apiError(status, body); err != ErrNotFound {
+			return nil, fmt.Errorf("查询 %s 的资源列表失败: %v", apiVersion, err)
+		}
+	} else {
+		var list struct {
+			Resources []Resource `json:"resources"`
+		}
+		if err := json.Unmarshal(body, &list); err != nil {
+			return nil, fmt.Errorf("解析 %s 的资源列表失败: %v", apiVersion, err)
+		}
+		for _, r := range list.Resources {
+			// 跳过 deployments/status 等子资源
+			if !strings.Contains(r.Name, "/") {
+				resources = append(resources, r)
+			}
+		}
+	}
+	c.mu.Lock()
+	c.resources[apiVersion] = resources
+	c.mu.Unlock()
+	return resources, nil
+}
+
+// groupVersionPath 返回 apiVersion 的 API 路径，核心组为 /api/v1
+func groupVersionPath(apiVersion string) string {
+	if !strings.Contains(apiVersion, "/") {
+		return "/api/" + apiVersion
+	}
+	return "/apis/" + apiVersion
+}
+
+// ObjectPath 返回对象的 API 路径，cluster 级别的资源忽略 namespace
+func (c *Client) ObjectPath(apiVersion, kind, namespace, name string) (string, error) {
+	resource, err := c.Resource(apiVersion, kind)
+	if err != nil {
+		return "", err
+	}
+	path := groupVersionPath(apiVersion)
+	if resource.Namespaced {
+		path += "/namespaces/" + url.PathEscape(namespace)
+	}
+	return path + "/" + resource.Name + "/" + url.PathEscape(name), nil
+}
+
+// Get 读取集群中的对象，不存在时返回 ErrNotFound
+func (c *Client) Get(apiVersion, kind, namespace, name string) (map[string]interface{}, error) {
+	path, err := c.ObjectPath(apiVersion, kind, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	status, body, err := c.do("GET", path, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, apiError(status, body)
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return nil, fmt.Errorf("解析 %s/%s 失败: %v", kind, name, err)
+	}
+	return obj, nil
+}
+
+// Apply 以 server-side apply 创建或更新对象，根据 apply 前后的 resourceVersion 判断对象是否变化。
+// 字段已由其他管理者（如 kubectl apply、控制器）设置时 API 返回冲突，结果为 Failed 且 Conflict 为 true；
+// force 为 true 时强制接管这些字段
+func (c *Client) Apply(obj map[string]interface{}, force bool) Result {
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	result := Result{APIVersion: apiVersion, Kind: kind, Name: name, Action: Failed}
+	if apiVersion == "" || kind == "" || name == "" {
+		result.Error = "缺少 apiVersion、kind 或 metadata.name"
+		return result
+	}
+
+	resource, err := c.Resource(apiVersion, kind)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if resource.Namespaced {
+		namespace, _ := metadata["namespace"].(string)
+		if namespace == "" {
+			namespace = c.Namespace
+		}
+		result.Namespace = namespace
+	}
+
+	path, err := c.ObjectPath(apiVersion, kind, result.Namespace, name)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	before := ""
+	live, err := c.Get(apiVersion, kind, result.Namespace, name)
+	switch {
+	case err == ErrNotFound:
+	case err != nil:
+		result.Error = fmt.Sprintf("读取现有对象失败: %v", err)
+		return result
+	default:
+		before = resourceVersion(live)
+	}
+
+	body, err := json.Marshal(obj)
+	if err != nil {
+		result.Error = fmt.Sprintf("序列化对象失败: %v", err)
+		return result
+	}
+	query := url.Values{"fieldManager": {FieldManager}}
+	if force {
+		query.Set("force", "true")
+	}
+	status, data, err := c.do("PATCH", path+"?"+query.Encode(), "application/apply-patch+yaml", body)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if status == http.StatusConflict {
+		result.Error = apiError(status, data).Error()
+		result.Conflict = true
+		return result
+	}
+	if status != http.StatusOK && status != http.StatusCreated {
+		result.Error = apiError(status, data).Error()
+		return result
+	}
+
+	var applied map[string]interface{}
+	if err := json.Unmarshal(data, &applied); err != nil {
+		result.Error = fmt.Sprintf("解析 apply 结果失败: %v", err)
+		return result
+	}
+	switch {
+	case live == nil || status == http.StatusCreated:
+		result.Action = Created
+	case resourceVersion(applied) == before:
+		result.Action = Unchanged
+	default:
+		result.Action = Configured
+	}
+	return result
+}
+
+// resourceVersion 返回对象的 metadata.resourceVersion
+func resourceVersion(obj map[string]interface{}) string {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	version, _ := metadata["resourceVersion"].(string)
+	return version
+}
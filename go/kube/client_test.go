@@ -0,0 +1,187 @@
+package kube_test
+
+import (
+	"dockerImageMigrator/kube"
+	"gopkg.in/yaml.v3"
+	"strings"
+	"testing"
+)
+
+const manifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 2
+  template:
+    metadata:
+      annotations:
+        released: 2024-01-02
+    spec:
+      containers:
+      - name: web
+        image: harbor.local/app/web:1.0
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: edge
+spec:
+  ports:
+  - port: 80
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: edge
+`
+
+func decodeAll(t *testing.T, data string) []map[string]interface{} {
+	t.Helper()
+	var objects []map[string]interface{}
+	decoder := yaml.NewDecoder(strings.NewReader(data))
+	for {
+		var node yaml.Node
+		if err := decoder.Decode(&node); err != nil {
+			break
+		}
+		obj, err := kube.Decode(&node)
+		if err != nil {
+			t.Fatalf("解析对象失败: %v", err)
+		}
+		objects = append(objects, obj)
+	}
+	return objects
+}
+
+func newClient(t *testing.T, s *fakeAPIServer, context string) *kube.Client {
+	t.Helper()
+	config, err := kube.LoadConfig(s.kubeconfig(t), context)
+	if err != nil {
+		t.Fatalf("加载 kubeconfig 失败: %v", err)
+	}
+	return kube.NewClient(config)
+}
+
+func TestLoadConfig(t *testing.T) {
+	s := newFakeAPIServer(t)
+	path := s.kubeconfig(t)
+
+	config, err := kube.LoadConfig(path, "")
+	if err != nil {
+		t.Fatalf("加载 kubeconfig 失败: %v", err)
+	}
+	if config.Context != "test" || config.Server != s.URL || config.Namespace != "apps" || config.Token != fakeToken {
+		t.Errorf("current-context 解析错误: %+v", config)
+	}
+	if config.TLS.RootCAs == nil {
+		t.Error("没有加载 certificate-authority")
+	}
+
+	config, err = kube.LoadConfig(path, "other")
+	if err != nil {
+		t.Fatalf("加载上下文 other 失败: %v", err)
+	}
+	if config.Server != "https://127.0.0.1:1" || config.Namespace != "default" || config.TLS.RootCAs == nil {
+		t.Errorf("上下文 other 解析错误: %+v", config)
+	}
+
+	if _, err := kube.LoadConfig(path, "missing"); err == nil {
+		t.Error("不存在的上下文应报错")
+	}
+}
+
+func TestApply(t *testing.T) {
+	s := newFakeAPIServer(t)
+	client := newClient(t, s, "")
+	objects := decodeAll(t, manifest)
+
+	var actions []string
+	for _, obj := range objects {
+		result := client.Apply(obj, false)
+		actions = append(actions, result.String())
+	}
+	want := []string{
+		"apps/deployment.apps/web created",
+		"edge/service/web created",
+		"namespace/edge created",
+	}
+	if strings.Join(actions, "\n") != strings.Join(want, "\n") {
+		t.Errorf("首次 apply 结果:\n%s\n期望:\n%s", strings.Join(actions, "\n"), strings.Join(want, "\n"))
+	}
+
+	deployment := s.get("/apis/apps/v1/namespaces/apps/deployments/web")
+	if deployment == nil {
+		t.Fatal("Deployment 没有写入上下文的默认命名空间")
+	}
+	annotations := deployment["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	if annotations["released"] != "2024-01-02" {
+		t.Errorf("日期应按原文保留为字符串: %#v", annotations["released"])
+	}
+	if replicas, ok := deployment["spec"].(map[string]interface{})["replicas"].(float64); !ok || replicas != 2 {
+		t.Errorf("replicas 应为数字: %#v", deployment["spec"].(map[string]interface{})["replicas"])
+	}
+
+	if result := client.Apply(objects[0], false); result.Action != kube.Unchanged {
+		t.Errorf("内容未变时应为 unchanged: %v", result)
+	}
+
+	changed := decodeAll(t, strings.Replace(manifest, "web:1.0", "web:1.1", 1))
+	if result := client.Apply(changed[0], false); result.Action != kube.Configured {
+		t.Errorf("内容变化时应为 configured: %v", result)
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	s := newFakeAPIServer(t)
+	client := newClient(t, s, "")
+	s.fail["/api/v1/namespaces/edge/services/web"] = `Service "web" is invalid: spec.ports: Required value`
+
+	objects := decodeAll(t, manifest+`---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: w
+---
+apiVersion: v1
+kind: ConfigMap
+`)
+	results := make([]kube.Result, len(objects))
+	for i, obj := range objects {
+		results[i] = client.Apply(obj, false)
+	}
+
+	if results[0].Action != kube.Created {
+		t.Errorf("其他对象出错不应影响 Deployment: %v", results[0])
+	}
+	if results[1].Action != kube.Failed || !strings.Contains(results[1].Error, "spec.ports: Required value") {
+		t.Errorf("应返回 API 的错误信息: %v", results[1])
+	}
+	if results[3].Action != kube.Failed || !strings.Contains(results[3].Error, "example.com/v1/Widget") {
+		t.Errorf("未知资源类型应报错: %v", results[3])
+	}
+	if results[4].Action != kube.Failed || !strings.Contains(results[4].Error, "metadata.name") {
+		t.Errorf("缺少名称应报错: %v", results[4])
+	}
+}
+
+func TestApplyConflicts(t *testing.T) {
+	s := newFakeAPIServer(t)
+	client := newClient(t, s, "")
+	const path = "/apis/apps/v1/namespaces/apps/deployments/web"
+	s.conflicts[path] = true
+	deployment := decodeAll(t, manifest)[0]
+
+	result := client.Apply(deployment, false)
+	if result.Action != kube.Failed || !result.Conflict || !strings.Contains(result.Error, "conflict") {
+		t.Errorf("字段冲突时不应覆盖: %v", result)
+	}
+	if s.get(path) != nil {
+		t.Error("冲突的对象不应写入")
+	}
+
+	if result := client.Apply(deployment, true); result.Action != kube.Created || result.Conflict {
+		t.Errorf("强制 apply 时应接管冲突的字段: %v", result)
+	}
+}
@@ -0,0 +1,198 @@
+package kube
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// kubeconfig 文件中用到的部分
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+			TLSServerName            string `yaml:"tls-server-name"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string      `yaml:"token"`
+			TokenFile             string      `yaml:"tokenFile"`
+			ClientCertificate     string      `yaml:"client-certificate"`
+			ClientCertificateData string      `yaml:"client-certificate-data"`
+			ClientKey             string      `yaml:"client-key"`
+			ClientKeyData         string      `yaml:"client-key-data"`
+			Username              string      `yaml:"username"`
+			Password              string      `yaml:"password"`
+			Exec                  interface{} `yaml:"exec"`
+			AuthProvider          interface{} `yaml:"auth-provider"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+// Config 从 kubeconfig 中选定上下文后得到的连接参数
+type Config struct {
+	Context   string
+	Server    string
+	Namespace string // 上下文的默认命名空间，未设置时为 default
+
+	TLS      *tls.Config
+	Token    string
+	Username string
+	Password string
+}
+
+// DefaultKubeconfig 返回 KUBECONFIG 中的第一个文件或 ~/.kube/config
+func DefaultKubeconfig() string {
+	if env := os.Getenv("KUBECONFIG"); env != "" {
+		return filepath.SplitList(env)[0]
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kube", "config")
+}
+
+// LoadConfig 读取 kubeconfig，context 为空时使用 current-context；
+// path 为空时使用 DefaultKubeconfig，文件中的相对路径相对于 kubeconfig 所在目录
+func LoadConfig(path, context string) (*Config, error) {
+	if path == "" {
+		path = DefaultKubeconfig()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 kubeconfig 失败: %v", err)
+	}
+	var kc kubeconfig
+	if err := yaml.Unmarshal(data, &kc); err != nil {
+		return nil, fmt.Errorf("解析 kubeconfig %s 失败: %v", path, err)
+	}
+	dir := filepath.Dir(path)
+	resolve := func(file string) string {
+		if file == "" || filepath.IsAbs(file) {
+			return file
+		}
+		return filepath.Join(dir, file)
+	}
+
+	if context == "" {
+		context = kc.CurrentContext
+	}
+	if context == "" {
+		return nil, fmt.Errorf("kubeconfig %s 没有 current-context，请指定上下文", path)
+	}
+	config := &Config{Context: context, Namespace: "default"}
+
+	var clusterName, userName string
+	found := false
+	for _, c := range kc.Contexts {
+		if c.Name == context {
+			clusterName, userName, found = c.Context.Cluster, c.Context.User, true
+			if c.Context.Namespace != "" {
+				config.Namespace = c.Context.Namespace
+			}
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("kubeconfig 中没有上下文 %s", context)
+	}
+
+	tlsConfig := &tls.Config{}
+	found = false
+	for _, c := range kc.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		found = true
+		config.Server = strings.TrimRight(c.Cluster.Server, "/")
+		tlsConfig.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+		tlsConfig.ServerName = c.Cluster.TLSServerName
+		ca, err := fileOrData(resolve(c.Cluster.CertificateAuthority), c.Cluster.CertificateAuthorityData)
+		if err != nil {
+			return nil, fmt.Errorf("集群 %s 的 CA 证书无效: %v", clusterName, err)
+		}
+		if ca != nil {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("集群 %s 的 CA 证书无效", clusterName)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		break
+	}
+	if !found {
+		return nil, fmt.Errorf("kubeconfig 中没有集群 %s", clusterName)
+	}
+	if config.Server == "" {
+		return nil, fmt.Errorf("集群 %s 没有配置 server", clusterName)
+	}
+
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+		if u.User.Exec != nil || u.User.AuthProvider != nil {
+			return nil, fmt.Errorf("用户 %s 使用 exec/auth-provider 认证，暂不支持，请改用 token 或客户端证书", userName)
+		}
+		config.Token = u.User.Token
+		if config.Token == "" && u.User.TokenFile != "" {
+			token, err := os.ReadFile(resolve(u.User.TokenFile))
+			if err != nil {
+				return nil, fmt.Errorf("读取用户 %s 的 token 文件失败: %v", userName, err)
+			}
+			config.Token = strings.TrimSpace(string(token))
+		}
+		config.Username, config.Password = u.User.Username, u.User.Password
+
+		cert, err := fileOrData(resolve(u.User.ClientCertificate), u.User.ClientCertificateData)
+		if err != nil {
+			return nil, fmt.Errorf("用户 %s 的客户端证书无效: %v", userName, err)
+		}
+		key, err := fileOrData(resolve(u.User.ClientKey), u.User.ClientKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("用户 %s 的客户端私钥无效: %v", userName, err)
+		}
+		if cert != nil || key != nil {
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, fmt.Errorf("加载用户 %s 的客户端证书失败: %v", userName, err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
+		break
+	}
+	config.TLS = tlsConfig
+	return config, nil
+}
+
+// fileOrData 读取证书，*-data 字段为 base64 编码的内容，优先于文件路径
+func fileOrData(file, data string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file != "" {
+		return os.ReadFile(file)
+	}
+	return nil, nil
+}
@@ -0,0 +1,223 @@
+package kube
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// 字段变化的类型
+const (
+	FieldAdded   = "+"
+	FieldRemoved = "-"
+	FieldChanged = "~"
+)
+
+// Change 一个字段的变化，Path 如 spec.template.spec.containers[web].image
+type Change struct {
+	Op   string      `json:"op"`
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// IsImage 判断是否为容器镜像的变化
+func (c Change) IsImage() bool {
+	return strings.HasSuffix(c.Path, ".image")
+}
+
+// String 显示为 path: 旧值 → 新值
+func (c Change) String() string {
+	switch c.Op {
+	case FieldAdded:
+		return fmt.Sprintf("+ %s: %s", c.Path, formatValue(c.New))
+	case FieldRemoved:
+		return fmt.Sprintf("- %s: %s", c.Path, formatValue(c.Old))
+	}
+	return fmt.Sprintf("~ %s: %s → %s", c.Path, formatValue(c.Old), formatValue(c.New))
+}
+
+// ObjectDiff 单个对象与集群中现有内容的差异
+type ObjectDiff struct {
+	ObjectRef
+	Created bool     `json:"created,omitempty"` // 集群中不存在，将新建
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// Changed 判断 apply 后对象是否会变化
+func (d *ObjectDiff) Changed() bool {
+	return d.Created || len(d.Changes) > 0
+}
+
+// Diff 读取集群中的对象并与 yaml 中的内容比较
+func Diff(cluster Cluster, ref ObjectRef, desired map[string]interface{}) (*ObjectDiff, error) {
+	diff := &ObjectDiff{ObjectRef: ref}
+	live, err := cluster.Get(ref.APIVersion, ref.Kind, ref.Namespace, ref.Name)
+	var unknown *UnknownKindError
+	switch {
+	case err == ErrNotFound || errors.As(err, &unknown):
+		diff.Created = true
+		return diff, nil
+	case err != nil:
+		return nil, fmt.Errorf("读取 %s/%s 失败: %v", ref.Kind, ref.Name, err)
+	}
+	diff.Changes = DiffFields(live, desired)
+	if ref.Kind == "Secret" && ref.APIVersion == "v1" {
+		maskSecret(diff.Changes)
+	}
+	return diff, nil
+}
+
+// maskSecret 隐藏 Secret 中 data 与 stringData 的内容，差异只显示哪些键有变化
+func maskSecret(changes []Change) {
+	for i := range changes {
+		c := &changes[i]
+		field, _, _ := strings.Cut(c.Path, ".")
+		if field != "data" && field != "stringData" {
+			continue
+		}
+		if c.Old != nil {
+			c.Old = "***"
+		}
+		if c.New != nil {
+			c.New = "***"
+		}
+	}
+}
+
+// DiffFields 以 yaml 中的字段为准比较对象：只比较 yaml 中写出的字段，集群补充的默认值与 status 不计入差异。
+// 元素带 name 的列表（containers、env、ports 等）按 name 对应，其余列表按位置对应
+func DiffFields(live, desired map[string]interface{}) []Change {
+	var changes []Change
+	diffValue(&changes, "", normalize(live), normalize(desired))
+	return changes
+}
+
+// normalize 经 JSON 转换统一数字等类型，yaml 中的 int 与 API 返回的 float64 可以直接比较
+func normalize(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var result interface{}
+	if json.Unmarshal(data, &result) != nil {
+		return value
+	}
+	return result
+}
+
+func diffValue(changes *[]Change, path string, live, desired interface{}) {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(d))
+		for key := range d {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := joinField(path, key)
+			if path == "" && key == "status" {
+				continue
+			}
+			lv, exists := l[key]
+			if !exists || lv == nil {
+				if d[key] != nil {
+					*changes = append(*changes, Change{Op: FieldAdded, Path: child, New: d[key]})
+				}
+				continue
+			}
+			diffValue(changes, child, lv, d[key])
+		}
+		return
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok {
+			break
+		}
+		if names, ok := namedItems(d); ok {
+			if liveNames, ok := namedItems(l); ok {
+				diffNamed(changes, path, liveNames, names, d)
+				return
+			}
+		}
+		if len(l) != len(d) {
+			break
+		}
+		for i := range d {
+			diffValue(changes, fmt.Sprintf("%s[%d]", path, i), l[i], d[i])
+		}
+		return
+	}
+	if !reflect.DeepEqual(live, desired) {
+		*changes = append(*changes, Change{Op: FieldChanged, Path: path, Old: live, New: desired})
+	}
+}
+
+// diffNamed 按 name 对应比较列表元素，列出新增与删除的元素
+func diffNamed(changes *[]Change, path string, live, desired map[string]interface{}, order []interface{}) {
+	for _, item := range order {
+		name := item.(map[string]interface{})["name"].(string)
+		child := fmt.Sprintf("%s[%s]", path, name)
+		if l, ok := live[name]; ok {
+			diffValue(changes, child, l, item)
+		} else {
+			*changes = append(*changes, Change{Op: FieldAdded, Path: child, New: item})
+		}
+	}
+	var removed []string
+	for name := range live {
+		if _, ok := desired[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	for _, name := range removed {
+		*changes = append(*changes, Change{Op: FieldRemoved, Path: fmt.Sprintf("%s[%s]", path, name), Old: live[name]})
+	}
+}
+
+// namedItems 列表的每个元素都是带字符串 name 的对象时，返回 name 到元素的映射
+func namedItems(list []interface{}) (map[string]interface{}, bool) {
+	if len(list) == 0 {
+		return nil, false
+	}
+	items := make(map[string]interface{}, len(list))
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		name, ok := m["name"].(string)
+		if !ok || items[name] != nil {
+			return nil, false
+		}
+		items[name] = item
+	}
+	return items, true
+}
+
+func joinField(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// formatValue 标量直接显示，对象与列表显示为紧凑的 JSON
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,112 @@
+package kube_test
+
+import (
+	"dockerImageMigrator/kube"
+	"strings"
+	"testing"
+)
+
+func TestDiffFields(t *testing.T) {
+	live := decodeAll(t, `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  uid: 1234
+  resourceVersion: "77"
+spec:
+  replicas: 2
+  progressDeadlineSeconds: 600
+  template:
+    spec:
+      containers:
+      - name: web
+        image: image.cestc.cn/app/web:1.0
+        imagePullPolicy: IfNotPresent
+        env:
+        - name: MODE
+          value: prod
+        - name: OLD
+          value: x
+      - name: sidecar
+        image: image.cestc.cn/app/proxy:2
+      volumes:
+      - name: data
+status:
+  replicas: 2
+`)[0]
+	desired := decodeAll(t, `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: sidecar
+        image: image.cestc.cn/app/proxy:2
+      - name: web
+        image: dockerhub.cestc.local/app/web:1.0
+        env:
+        - name: MODE
+          value: prod
+        - name: DEBUG
+          value: "true"
+      volumes:
+      - name: data
+`)[0]
+
+	var got []string
+	images := 0
+	for _, change := range kube.DiffFields(live, desired) {
+		got = append(got, change.String())
+		if change.IsImage() {
+			images++
+		}
+	}
+	want := []string{
+		"~ spec.replicas: 2 → 3",
+		"+ spec.template.spec.containers[web].env[DEBUG]: {\"name\":\"DEBUG\",\"value\":\"true\"}",
+		"- spec.template.spec.containers[web].env[OLD]: {\"name\":\"OLD\",\"value\":\"x\"}",
+		"~ spec.template.spec.containers[web].image: image.cestc.cn/app/web:1.0 → dockerhub.cestc.local/app/web:1.0",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("差异:\n%s\n期望:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if images != 1 {
+		t.Errorf("应识别出 1 处镜像变化，实际 %d", images)
+	}
+
+	if changes := kube.DiffFields(live, live); len(changes) != 0 {
+		t.Errorf("相同对象不应有差异: %v", changes)
+	}
+}
+
+func TestDiffAgainstCluster(t *testing.T) {
+	s := newFakeAPIServer(t)
+	client := newClient(t, s, "")
+	objects := decodeAll(t, liveConfigMap)
+	ref := kube.ObjectRef{APIVersion: "v1", Kind: "ConfigMap", Namespace: "apps", Name: "settings"}
+
+	diff, err := kube.Diff(client, ref, objects[0])
+	if err != nil || !diff.Created || !diff.Changed() {
+		t.Fatalf("集群中不存在的对象应标记为新建: %+v, %v", diff, err)
+	}
+
+	client.Apply(objects[0], false)
+	diff, err = kube.Diff(client, ref, objects[0])
+	if err != nil || diff.Changed() {
+		t.Errorf("apply 后不应有差异: %+v, %v", diff, err)
+	}
+
+	changed := decodeAll(t, strings.Replace(liveConfigMap, "mode: prod", "mode: test", 1))
+	diff, err = kube.Diff(client, ref, changed[0])
+	if err != nil || len(diff.Changes) != 1 || diff.Changes[0].String() != "~ data.mode: prod → test" {
+		t.Errorf("差异错误: %+v, %v", diff, err)
+	}
+
+	widget := kube.ObjectRef{APIVersion: "example.com/v1", Kind: "Widget", Name: "w"}
+	if diff, err := kube.Diff(client, widget, map[string]interface{}{}); err != nil || !diff.Created {
+		t.Errorf("集群不支持的类型应视为新建: %+v, %v", diff, err)
+	}
+}
@@ -0,0 +1,225 @@
+package kube_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const fakeToken = "test-token"
+
+// fakeAPIServer 内存中的 Kubernetes API，支持 discovery、GET 与 server-side apply
+type fakeAPIServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	objects   map[string]map[string]interface{} // 对象路径 -> 对象
+	version   int
+	fail      map[string]string // 对象路径 -> apply 时返回的错误
+	conflicts map[string]bool   // 对象路径 -> 未强制 apply 时返回字段冲突
+	applies   []string          // apply 请求的路径
+}
+
+var fakeDiscovery = map[string]string{
+	"/api/v1": `{"groupVersion":"v1","resources":[
+		{"name":"namespaces","namespaced":false,"kind":"Namespace"},
+		{"name":"pods","namespaced":true,"kind":"Pod"},
+		{"name":"pods/status","namespaced":true,"kind":"Pod"},
+		{"name":"services","namespaced":true,"kind":"Service"},
+		{"name":"configmaps","namespaced":true,"kind":"ConfigMap"},
+		{"name":"secrets","namespaced":true,"kind":"Secret"},
+		{"name":"serviceaccounts","namespaced":true,"kind":"ServiceAccount"}]}`,
+	"/apis/apps/v1": `{"groupVersion":"apps/v1","resources":[
+		{"name":"deployments","namespaced":true,"kind":"Deployment"},
+		{"name":"statefulsets","namespaced":true,"kind":"StatefulSet"},
+		{"name":"daemonsets","namespaced":true,"kind":"DaemonSet"}]}`,
+}
+
+func newFakeAPIServer(t *testing.T) *fakeAPIServer {
+	t.Helper()
+	s := &fakeAPIServer{objects: make(map[string]map[string]interface{}), fail: make(map[string]string), conflicts: make(map[string]bool)}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// kubeconfig 写入指向该服务器的 kubeconfig，CA 证书以文件形式引用以覆盖相对路径解析
+func (s *fakeAPIServer) kubeconfig(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+	if err := os.WriteFile(filepath.Join(dir, "ca.crt"), ca, 0600); err != nil {
+		t.Fatalf("写入 CA 证书失败: %v", err)
+	}
+	config := fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: test
+clusters:
+- name: test
+  cluster:
+    server: %s
+    certificate-authority: ca.crt
+- name: other
+  cluster:
+    server: https://127.0.0.1:1
+    certificate-authority-data: %s
+users:
+- name: admin
+  user:
+    token: %s
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: admin
+    namespace: apps
+- name: other
+  context:
+    cluster: other
+    user: admin
+`, s.URL, base64.StdEncoding.EncodeToString(ca), fakeToken)
+	path := filepath.Join(dir, "config")
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatalf("写入 kubeconfig 失败: %v", err)
+	}
+	return path
+}
+
+// put 直接写入对象
+func (s *fakeAPIServer) put(path string, obj map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version++
+	obj["metadata"].(map[string]interface{})["resourceVersion"] = strconv.Itoa(s.version)
+	s.objects[path] = obj
+}
+
+func (s *fakeAPIServer) get(path string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.objects[path]
+}
+
+func (s *fakeAPIServer) status(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{"kind": "Status", "message": message, "code": code})
+}
+
+func (s *fakeAPIServer) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+fakeToken {
+		s.status(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if discovery, ok := fakeDiscovery[r.URL.Path]; ok && r.Method == "GET" {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, discovery)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := r.URL.Path
+	switch r.Method {
+	case "GET":
+		obj, ok := s.objects[path]
+		if !ok {
+			s.status(w, http.StatusNotFound, "not found")
+			return
+		}
+		json.NewEncoder(w).Encode(obj)
+	case "PATCH":
+		s.applies = append(s.applies, path)
+		if r.Header.Get("Content-Type") != "application/apply-patch+yaml" || r.URL.Query().Get("fieldManager") == "" {
+			s.status(w, http.StatusUnsupportedMediaType, "expected server-side apply")
+			return
+		}
+		if message, ok := s.fail[path]; ok {
+			s.status(w, http.StatusUnprocessableEntity, message)
+			return
+		}
+		if s.conflicts[path] && r.URL.Query().Get("force") != "true" {
+			s.status(w, http.StatusConflict, `Apply failed with 1 conflict: conflict with "kubectl-client-side-apply": .spec.replicas`)
+			return
+		}
+		var obj map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&obj); err != nil {
+			s.status(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		metadata := obj["metadata"].(map[string]interface{})
+		parts := strings.Split(path, "/")
+		for i, part := range parts {
+			if part == "namespaces" && i+2 < len(parts) {
+				metadata["namespace"] = parts[i+1]
+			}
+		}
+		code := http.StatusOK
+		live, exists := s.objects[path]
+		if !exists {
+			code = http.StatusCreated
+		}
+		if exists && sameObject(live, obj) {
+			obj = live
+		} else {
+			s.version++
+			metadata["resourceVersion"] = strconv.Itoa(s.version)
+			s.objects[path] = obj
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(obj)
+	case "PUT":
+		var obj map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&obj); err != nil {
+			s.status(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		live, ok := s.objects[path]
+		if !ok {
+			s.status(w, http.StatusNotFound, "not found")
+			return
+		}
+		metadata := obj["metadata"].(map[string]interface{})
+		if metadata["resourceVersion"] != live["metadata"].(map[string]interface{})["resourceVersion"] {
+			s.status(w, http.StatusConflict, "the object has been modified")
+			return
+		}
+		s.version++
+		metadata["resourceVersion"] = strconv.Itoa(s.version)
+		s.objects[path] = obj
+		json.NewEncoder(w).Encode(obj)
+	case "DELETE":
+		if _, ok := s.objects[path]; !ok {
+			s.status(w, http.StatusNotFound, "not found")
+			return
+		}
+		delete(s.objects, path)
+		s.status(w, http.StatusOK, "deleted")
+	default:
+		s.status(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// sameObject 忽略 resourceVersion 比较对象内容
+func sameObject(a, b map[string]interface{}) bool {
+	strip := func(obj map[string]interface{}) map[string]interface{} {
+		data, _ := json.Marshal(obj)
+		var copied map[string]interface{}
+		json.Unmarshal(data, &copied)
+		delete(copied["metadata"].(map[string]interface{}), "resourceVersion")
+		return copied
+	}
+	return reflect.DeepEqual(strip(a), strip(b))
+}
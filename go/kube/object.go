@@ -0,0 +1,99 @@
+package kube
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+)
+
+// Decode 将 yaml 对象转换为可序列化为 JSON 的值。
+// 日期等 yaml 特有的类型按原文保留为字符串，与 kubectl 的处理一致
+func Decode(node *yaml.Node) (map[string]interface{}, error) {
+	value, err := decodeNode(node)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("第 %d 行不是 yaml 对象", node.Line)
+	}
+	return obj, nil
+}
+
+func decodeNode(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return decodeNode(node.Content[0])
+	case yaml.AliasNode:
+		return decodeNode(node.Alias)
+	case yaml.MappingNode:
+		obj := make(map[string]interface{})
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Tag == "!!merge" {
+				if err := mergeInto(obj, value); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if key.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("第 %d 行的键不是字符串", key.Line)
+			}
+			v, err := decodeNode(value)
+			if err != nil {
+				return nil, err
+			}
+			obj[key.Value] = v
+		}
+		return obj, nil
+	case yaml.SequenceNode:
+		list := make([]interface{}, 0, len(node.Content))
+		for _, item := range node.Content {
+			v, err := decodeNode(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!int", "!!float", "!!bool", "!!null":
+			var v interface{}
+			if err := node.Decode(&v); err != nil {
+				return nil, fmt.Errorf("第 %d 行: %v", node.Line, err)
+			}
+			return v, nil
+		}
+		return node.Value, nil
+	}
+	return nil, fmt.Errorf("第 %d 行: 无法识别的 yaml 节点", node.Line)
+}
+
+// mergeInto 处理 <<: *alias，已有的键不被覆盖
+func mergeInto(obj map[string]interface{}, node *yaml.Node) error {
+	var sources []*yaml.Node
+	if node.Kind == yaml.SequenceNode {
+		sources = node.Content
+	} else {
+		sources = []*yaml.Node{node}
+	}
+	for _, source := range sources {
+		v, err := decodeNode(source)
+		if err != nil {
+			return err
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("第 %d 行: << 只能合并对象", source.Line)
+		}
+		for key, value := range m {
+			if _, exists := obj[key]; !exists {
+				obj[key] = value
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package kube
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// ManagedByLabel 标记由迁移工具生成的对象
+const ManagedByLabel = "app.kubernetes.io/managed-by"
+
+// Secret 生成 Opaque 类型的 Secret，data 中的值按 base64 编码写入 data。
+// namespace 为空时不写入，由 apply 时的默认命名空间决定
+func Secret(name, namespace string, data map[string]string) map[string]interface{} {
+	encoded := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		encoded[key] = base64.StdEncoding.EncodeToString([]byte(value))
+	}
+	metadata := map[string]interface{}{
+		"name":   name,
+		"labels": map[string]interface{}{ManagedByLabel: FieldManager},
+	}
+	if namespace != "" {
+		metadata["namespace"] = namespace
+	}
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   metadata,
+		"type":       "Opaque",
+		"data":       encoded,
+	}
+}
+
+// PullSecret 生成 kubernetes.io/dockerconfigjson 类型的 Secret，registries 中的每个仓库使用同一组凭据
+func PullSecret(name, namespace string, registries []string, username, password string) map[string]interface{} {
+	auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	auths := make(map[string]interface{}, len(registries))
+	for _, registry := range registries {
+		auths[registry] = map[string]interface{}{"username": username, "password": password, "auth": auth}
+	}
+	config, _ := json.Marshal(map[string]interface{}{"auths": auths})
+
+	secret := Secret(name, namespace, map[string]string{".dockerconfigjson": string(config)})
+	secret["type"] = "kubernetes.io/dockerconfigjson"
+	return secret
+}
+
+// AddServiceAccountPullSecret 在命名空间的 default ServiceAccount 中加入 imagePullSecrets，
+// 该命名空间中未指定 serviceAccountName 的 Pod 都会使用它。已包含时不修改，返回是否修改
+func AddServiceAccountPullSecret(cluster Cluster, namespace, secret string) (bool, error) {
+	account, err := cluster.Get("v1", "ServiceAccount", namespace, "default")
+	if err == ErrNotFound {
+		return false, fmt.Errorf("命名空间 %s 中没有 default ServiceAccount", namespace)
+	}
+	if err != nil {
+		return false, fmt.Errorf("读取命名空间 %s 的 default ServiceAccount 失败: %v", namespace, err)
+	}
+
+	secrets, _ := account["imagePullSecrets"].([]interface{})
+	for _, item := range secrets {
+		if ref, ok := item.(map[string]interface{}); ok && ref["name"] == secret {
+			return false, nil
+		}
+	}
+	account["imagePullSecrets"] = append(secrets, map[string]interface{}{"name": secret})
+	if err := cluster.Replace(account); err != nil {
+		return false, fmt.Errorf("更新命名空间 %s 的 default ServiceAccount 失败: %v", namespace, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,96 @@
+package kube_test
+
+import (
+	"dockerImageMigrator/kube"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestPullSecret(t *testing.T) {
+	secret := kube.PullSecret("harbor-pull", "apps", []string{"dockerhub.cestc.local", "10.100.100.21:10080"}, "robot$pull", "s3cret")
+	if secret["type"] != "kubernetes.io/dockerconfigjson" {
+		t.Errorf("类型错误: %v", secret["type"])
+	}
+	metadata := secret["metadata"].(map[string]interface{})
+	if metadata["name"] != "harbor-pull" || metadata["namespace"] != "apps" {
+		t.Errorf("metadata 错误: %v", metadata)
+	}
+
+	encoded := secret["data"].(map[string]interface{})[".dockerconfigjson"].(string)
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config struct {
+		Auths map[string]struct{ Username, Password, Auth string }
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Auths) != 2 {
+		t.Fatalf("应包含两个仓库: %s", data)
+	}
+	auth := config.Auths["dockerhub.cestc.local"]
+	if auth.Username != "robot$pull" || auth.Password != "s3cret" || auth.Auth != base64.StdEncoding.EncodeToString([]byte("robot$pull:s3cret")) {
+		t.Errorf("凭据错误: %+v", auth)
+	}
+}
+
+func TestSecret(t *testing.T) {
+	secret := kube.Secret("portal-secrets", "", map[string]string{"MYSQL_PWD": "UserPasswordnN57:2"})
+	if secret["type"] != "Opaque" {
+		t.Errorf("类型错误: %v", secret["type"])
+	}
+	if _, ok := secret["metadata"].(map[string]interface{})["namespace"]; ok {
+		t.Error("namespace 为空时不应写入")
+	}
+	value, _ := base64.StdEncoding.DecodeString(secret["data"].(map[string]interface{})["MYSQL_PWD"].(string))
+	if string(value) != "UserPasswordnN57:2" {
+		t.Errorf("值应按 base64 编码: %v", secret["data"])
+	}
+}
+
+func TestAddServiceAccountPullSecret(t *testing.T) {
+	s := newFakeAPIServer(t)
+	client := newClient(t, s, "")
+	if _, err := kube.AddServiceAccountPullSecret(client, "apps", "harbor-pull"); err == nil || !strings.Contains(err.Error(), "default ServiceAccount") {
+		t.Errorf("缺少 default ServiceAccount 时应报错: %v", err)
+	}
+
+	path := "/api/v1/namespaces/apps/serviceaccounts/default"
+	s.put(path, map[string]interface{}{
+		"apiVersion":       "v1",
+		"kind":             "ServiceAccount",
+		"metadata":         map[string]interface{}{"name": "default", "namespace": "apps"},
+		"imagePullSecrets": []interface{}{map[string]interface{}{"name": "other"}},
+	})
+	changed, err := kube.AddServiceAccountPullSecret(client, "apps", "harbor-pull")
+	if err != nil || !changed {
+		t.Fatalf("应加入 imagePullSecrets: %v, %v", changed, err)
+	}
+	secrets := s.get(path)["imagePullSecrets"].([]interface{})
+	if len(secrets) != 2 || secrets[1].(map[string]interface{})["name"] != "harbor-pull" {
+		t.Errorf("imagePullSecrets 错误: %v", secrets)
+	}
+
+	if changed, err := kube.AddServiceAccountPullSecret(client, "apps", "harbor-pull"); err != nil || changed {
+		t.Errorf("已包含时不应修改: %v, %v", changed, err)
+	}
+}
+
+func TestDiffMasksSecretData(t *testing.T) {
+	s := newFakeAPIServer(t)
+	client := newClient(t, s, "")
+	ref := kube.ObjectRef{APIVersion: "v1", Kind: "Secret", Namespace: "apps", Name: "harbor-pull"}
+	client.Apply(kube.PullSecret("harbor-pull", "apps", []string{"dockerhub.cestc.local"}, "admin", "old"), false)
+
+	diff, err := kube.Diff(client, ref, kube.PullSecret("harbor-pull", "apps", []string{"dockerhub.cestc.local"}, "admin", "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Changes) != 1 || diff.Changes[0].String() != "~ data..dockerconfigjson: *** → ***" {
+		t.Errorf("Secret 内容应隐藏: %+v", diff.Changes)
+	}
+}
@@ -0,0 +1,172 @@
+package kube
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// 回滚结果中的动作
+const (
+	Restored Action = "restored" // 恢复为 apply 前的内容
+	Deleted  Action = "deleted"  // apply 前不存在，已删除
+)
+
+// ObjectRef 集群中的一个对象
+type ObjectRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+// String 按 kubectl 的格式显示，如 apps/deployment.apps/web
+func (r ObjectRef) String() string {
+	kind := strings.ToLower(r.Kind)
+	if group, _, ok := strings.Cut(r.APIVersion, "/"); ok {
+		kind += "." + group
+	}
+	name := kind + "/" + r.Name
+	if r.Namespace != "" {
+		name = r.Namespace + "/" + name
+	}
+	return name
+}
+
+// Cluster 回滚需要的对象读写操作，*Client 直接请求 API，也可以通过远程主机上的 kubectl 实现。
+// namespace 对 cluster 级别的对象无效
+type Cluster interface {
+	// Get 读取对象，不存在时返回 ErrNotFound
+	Get(apiVersion, kind, namespace, name string) (map[string]interface{}, error)
+	// Replace 以 obj 整体替换集群中的对象，obj 中的 resourceVersion 必须是当前版本
+	Replace(obj map[string]interface{}) error
+	// Delete 删除对象，不存在时不报错
+	Delete(apiVersion, kind, namespace, name string) error
+}
+
+// Replace 以 PUT 整体替换对象
+func (c *Client) Replace(obj map[string]interface{}) error {
+	ref := refOf(obj)
+	path, err := c.ObjectPath(ref.APIVersion, ref.Kind, ref.Namespace, ref.Name)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("序列化对象失败: %v", err)
+	}
+	status, data, err := c.do("PUT", path, "application/json", body)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK && status != http.StatusCreated {
+		return apiError(status, data)
+	}
+	return nil
+}
+
+// Delete 删除对象，由垃圾回收在后台删除其下属对象
+func (c *Client) Delete(apiVersion, kind, namespace, name string) error {
+	path, err := c.ObjectPath(apiVersion, kind, namespace, name)
+	if err != nil {
+		return err
+	}
+	status, data, err := c.do("DELETE", path+"?"+url.Values{"propagationPolicy": {"Background"}}.Encode(), "", nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK && status != http.StatusAccepted && status != http.StatusNotFound {
+		return apiError(status, data)
+	}
+	return nil
+}
+
+// Snapshot apply 前对象在集群中的内容
+type Snapshot struct {
+	ObjectRef
+	Live map[string]interface{} `json:"-"` // apply 前不存在时为 nil
+}
+
+// Capture 在 apply 前记录对象的当前内容
+func Capture(cluster Cluster, refs []ObjectRef) ([]*Snapshot, error) {
+	var snapshots []*Snapshot
+	for _, ref := range refs {
+		live, err := cluster.Get(ref.APIVersion, ref.Kind, ref.Namespace, ref.Name)
+		var unknown *UnknownKindError
+		if errors.As(err, &unknown) {
+			// 资源类型由本次 apply 的 CRD 定义，对象不可能已存在
+			live, err = nil, nil
+		}
+		if err != nil && err != ErrNotFound {
+			return nil, fmt.Errorf("读取 %s/%s 失败: %v", ref.Kind, ref.Name, err)
+		}
+		snapshots = append(snapshots, &Snapshot{ObjectRef: ref, Live: live})
+	}
+	return snapshots, nil
+}
+
+// Restore 将对象恢复为 apply 前的内容：apply 前不存在的对象被删除，
+// 之后被修改过的对象整体替换为原内容，未变化的对象跳过。按 apply 的相反顺序处理
+func Restore(cluster Cluster, snapshots []*Snapshot) []Result {
+	var results []Result
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		s := snapshots[i]
+		result := Result{APIVersion: s.APIVersion, Kind: s.Kind, Namespace: s.Namespace, Name: s.Name, Action: Failed}
+
+		current, err := cluster.Get(s.APIVersion, s.Kind, s.Namespace, s.Name)
+		var unknown *UnknownKindError
+		if errors.As(err, &unknown) {
+			err = ErrNotFound
+		}
+		switch {
+		case err == ErrNotFound && s.Live == nil:
+			continue
+		case err == ErrNotFound:
+			result.Error = "对象已不存在，无法恢复"
+		case err != nil:
+			result.Error = fmt.Sprintf("读取当前对象失败: %v", err)
+		case s.Live == nil:
+			if err := cluster.Delete(s.APIVersion, s.Kind, s.Namespace, s.Name); err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Action = Deleted
+			}
+		case resourceVersion(current) == resourceVersion(s.Live):
+			continue
+		default:
+			if err := cluster.Replace(restorable(s.Live, resourceVersion(current))); err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Action = Restored
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// restorable 复制 apply 前的对象用于替换：去掉 status 与 managedFields，resourceVersion 改为当前版本
+func restorable(live map[string]interface{}, version string) map[string]interface{} {
+	data, _ := json.Marshal(live)
+	var obj map[string]interface{}
+	json.Unmarshal(data, &obj)
+	delete(obj, "status")
+	if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+		delete(metadata, "managedFields")
+		metadata["resourceVersion"] = version
+	}
+	return obj
+}
+
+// refOf 返回对象的 apiVersion、kind、命名空间与名称
+func refOf(obj map[string]interface{}) ObjectRef {
+	return ObjectRef{
+		APIVersion: text(obj, "apiVersion"),
+		Kind:       text(obj, "kind"),
+		Namespace:  text(obj, "metadata", "namespace"),
+		Name:       text(obj, "metadata", "name"),
+	}
+}
@@ -0,0 +1,361 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PollInterval 等待 rollout 时查询工作负载状态的间隔
+var PollInterval = 2 * time.Second
+
+// RawGetter 按 API 路径读取 JSON，对象不存在时返回 ErrNotFound。
+// *Client 直接请求 API，也可以通过远程主机上的 kubectl get --raw 实现
+type RawGetter interface {
+	GetRaw(path string) ([]byte, error)
+}
+
+// GetRaw 读取 API 路径的原始响应
+func (c *Client) GetRaw(path string) ([]byte, error) {
+	status, body, err := c.do("GET", path, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, apiError(status, body)
+	}
+	return body, nil
+}
+
+// workloadResources 需要等待 rollout 的工作负载类型
+var workloadResources = map[string]string{
+	"Deployment":  "deployments",
+	"StatefulSet": "statefulsets",
+	"DaemonSet":   "daemonsets",
+}
+
+// IsWorkload 判断 kind 是否为需要等待 rollout 的工作负载
+func IsWorkload(kind string) bool {
+	_, ok := workloadResources[kind]
+	return ok
+}
+
+// Pod 单个 Pod 的健康状况
+type Pod struct {
+	Name     string   `json:"name"`
+	Phase    string   `json:"phase"`
+	Ready    bool     `json:"ready"`
+	Restarts int      `json:"restarts"`
+	Problems []string `json:"problems,omitempty"` // 镜像拉取失败、探针失败、异常退出等
+}
+
+// Rollout 工作负载的 rollout 结果
+type Rollout struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Ready     bool   `json:"ready"`
+	Message   string `json:"message,omitempty"` // 最后一次检查时的进度
+	Pods      []Pod  `json:"pods,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// String 显示为 deployment/web 的形式
+func (r *Rollout) String() string {
+	return r.Namespace + "/" + strings.ToLower(r.Kind) + "/" + r.Name
+}
+
+// WaitRollout 等待工作负载 rollout 完成，超时或部署进度超过 progressDeadlineSeconds 时失败，
+// 结束后汇总所属 Pod 的状态与重启次数
+func WaitRollout(api RawGetter, kind, namespace, name string, timeout time.Duration) *Rollout {
+	return WaitRolloutUntil(api, kind, namespace, name, time.Now().Add(timeout))
+}
+
+// WaitRolloutUntil 与 WaitRollout 相同，等待到 deadline 为止，多个工作负载共用同一个截止时间。
+// deadline 已过时仍检查一次当前状态
+func WaitRolloutUntil(api RawGetter, kind, namespace, name string, deadline time.Time) *Rollout {
+	start := time.Now()
+	rollout := &Rollout{Kind: kind, Namespace: namespace, Name: name}
+	resource, ok := workloadResources[kind]
+	if !ok {
+		rollout.Error = fmt.Sprintf("%s 不支持等待 rollout", kind)
+		return rollout
+	}
+	path := fmt.Sprintf("/apis/apps/v1/namespaces/%s/%s/%s", url.PathEscape(namespace), resource, url.PathEscape(name))
+
+	var obj map[string]interface{}
+	for {
+		data, err := api.GetRaw(path)
+		if err == nil {
+			obj = nil
+			err = json.Unmarshal(data, &obj)
+		}
+		if err != nil {
+			rollout.Error = fmt.Sprintf("读取 %s 失败: %v", rollout, err)
+			return rollout
+		}
+
+		done, message, err := rolloutStatus(kind, obj)
+		rollout.Message = message
+		if err != nil {
+			rollout.Error = err.Error()
+			break
+		}
+		if done {
+			rollout.Ready = true
+			break
+		}
+		if !time.Now().Before(deadline) {
+			rollout.Error = fmt.Sprintf("等待 rollout 超时（%v）: %s", time.Since(start).Round(time.Second), message)
+			break
+		}
+		time.Sleep(PollInterval)
+	}
+
+	pods, err := podHealth(api, namespace, obj)
+	if err != nil {
+		if rollout.Error == "" {
+			rollout.Error = err.Error()
+		}
+		return rollout
+	}
+	rollout.Pods = pods
+	return rollout
+}
+
+// rolloutStatus 按 kubectl rollout status 的规则判断 rollout 是否完成
+func rolloutStatus(kind string, obj map[string]interface{}) (bool, string, error) {
+	generation := number(obj, "metadata", "generation")
+	if observed := number(obj, "status", "observedGeneration"); observed < generation {
+		return false, "等待控制器处理新的 spec", nil
+	}
+
+	replicas := int64(1)
+	if _, ok := lookup(obj, "spec", "replicas"); ok {
+		replicas = number(obj, "spec", "replicas")
+	}
+	updated := number(obj, "status", "updatedReplicas")
+
+	switch kind {
+	case "Deployment":
+		conditions, _ := lookup(obj, "status", "conditions")
+		list, _ := conditions.([]interface{})
+		for _, c := range list {
+			condition, _ := c.(map[string]interface{})
+			if condition["type"] == "Progressing" && condition["reason"] == "ProgressDeadlineExceeded" {
+				return false, "", fmt.Errorf("超过部署进度期限: %v", condition["message"])
+			}
+		}
+		if updated < replicas {
+			return false, fmt.Sprintf("已更新 %d/%d 个副本", updated, replicas), nil
+		}
+		if total := number(obj, "status", "replicas"); total > updated {
+			return false, fmt.Sprintf("%d 个旧副本等待终止", total-updated), nil
+		}
+		if available := number(obj, "status", "availableReplicas"); available < updated {
+			return false, fmt.Sprintf("已更新的副本中 %d/%d 个可用", available, updated), nil
+		}
+		return true, fmt.Sprintf("%d 个副本已就绪", replicas), nil
+
+	case "StatefulSet":
+		if ready := number(obj, "status", "readyReplicas"); ready < replicas {
+			return false, fmt.Sprintf("%d/%d 个副本就绪", ready, replicas), nil
+		}
+		if text(obj, "spec", "updateStrategy", "type") == "OnDelete" {
+			return true, fmt.Sprintf("%d 个副本已就绪（OnDelete 策略不等待更新）", replicas), nil
+		}
+		if partition := number(obj, "spec", "updateStrategy", "rollingUpdate", "partition"); partition > 0 {
+			if updated < replicas-partition {
+				return false, fmt.Sprintf("分区更新 %d/%d 个副本", updated, replicas-partition), nil
+			}
+			return true, fmt.Sprintf("分区更新完成，%d 个副本已更新", updated), nil
+		}
+		if current, update := text(obj, "status", "currentRevision"), text(obj, "status", "updateRevision"); current != update {
+			return false, fmt.Sprintf("已更新 %d/%d 个副本", updated, replicas), nil
+		}
+		return true, fmt.Sprintf("%d 个副本已就绪", replicas), nil
+
+	case "DaemonSet":
+		desired := number(obj, "status", "desiredNumberScheduled")
+		if scheduled := number(obj, "status", "updatedNumberScheduled"); scheduled < desired {
+			return false, fmt.Sprintf("已更新 %d/%d 个节点", scheduled, desired), nil
+		}
+		if available := number(obj, "status", "numberAvailable"); available < desired {
+			return false, fmt.Sprintf("%d/%d 个节点可用", available, desired), nil
+		}
+		return true, fmt.Sprintf("%d 个节点已就绪", desired), nil
+	}
+	return false, "", fmt.Errorf("%s 不支持等待 rollout", kind)
+}
+
+// podHealth 查询工作负载选择的 Pod，汇总就绪状态、重启次数与异常
+func podHealth(api RawGetter, namespace string, obj map[string]interface{}) ([]Pod, error) {
+	selector, err := labelSelector(obj)
+	if err != nil {
+		return nil, err
+	}
+	path := fmt.Sprintf("/api/v1/namespaces/%s/pods?%s", url.PathEscape(namespace), url.Values{"labelSelector": {selector}}.Encode())
+	data, err := api.GetRaw(path)
+	if err != nil {
+		return nil, fmt.Errorf("查询 Pod 失败: %v", err)
+	}
+	var list struct {
+		Items []map[string]interface{} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("解析 Pod 列表失败: %v", err)
+	}
+
+	var pods []Pod
+	for _, item := range list.Items {
+		if _, deleting := lookup(item, "metadata", "deletionTimestamp"); deleting {
+			continue
+		}
+		pod := inspectPod(item)
+		if !pod.Ready {
+			pod.Problems = append(pod.Problems, probeFailures(api, namespace, pod.Name)...)
+		}
+		pods = append(pods, pod)
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+	return pods, nil
+}
+
+// inspectPod 从 Pod 状态中找出镜像拉取失败、启动失败、异常退出与未调度等问题
+func inspectPod(obj map[string]interface{}) Pod {
+	pod := Pod{Name: text(obj, "metadata", "name"), Phase: text(obj, "status", "phase")}
+
+	conditions, _ := lookup(obj, "status", "conditions")
+	for _, c := range asList(conditions) {
+		condition, _ := c.(map[string]interface{})
+		switch {
+		case condition["type"] == "Ready":
+			pod.Ready = condition["status"] == "True"
+		case condition["type"] == "PodScheduled" && condition["status"] == "False":
+			pod.Problems = append(pod.Problems, fmt.Sprintf("无法调度: %v", condition["message"]))
+		}
+	}
+
+	for _, field := range []string{"initContainerStatuses", "containerStatuses"} {
+		statuses, _ := lookup(obj, "status", field)
+		for _, s := range asList(statuses) {
+			status, _ := s.(map[string]interface{})
+			name := text(status, "name")
+			pod.Restarts += int(number(status, "restartCount"))
+
+			if reason := text(status, "state", "waiting", "reason"); reason != "" && reason != "ContainerCreating" && reason != "PodInitializing" {
+				problem := fmt.Sprintf("容器 %s: %s", name, reason)
+				if message := text(status, "state", "waiting", "message"); message != "" {
+					problem += ": " + message
+				}
+				pod.Problems = append(pod.Problems, problem)
+			}
+			if reason := text(status, "lastState", "terminated", "reason"); reason != "" && number(status, "restartCount") > 0 {
+				pod.Problems = append(pod.Problems, fmt.Sprintf("容器 %s 上次退出: %s（退出码 %d）",
+					name, reason, number(status, "lastState", "terminated", "exitCode")))
+			}
+			if _, running := lookup(status, "state", "running"); running && status["ready"] == false && field == "containerStatuses" {
+				pod.Problems = append(pod.Problems, fmt.Sprintf("容器 %s 运行中但未就绪", name))
+			}
+		}
+	}
+	return pod
+}
+
+// probeFailures 从 Pod 的事件中找出探针失败的信息，相同的信息只保留一条
+func probeFailures(api RawGetter, namespace, pod string) []string {
+	query := url.Values{"fieldSelector": {"involvedObject.kind=Pod,involvedObject.name=" + pod}}
+	data, err := api.GetRaw(fmt.Sprintf("/api/v1/namespaces/%s/events?%s", url.PathEscape(namespace), query.Encode()))
+	if err != nil {
+		return nil
+	}
+	var list struct {
+		Items []struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"items"`
+	}
+	if json.Unmarshal(data, &list) != nil {
+		return nil
+	}
+	var problems []string
+	seen := make(map[string]bool)
+	for _, event := range list.Items {
+		if event.Reason != "Unhealthy" || seen[event.Message] {
+			continue
+		}
+		seen[event.Message] = true
+		problems = append(problems, strings.TrimSpace(event.Message))
+	}
+	return problems
+}
+
+// labelSelector 将 spec.selector 转换为 labelSelector 查询参数
+func labelSelector(obj map[string]interface{}) (string, error) {
+	var terms []string
+	matchLabels, _ := lookup(obj, "spec", "selector", "matchLabels")
+	labels, _ := matchLabels.(map[string]interface{})
+	for key, value := range labels {
+		terms = append(terms, fmt.Sprintf("%s=%v", key, value))
+	}
+	expressions, _ := lookup(obj, "spec", "selector", "matchExpressions")
+	for _, e := range asList(expressions) {
+		expression, _ := e.(map[string]interface{})
+		key := text(expression, "key")
+		var values []string
+		for _, v := range asList(expression["values"]) {
+			values = append(values, fmt.Sprint(v))
+		}
+		switch text(expression, "operator") {
+		case "In":
+			terms = append(terms, fmt.Sprintf("%s in (%s)", key, strings.Join(values, ",")))
+		case "NotIn":
+			terms = append(terms, fmt.Sprintf("%s notin (%s)", key, strings.Join(values, ",")))
+		case "Exists":
+			terms = append(terms, key)
+		case "DoesNotExist":
+			terms = append(terms, "!"+key)
+		}
+	}
+	if len(terms) == 0 {
+		return "", fmt.Errorf("工作负载没有 spec.selector，无法查询 Pod")
+	}
+	sort.Strings(terms)
+	return strings.Join(terms, ","), nil
+}
+
+// lookup 沿路径读取 JSON 对象中的字段
+func lookup(obj map[string]interface{}, path ...string) (interface{}, bool) {
+	var value interface{} = obj
+	for _, key := range path {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func number(obj map[string]interface{}, path ...string) int64 {
+	value, _ := lookup(obj, path...)
+	n, _ := value.(float64)
+	return int64(n)
+}
+
+func text(obj map[string]interface{}, path ...string) string {
+	value, _ := lookup(obj, path...)
+	s, _ := value.(string)
+	return s
+}
+
+func asList(value interface{}) []interface{} {
+	list, _ := value.([]interface{})
+	return list
+}
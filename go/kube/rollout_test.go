@@ -0,0 +1,161 @@
+package kube_test
+
+import (
+	"dockerImageMigrator/kube"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scriptedAPI 按最长匹配的路径前缀返回固定的响应，workload 依次返回每次查询时的工作负载状态
+type scriptedAPI struct {
+	workload  []string
+	responses map[string]string
+	calls     int
+}
+
+func (s *scriptedAPI) GetRaw(path string) ([]byte, error) {
+	if strings.HasPrefix(path, "/apis/apps/v1/") {
+		i := s.calls
+		if i >= len(s.workload) {
+			i = len(s.workload) - 1
+		}
+		s.calls++
+		return []byte(s.workload[i]), nil
+	}
+	match := ""
+	for prefix := range s.responses {
+		if strings.HasPrefix(path, prefix) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+	if match == "" {
+		return nil, kube.ErrNotFound
+	}
+	return []byte(s.responses[match]), nil
+}
+
+const rollingDeployment = `{"metadata":{"name":"web","generation":2},
+	"spec":{"replicas":2,"selector":{"matchLabels":{"app":"web"}}},
+	"status":{"observedGeneration":2,"replicas":3,"updatedReplicas":2,"availableReplicas":1}}`
+
+const readyDeployment = `{"metadata":{"name":"web","generation":2},
+	"spec":{"replicas":2,"selector":{"matchLabels":{"app":"web"}}},
+	"status":{"observedGeneration":2,"replicas":2,"updatedReplicas":2,"availableReplicas":2}}`
+
+const healthyPods = `{"items":[
+	{"metadata":{"name":"web-2"},"status":{"phase":"Running","conditions":[{"type":"Ready","status":"True"}],
+		"containerStatuses":[{"name":"web","ready":true,"restartCount":0,"state":{"running":{}}}]}},
+	{"metadata":{"name":"web-1"},"status":{"phase":"Running","conditions":[{"type":"Ready","status":"True"}],
+		"containerStatuses":[{"name":"web","ready":true,"restartCount":1,"state":{"running":{}},
+			"lastState":{"terminated":{"reason":"OOMKilled","exitCode":137}}}]}},
+	{"metadata":{"name":"web-old","deletionTimestamp":"2024-01-01T00:00:00Z"},"status":{"phase":"Running"}}]}`
+
+func TestWaitRolloutReady(t *testing.T) {
+	kube.PollInterval = time.Millisecond
+	api := &scriptedAPI{
+		workload:  []string{`{"metadata":{"generation":2},"status":{"observedGeneration":1}}`, rollingDeployment, readyDeployment},
+		responses: map[string]string{"/api/v1/namespaces/apps/pods?labelSelector=app%3Dweb": healthyPods},
+	}
+
+	rollout := kube.WaitRollout(api, "Deployment", "apps", "web", time.Minute)
+	if !rollout.Ready || rollout.Error != "" {
+		t.Fatalf("rollout 应完成: %+v", rollout)
+	}
+	if api.calls != 3 {
+		t.Errorf("应轮询到就绪为止，实际查询 %d 次", api.calls)
+	}
+	if len(rollout.Pods) != 2 || rollout.Pods[0].Name != "web-1" {
+		t.Fatalf("应忽略正在删除的 Pod 并按名称排序: %+v", rollout.Pods)
+	}
+	if pod := rollout.Pods[0]; pod.Restarts != 1 || len(pod.Problems) != 1 || !strings.Contains(pod.Problems[0], "OOMKilled") {
+		t.Errorf("应报告重启次数与上次退出原因: %+v", pod)
+	}
+}
+
+func TestWaitRolloutFailures(t *testing.T) {
+	kube.PollInterval = time.Millisecond
+	pods := `{"items":[
+		{"metadata":{"name":"web-a"},"status":{"phase":"Pending","conditions":[{"type":"Ready","status":"False"}],
+			"containerStatuses":[{"name":"web","ready":false,"restartCount":0,
+				"state":{"waiting":{"reason":"ImagePullBackOff","message":"Back-off pulling image \"dockerhub.cestc.local/app/web:1.0\""}}}]}},
+		{"metadata":{"name":"web-b"},"status":{"phase":"Running","conditions":[{"type":"Ready","status":"False"}],
+			"containerStatuses":[{"name":"web","ready":false,"restartCount":4,"state":{"running":{}}}]}}]}`
+	events := `{"items":[
+		{"reason":"Unhealthy","message":"Readiness probe failed: HTTP probe failed with statuscode: 503"},
+		{"reason":"Unhealthy","message":"Readiness probe failed: HTTP probe failed with statuscode: 503"},
+		{"reason":"Pulled","message":"ok"}]}`
+
+	api := &scriptedAPI{
+		workload: []string{rollingDeployment},
+		responses: map[string]string{
+			"/api/v1/namespaces/apps/pods?": pods,
+			"/api/v1/namespaces/apps/events?fieldSelector=involvedObject.kind%3DPod%2CinvolvedObject.name%3Dweb-b": events,
+			"/api/v1/namespaces/apps/events?": `{"items":[]}`,
+		},
+	}
+	rollout := kube.WaitRollout(api, "Deployment", "apps", "web", 10*time.Millisecond)
+	if rollout.Ready || !strings.Contains(rollout.Error, "超时") || !strings.Contains(rollout.Error, "旧副本") {
+		t.Fatalf("应超时并给出进度: %+v", rollout)
+	}
+	if len(rollout.Pods) != 2 {
+		t.Fatalf("Pod 数错误: %+v", rollout.Pods)
+	}
+	if problems := strings.Join(rollout.Pods[0].Problems, "\n"); !strings.Contains(problems, "ImagePullBackOff") {
+		t.Errorf("应报告镜像拉取失败: %s", problems)
+	}
+	problems := rollout.Pods[1].Problems
+	if rollout.Pods[1].Restarts != 4 || len(problems) != 2 || !strings.Contains(problems[1], "Readiness probe failed") {
+		t.Errorf("应报告重启次数与探针失败（去重）: %+v", rollout.Pods[1])
+	}
+
+	api = &scriptedAPI{
+		workload: []string{`{"metadata":{"generation":1},"spec":{"selector":{"matchLabels":{"app":"web"}}},
+			"status":{"observedGeneration":1,"conditions":[{"type":"Progressing","reason":"ProgressDeadlineExceeded","message":"ReplicaSet \"web-1\" has timed out progressing."}]}}`},
+		responses: map[string]string{"/api/v1/namespaces/apps/pods?": `{"items":[]}`},
+	}
+	rollout = kube.WaitRollout(api, "Deployment", "apps", "web", time.Minute)
+	if rollout.Ready || !strings.Contains(rollout.Error, "timed out progressing") || api.calls != 1 {
+		t.Errorf("超过进度期限时应立即失败: %+v，查询 %d 次", rollout, api.calls)
+	}
+}
+
+func TestWaitRolloutUntilPastDeadline(t *testing.T) {
+	kube.PollInterval = time.Millisecond
+	responses := map[string]string{"/api/v1/namespaces/apps/pods?": `{"items":[]}`}
+
+	api := &scriptedAPI{workload: []string{rollingDeployment, readyDeployment}, responses: responses}
+	rollout := kube.WaitRolloutUntil(api, "Deployment", "apps", "web", time.Now().Add(-time.Second))
+	if rollout.Ready || !strings.Contains(rollout.Error, "超时") || api.calls != 1 {
+		t.Errorf("截止时间已过时应只检查一次: %+v，查询 %d 次", rollout, api.calls)
+	}
+
+	api = &scriptedAPI{workload: []string{readyDeployment}, responses: responses}
+	if rollout := kube.WaitRolloutUntil(api, "Deployment", "apps", "web", time.Now().Add(-time.Second)); !rollout.Ready {
+		t.Errorf("截止时间已过但已就绪时应成功: %+v", rollout)
+	}
+}
+
+func TestWaitRolloutStatefulSetAndDaemonSet(t *testing.T) {
+	kube.PollInterval = time.Millisecond
+	selector := `"selector":{"matchExpressions":[{"key":"app","operator":"In","values":["db"]},{"key":"canary","operator":"DoesNotExist"}]}`
+	responses := map[string]string{"/api/v1/namespaces/apps/pods?labelSelector=%21canary%2Capp+in+%28db%29": `{"items":[]}`}
+
+	api := &scriptedAPI{workload: []string{
+		`{"metadata":{"generation":3},"spec":{"replicas":2,` + selector + `},
+			"status":{"observedGeneration":3,"readyReplicas":2,"updatedReplicas":1,"currentRevision":"db-1","updateRevision":"db-2"}}`,
+		`{"metadata":{"generation":3},"spec":{"replicas":2,` + selector + `},
+			"status":{"observedGeneration":3,"readyReplicas":2,"updatedReplicas":2,"currentRevision":"db-2","updateRevision":"db-2"}}`,
+	}, responses: responses}
+	if rollout := kube.WaitRollout(api, "StatefulSet", "apps", "db", time.Minute); !rollout.Ready || api.calls != 2 {
+		t.Errorf("StatefulSet 应在 revision 一致后完成: %+v", rollout)
+	}
+
+	api = &scriptedAPI{workload: []string{
+		`{"metadata":{"generation":1},"spec":{` + selector + `},
+			"status":{"observedGeneration":1,"desiredNumberScheduled":3,"updatedNumberScheduled":3,"numberAvailable":3}}`,
+	}, responses: responses}
+	if rollout := kube.WaitRollout(api, "DaemonSet", "apps", "agent", time.Minute); !rollout.Ready || rollout.Error != "" {
+		t.Errorf("DaemonSet 应完成: %+v", rollout)
+	}
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"bytes"
+	"dockerImageMigrator/config"
+	"dockerImageMigrator/kube"
+	"dockerImageMigrator/log"
+	"dockerImageMigrator/ssh"
+	"dockerImageMigrator/workload"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Kubernetes API 客户端，未启用 API 部署时为 nil，deploy 经由 SSH 执行 kubectl
+var kubeClient *kube.Client
+
+// errDeployCancelled 用户在确认 diff 时取消部署
+var errDeployCancelled = errors.New("已取消部署")
+
+// setupKube 按 kubeconfig 创建 API 客户端，useAPI 为 false 且未指定 kubeconfig 与上下文时不启用
+func setupKube(useAPI bool, kubeconfig, context string) error {
+	if !useAPI && kubeconfig == "" && context == "" {
+		return nil
+	}
+	config, err := kube.LoadConfig(config.ExpandHome(kubeconfig), context)
+	if err != nil {
+		return err
+	}
+	kubeClient = kube.NewClient(config)
+	log.Infof("通过 Kubernetes API 部署: %s（上下文 %s）", config.Server, config.Context)
+	return nil
+}
+
+// kubeApplyCommand 描述 API 部署方式，用于报告与部署计划
+func kubeApplyCommand() string {
+	return fmt.Sprintf("server-side apply %s（上下文 %s）", kubeClient.Server, kubeClient.Context)
+}
+
+// kubeApply 将改写后的 yaml 中的对象逐个 apply，List 中的 items 单独 apply，
+// 单个对象失败不影响其余对象。force 为 false 时与其他字段管理者冲突的对象不 apply，记为失败
+func kubeApply(data []byte, force bool) ([]kube.Result, error) {
+	file, err := workload.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []kube.Result
+	failed, conflicts := 0, 0
+	for _, node := range file.Objects() {
+		obj, err := kube.Decode(node)
+		var result kube.Result
+		if err != nil {
+			result = kube.Result{Kind: workload.Kind(node), Name: workload.ScalarValue(workload.Get(node, "metadata"), "name"), Action: kube.Failed, Error: err.Error()}
+		} else {
+			result = kubeClient.Apply(obj, force)
+		}
+		if result.Conflict {
+			conflicts++
+		}
+		if result.Action == kube.Failed {
+			failed++
+			log.Errorf("%v", result)
+		} else {
+			log.Infof("%v", result)
+		}
+		results = append(results, result)
+	}
+	if conflicts > 0 {
+		log.Warnf("%d 个对象的字段由其他管理者设置，确认由迁移工具接管后使用 -force-conflicts 重新部署", conflicts)
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("%d 个对象 apply 失败", failed)
+	}
+	return results, nil
+}
+
+// printObjectResults 按 kubectl 的格式输出每个对象的 apply 结果
+func printObjectResults(w io.Writer, results []kube.Result) {
+	for _, result := range results {
+		if result.Action == kube.Failed {
+			fmt.Fprintf(w, "❌ %v\n", result)
+		} else {
+			fmt.Fprintf(w, "%v\n", result)
+		}
+	}
+}
+
+// cluster apply 前后访问集群的方式：*kube.Client 直接请求 API，*sshKubectl 通过远程主机上的 kubectl
+type cluster interface {
+	kube.RawGetter
+	kube.Cluster
+}
+
+// applyManifest 将改写后的 yaml apply 到集群并等待工作负载 rollout 完成。
+// apply 前先与集群中的对象比较并请求确认（-yes 时跳过）；
+// 启用自动回滚时先记录对象的当前内容，apply 或 rollout 失败后恢复为原内容。
+// pullSecrets 为追加的拉取凭据，启用机器人账号时在确认后签发账号并写入
+func applyManifest(result *deployResult, file *workload.File, localFile string, data []byte, pullSecrets []*pullSecretDoc, opts *deployOptions) error {
+	var c cluster
+	namespace := ""
+	if kubeClient != nil {
+		c, namespace = kubeClient, kubeClient.Namespace
+	} else if opts.rolloutTimeout > 0 || opts.rollback || !opts.assumeYes || opts.pullSecret.Target == config.PullSecretServiceAccount && opts.pullSecret.Name != "" {
+		kubectl, err := dialKubectl()
+		if err != nil {
+			return err
+		}
+		defer kubectl.Close()
+		c, namespace = kubectl, kubectl.namespace()
+	}
+
+	var refs, accounts []kube.ObjectRef
+	var snapshots []*kube.Snapshot
+	if c != nil {
+		objects, err := manifestObjects(data, namespace)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objects {
+			refs = append(refs, obj.ref)
+		}
+		accounts = serviceAccountRefs(objects, opts.pullSecret)
+		if !opts.assumeYes {
+			if result.Diff, err = diffObjects(c, objects); err != nil {
+				return err
+			}
+			if err := confirmDiff(localFile, result.Diff); err != nil {
+				return err
+			}
+		}
+		if opts.rollback {
+			if snapshots, err = kube.Capture(c, append(refs, accounts...)); err != nil {
+				return fmt.Errorf("记录集群中的现有对象失败，未部署（可用 -rollback=false 跳过）: %v", err)
+			}
+		}
+	}
+
+	// 确认部署后才签发机器人账号，此前集群中的 Secret 仍使用旧账号
+	var robots []issuedRobot
+	if opts.pullSecret.Robot && len(pullSecrets) > 0 {
+		if opts.robots == nil {
+			opts.robots = newPullRobots(opts.pullSecret)
+		}
+		if namespace == "" {
+			namespace = defaultNamespace()
+		}
+		var err error
+		if robots, err = opts.robots.issue(opts.pullSecret.Name, pullSecrets, namespace); err != nil {
+			return err
+		}
+		if data, err = file.Bytes(); err != nil {
+			opts.robots.discard(robots)
+			return err
+		}
+	}
+
+	err := addServiceAccountPullSecrets(c, accounts, opts.pullSecret.Name)
+	switch {
+	case err != nil:
+	case kubeClient != nil:
+		result.Command = kubeApplyCommand()
+		result.Objects, err = kubeApply(data, opts.forceConflicts)
+	default:
+		err = sshDeploy(result, file, localFile, data)
+	}
+	if err == nil && opts.rolloutTimeout > 0 {
+		var failed int
+		if result.Rollouts, failed = waitRollouts(c, workloads(refs), opts.rolloutTimeout); failed > 0 {
+			err = fmt.Errorf("%d 个工作负载 rollout 失败", failed)
+		}
+	}
+
+	if robots != nil && err == nil {
+		opts.robots.commit(robots)
+	}
+	if err != nil && snapshots != nil {
+		log.Warnf("部署失败，回滚到 apply 前的状态: %v", err)
+		result.RolledBack = kube.Restore(c, snapshots)
+		failed := 0
+		for _, restored := range result.RolledBack {
+			if restored.Action == kube.Failed {
+				failed++
+				log.Errorf("回滚 %v", restored)
+			} else {
+				log.Infof("回滚 %v", restored)
+			}
+		}
+		if failed > 0 {
+			if robots != nil {
+				log.Warnf("部分对象回滚失败，保留新旧机器人账号")
+			}
+			return fmt.Errorf("%v，%d 个对象回滚失败", err, failed)
+		}
+		// 恢复的 Secret 使用旧账号，新账号不再需要
+		if robots != nil {
+			opts.robots.discard(robots)
+		}
+		return fmt.Errorf("%v，已回滚 %d 个对象", err, len(result.RolledBack))
+	}
+	if err != nil && robots != nil {
+		log.Warnf("部署失败且未回滚，保留新旧机器人账号，下次部署成功后删除旧账号")
+	}
+	return err
+}
+
+// manifestObject yaml 中的一个对象，无法转换为 JSON 时 obj 为 nil，由 apply 报告错误
+type manifestObject struct {
+	ref kube.ObjectRef
+	obj map[string]interface{}
+	pod bool // 含 pod spec
+}
+
+// manifestObjects 列出 yaml 中的对象，未指定命名空间的使用 namespace
+func manifestObjects(data []byte, namespace string) ([]manifestObject, error) {
+	file, err := workload.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	var objects []manifestObject
+	for _, node := range file.Objects() {
+		ref := objectRef(node)
+		if ref.APIVersion == "" || ref.Kind == "" || ref.Name == "" {
+			continue
+		}
+		if ref.Namespace == "" {
+			ref.Namespace = namespace
+		}
+		obj, _ := kube.Decode(node)
+		objects = append(objects, manifestObject{ref, obj, workload.PodSpec(node) != nil})
+	}
+	return objects, nil
+}
+
+// diffObjects 将 yaml 中的对象与集群中的现有内容比较
+func diffObjects(c cluster, objects []manifestObject) ([]*kube.ObjectDiff, error) {
+	var diffs []*kube.ObjectDiff
+	for _, object := range objects {
+		if object.obj == nil {
+			continue
+		}
+		diff, err := kube.Diff(c, object.ref, object.obj)
+		if err != nil {
+			return nil, fmt.Errorf("与集群中的对象比较失败: %v", err)
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+// confirmDiff 输出 diff 并请求确认，对象都没有变化时不再确认
+func confirmDiff(localFile string, diffs []*kube.ObjectDiff) error {
+	printObjectDiffs(os.Stderr, diffs)
+	changed := 0
+	for _, diff := range diffs {
+		if diff.Changed() {
+			changed++
+		}
+	}
+	if changed == 0 {
+		return nil
+	}
+	ok, err := confirm(fmt.Sprintf("将修改集群中的 %d 个对象，确认部署 %s？[y/N] ", changed, localFile))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errDeployCancelled
+	}
+	return nil
+}
+
+// confirm 请求用户确认，测试中替换
+var confirm = confirmStdin
+
+// confirmStdin 从终端读取确认，interactive 模式下与输入路径共用标准输入
+func confirmStdin(prompt string) (bool, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, fmt.Errorf("标准输入不是终端，无法确认部署，请使用 -yes 跳过确认")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := stdinReader.ReadString('\n')
+	if err != nil && line == "" {
+		return false, fmt.Errorf("读取输入失败: %v", err)
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes", nil
+}
+
+// printObjectDiffs 按对象输出与集群的差异，镜像变化单独标出
+func printObjectDiffs(w io.Writer, diffs []*kube.ObjectDiff) {
+	highlight := func(s string) string { return s }
+	if f, ok := w.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		highlight = func(s string) string { return "\033[1;33m" + s + "\033[0m" }
+	}
+
+	fmt.Fprintln(w, "📝 与集群中的对象比较:")
+	unchanged := 0
+	for _, diff := range diffs {
+		switch {
+		case diff.Created:
+			fmt.Fprintf(w, "  + %v（新建）\n", diff.ObjectRef)
+		case len(diff.Changes) == 0:
+			unchanged++
+		default:
+			fmt.Fprintf(w, "  ~ %v\n", diff.ObjectRef)
+			for _, change := range diff.Changes {
+				if change.IsImage() {
+					fmt.Fprintf(w, "    🖼️  %s\n", highlight(change.String()))
+				} else {
+					fmt.Fprintf(w, "      %s\n", change)
+				}
+			}
+		}
+	}
+	if unchanged > 0 {
+		fmt.Fprintf(w, "  = %d 个对象无变化\n", unchanged)
+	}
+}
+
+// workloads 过滤出需要等待 rollout 的工作负载
+func workloads(refs []kube.ObjectRef) []kube.ObjectRef {
+	var result []kube.ObjectRef
+	for _, ref := range refs {
+		if kube.IsWorkload(ref.Kind) {
+			result = append(result, ref)
+		}
+	}
+	return result
+}
+
+// waitRollouts 逐个等待工作负载 rollout 完成，返回未就绪的数量。
+// 所有工作负载共用 timeout，前面的工作负载用完时间后，其余的只检查一次当前状态
+func waitRollouts(api kube.RawGetter, refs []kube.ObjectRef, timeout time.Duration) ([]*kube.Rollout, int) {
+	deadline := time.Now().Add(timeout)
+	var rollouts []*kube.Rollout
+	failed := 0
+	for _, ref := range refs {
+		log.Infof("等待 %s/%s/%s rollout 完成", ref.Namespace, strings.ToLower(ref.Kind), ref.Name)
+		rollout := kube.WaitRolloutUntil(api, ref.Kind, ref.Namespace, ref.Name, deadline)
+		if rollout.Ready {
+			log.Infof("%v rollout 完成: %s", rollout, rollout.Message)
+		} else {
+			failed++
+			log.Errorf("%v rollout 失败: %s", rollout, rollout.Error)
+		}
+		rollouts = append(rollouts, rollout)
+	}
+	return rollouts, failed
+}
+
+// sshKubectl 通过远程主机上的 kubectl 访问集群，用于 SSH 部署前后的快照、rollout 检查与回滚
+type sshKubectl struct {
+	client *ssh.SSHClient
+}
+
+// dialKubectl 连接第一个 SSH 目标
+func dialKubectl() (*sshKubectl, error) {
+	config, err := cfg.SSHConfig("")
+	if err != nil {
+		return nil, err
+	}
+	client, err := ssh.NewSSHClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("创建SSH客户端失败: %v", err)
+	}
+	if err := client.Connect(); err != nil {
+		return nil, fmt.Errorf("连接到远程服务器失败: %v", err)
+	}
+	return &sshKubectl{client: client}, nil
+}
+
+// Close 断开 SSH 连接
+func (k *sshKubectl) Close() error {
+	return k.client.Close()
+}
+
+// kubectl 执行 kubectl 命令，对象或资源类型不存在时返回 kube.ErrNotFound
+func (k *sshKubectl) kubectl(args ...string) (string, error) {
+	return k.kubectlWithInput(nil, args...)
+}
+
+// kubectlWithInput 执行 kubectl 命令，input 作为标准输入
+func (k *sshKubectl) kubectlWithInput(input io.Reader, args ...string) (string, error) {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	output, err := k.client.ExecuteCommandWithInput("kubectl "+strings.Join(quoted, " "), input)
+	if err != nil {
+		if strings.Contains(output, "NotFound") || strings.Contains(output, "doesn't have a resource type") {
+			return output, kube.ErrNotFound
+		}
+		return output, fmt.Errorf("%v: %s", err, strings.TrimSpace(output))
+	}
+	return output, nil
+}
+
+// GetRaw 执行 kubectl get --raw
+func (k *sshKubectl) GetRaw(path string) ([]byte, error) {
+	output, err := k.kubectl("get", "--raw", path)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(output), nil
+}
+
+// namespace 返回远程 kubectl 当前上下文的命名空间，未设置时为 default
+func (k *sshKubectl) namespace() string {
+	output, err := k.kubectl("config", "view", "--minify", "-o", "jsonpath={..namespace}")
+	if namespace := strings.TrimSpace(output); err == nil && namespace != "" {
+		return namespace
+	}
+	return "default"
+}
+
+// Get 执行 kubectl get -o json
+func (k *sshKubectl) Get(apiVersion, kind, namespace, name string) (map[string]interface{}, error) {
+	output, err := k.kubectl("get", kubectlResource(apiVersion, kind), name, "-n", namespace, "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(output), &obj); err != nil {
+		return nil, fmt.Errorf("解析 %s/%s 失败: %v", kind, name, err)
+	}
+	return obj, nil
+}
+
+// Replace 通过标准输入把对象交给 kubectl replace，不在远程主机留下含 Secret 内容的文件
+func (k *sshKubectl) Replace(obj map[string]interface{}) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("序列化对象失败: %v", err)
+	}
+	_, err = k.kubectlWithInput(bytes.NewReader(data), "replace", "-f", "-")
+	return err
+}
+
+// Delete 执行 kubectl delete，不等待对象删除完成
+func (k *sshKubectl) Delete(apiVersion, kind, namespace, name string) error {
+	_, err := k.kubectl("delete", kubectlResource(apiVersion, kind), name, "-n", namespace, "--ignore-not-found", "--wait=false")
+	return err
+}
+
+// kubectlResource 返回 kubectl 使用的完整资源名，如 deployment.v1.apps，避免与同名的 CRD 混淆
+func kubectlResource(apiVersion, kind string) string {
+	group, version, ok := strings.Cut(apiVersion, "/")
+	if !ok {
+		return strings.ToLower(kind)
+	}
+	return strings.ToLower(kind) + "." + version + "." + group
+}
+
+// shellQuote 用单引号括起参数，用于拼接远程命令
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// printRollouts 输出 rollout 结果；失败的工作负载列出全部 Pod，成功的只列出有重启或异常的 Pod
+func printRollouts(w io.Writer, rollouts []*kube.Rollout) {
+	for _, rollout := range rollouts {
+		if rollout.Ready {
+			fmt.Fprintf(w, "✅ %v rollout 完成: %s\n", rollout, rollout.Message)
+		} else {
+			fmt.Fprintf(w, "❌ %v rollout 失败: %s\n", rollout, rollout.Error)
+		}
+		for _, pod := range rollout.Pods {
+			if rollout.Ready && pod.Restarts == 0 && len(pod.Problems) == 0 {
+				continue
+			}
+			ready := "未就绪"
+			if pod.Ready {
+				ready = "就绪"
+			}
+			fmt.Fprintf(w, "   pod %s %s %s，重启 %d 次\n", pod.Name, pod.Phase, ready, pod.Restarts)
+			for _, problem := range pod.Problems {
+				fmt.Fprintf(w, "      ⚠️  %s\n", problem)
+			}
+		}
+	}
+}
+
+// printRolledBack 输出回滚结果
+func printRolledBack(w io.Writer, results []kube.Result) {
+	for _, result := range results {
+		if result.Action == kube.Failed {
+			fmt.Fprintf(w, "❌ 回滚 %v\n", result)
+		} else {
+			fmt.Fprintf(w, "↩️  回滚 %v\n", result)
+		}
+	}
+}
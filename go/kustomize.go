@@ -0,0 +1,111 @@
+package main
+
+import (
+	"dockerImageMigrator/diff"
+	"dockerImageMigrator/kustomize"
+	"dockerImageMigrator/workload"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// kustomizeDir 渲染 kustomization 目录，迁移其中引用的镜像，
+// 并把替换规则写入目标 kustomization 的 images 中，源清单保持不变
+func kustomizeDir(args []string) int {
+	fs := flag.NewFlagSet("kustomize", flag.ContinueOnError)
+	target := fs.String("target", "", "写入 images 的 kustomization 文件，默认为目录中的 kustomization.yaml")
+	noMigrate := fs.Bool("no-migrate", false, "只写入替换规则，不迁移镜像")
+	bin := fs.String("kustomize", "kustomize", "kustomize 可执行文件，指定 kubectl 时使用 kubectl kustomize")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: migrator kustomize [-target kustomization.yaml] [-no-migrate] <目录>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	dir := fs.Arg(0)
+	startJournal("kustomize", args)
+
+	path := *target
+	if path == "" {
+		found, err := kustomize.Find(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitUsage
+		}
+		path = found
+	}
+
+	rendered, err := kustomize.Build(dir, *bin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailed
+	}
+	renderedFile, err := workload.Parse(rendered)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 解析渲染结果失败: %v\n", err)
+		return exitFailed
+	}
+
+	// 迁移渲染结果中的每个镜像，生成对应的替换规则
+	failed := 0
+	seen := make(map[string]bool)
+	var images []kustomize.Image
+	for _, field := range renderedFile.AllImages(imagePathRules) {
+		if seen[field.Value] {
+			continue
+		}
+		seen[field.Value] = true
+
+		resolved, ok := resolveImage(field.Value, !*noMigrate)
+		if !ok {
+			failed++
+		}
+		if resolved == nil {
+			continue
+		}
+		name, _, _ := kustomize.SplitImage(field.Value)
+		newName := resolved.dest.HarborHost + resolved.dest.ImagePath
+		image := kustomize.Image{Name: name, NewName: newName, NewTag: resolved.dest.ImageTag, Digest: resolved.digest}
+		if strings.HasPrefix(image.NewTag, "sha256:") {
+			image.Digest, image.NewTag = image.NewTag, ""
+		}
+		images = append(images, image)
+	}
+
+	file, err := workload.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", path, err)
+		return exitFailed
+	}
+	source, err := file.Bytes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailed
+	}
+	if err := kustomize.SetImages(file, images); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", path, err)
+		return exitFailed
+	}
+	data, err := file.Bytes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailed
+	}
+	fmt.Print(diff.Unified(path, path, source, data))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 写入 %s 失败: %v\n", path, err)
+		return exitFailed
+	}
+
+	fmt.Printf("\n共 %d 个镜像，失败 %d\n", len(images), failed)
+	if failed > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
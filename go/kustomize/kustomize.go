@@ -0,0 +1,142 @@
+package kustomize
+
+import (
+	"bytes"
+	"dockerImageMigrator/workload"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// kustomization 文件的可能名称，与 kustomize 的查找顺序一致
+var fileNames = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// Image kustomization 中 images 的一个条目
+type Image struct {
+	Name    string // 资源中出现的镜像名，不含标签
+	NewName string
+	NewTag  string
+	Digest  string // 非空时优先于 NewTag
+}
+
+// Build 调用 kustomize build 渲染目录，bin 为 kubectl 时使用 kubectl kustomize
+func Build(dir, bin string) ([]byte, error) {
+	if bin == "" {
+		bin = "kustomize"
+	}
+	args := []string{"build", dir}
+	if filepath.Base(bin) == "kubectl" {
+		args = []string{"kustomize", dir}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(bin, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("渲染 %s 失败: %v: %s", dir, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// Find 返回目录中的 kustomization 文件
+func Find(dir string) (string, error) {
+	for _, name := range fileNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("目录 %s 中没有 kustomization 文件", dir)
+}
+
+// SplitImage 将镜像地址拆分为名称、标签与 digest
+func SplitImage(image string) (name, tag, digest string) {
+	if at := strings.LastIndex(image, "@"); at >= 0 {
+		image, digest = image[:at], image[at+1:]
+	}
+	if colon := strings.LastIndex(image, ":"); colon > strings.LastIndex(image, "/") {
+		image, tag = image[:colon], image[colon+1:]
+	}
+	return image, tag, digest
+}
+
+// SetImages 在 kustomization 文档的 images 中写入镜像替换规则。
+// 已有条目（按 newName 或 name 匹配渲染结果中的镜像名）原地更新，其余追加到末尾
+func SetImages(file *workload.File, images []Image) error {
+	if len(file.Docs) == 0 || len(file.Docs[0].Content) == 0 {
+		return fmt.Errorf("kustomization 文件为空")
+	}
+	doc := file.Docs[0]
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("kustomization 文件格式错误")
+	}
+
+	list := workload.Get(root, "images")
+	if list == nil {
+		list = &yaml.Node{Kind: yaml.SequenceNode}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "images"}, list)
+		file.MarkModified(doc)
+	} else if list.Kind != yaml.SequenceNode {
+		return fmt.Errorf("kustomization 中的 images 不是列表")
+	}
+
+	for _, image := range images {
+		entry := findEntry(list, image.Name)
+		if entry == nil {
+			entry = &yaml.Node{Kind: yaml.MappingNode}
+			setField(file, doc, entry, "name", image.Name)
+			list.Content = append(list.Content, entry)
+			file.MarkModified(doc)
+		}
+		setField(file, doc, entry, "newName", image.NewName)
+		if image.Digest != "" {
+			setField(file, doc, entry, "digest", image.Digest)
+			removeField(file, doc, entry, "newTag")
+		} else {
+			setField(file, doc, entry, "newTag", image.NewTag)
+			removeField(file, doc, entry, "digest")
+		}
+	}
+	return nil
+}
+
+// findEntry 查找替换后名称为 name 的条目
+func findEntry(list *yaml.Node, name string) *yaml.Node {
+	for _, entry := range list.Content {
+		newName := workload.ScalarValue(entry, "newName")
+		if newName == "" {
+			newName = workload.ScalarValue(entry, "name")
+		}
+		if newName == name {
+			return entry
+		}
+	}
+	return nil
+}
+
+// setField 设置条目中的字段，已有字段原地替换，新增字段时标记文档需要重新序列化
+func setField(file *workload.File, doc, entry *yaml.Node, key, value string) {
+	if node := workload.Get(entry, key); node != nil && node.Kind == yaml.ScalarNode {
+		file.Set(node, value)
+		return
+	}
+	entry.Content = append(entry.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+	file.MarkModified(doc)
+}
+
+func removeField(file *workload.File, doc, entry *yaml.Node, key string) {
+	for i := 0; i+1 < len(entry.Content); i += 2 {
+		if entry.Content[i].Value == key {
+			entry.Content = append(entry.Content[:i], entry.Content[i+2:]...)
+			file.MarkModified(doc)
+			return
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package kustomize
+
+import (
+	"dockerImageMigrator/workload"
+	"testing"
+)
+
+func TestSplitImage(t *testing.T) {
+	tests := []struct {
+		image, name, tag, digest string
+	}{
+		{"registry.local/demo/app:1.0", "registry.local/demo/app", "1.0", ""},
+		{"registry.local:5000/demo/app", "registry.local:5000/demo/app", "", ""},
+		{"registry.local/demo/app:1.0@sha256:abc", "registry.local/demo/app", "1.0", "sha256:abc"},
+		{"registry.local/demo/app@sha256:abc", "registry.local/demo/app", "", "sha256:abc"},
+	}
+	for _, tt := range tests {
+		name, tag, digest := SplitImage(tt.image)
+		if name != tt.name || tag != tt.tag || digest != tt.digest {
+			t.Errorf("%s: 得到 (%s, %s, %s)", tt.image, name, tag, digest)
+		}
+	}
+}
+
+func TestSetImagesUpdatesExisting(t *testing.T) {
+	source := `# 生产环境
+resources:
+  - ../../base
+images:
+  - name: app
+    newName: registry.local/demo/app   # 覆盖 base 中的镜像
+    newTag: "1.0"
+`
+	f, err := workload.Parse([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SetImages(f, []Image{{Name: "registry.local/demo/app", NewName: "harbor.local/demo/app", NewTag: "1.0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# 生产环境
+resources:
+  - ../../base
+images:
+  - name: app
+    newName: harbor.local/demo/app   # 覆盖 base 中的镜像
+    newTag: "1.0"
+`
+	if string(data) != want {
+		t.Fatalf("kustomization 不正确:\n%s", data)
+	}
+}
+
+func TestSetImagesAppends(t *testing.T) {
+	f, err := workload.Parse([]byte(`resources:
+  - deployment.yaml
+images:
+  - name: registry.local/demo/app
+    newTag: "1.0"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SetImages(f, []Image{
+		{Name: "registry.local/demo/app", NewName: "harbor.local/demo/app", Digest: "sha256:abc"},
+		{Name: "registry.local/demo/sidecar", NewName: "harbor.local/demo/sidecar", NewTag: "2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `resources:
+  - deployment.yaml
+images:
+  - name: registry.local/demo/app
+    newName: harbor.local/demo/app
+    digest: sha256:abc
+  - name: registry.local/demo/sidecar
+    newName: harbor.local/demo/sidecar
+    newTag: "2"
+`
+	if string(data) != want {
+		t.Fatalf("kustomization 不正确:\n%s", data)
+	}
+}
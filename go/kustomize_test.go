@@ -0,0 +1,68 @@
+package main
+
+import (
+	"dockerImageMigrator/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseImageDockerHubShortName(t *testing.T) {
+	tests := map[string][3]string{
+		"nginx:1.25":                    {"https://registry-1.docker.io", "/library/nginx", "1.25"},
+		"bitnami/redis:7":               {"https://registry-1.docker.io", "/bitnami/redis", "7"},
+		"registry.local/demo/app:1.0":   {"https://registry.local", "/demo/app", "1.0"},
+		"http://registry.local/app:1.0": {"http://registry.local", "/app", "1.0"},
+	}
+	for image, want := range tests {
+		registry, path, tag, err := parseImage(image)
+		if err != nil || registry != want[0] || path != want[1] || tag != want[2] {
+			t.Errorf("parseImage(%q) = %q, %q, %q, %v，期望 %v", image, registry, path, tag, err, want)
+		}
+	}
+}
+
+func TestKustomizeDockerHubShortName(t *testing.T) {
+	dir := t.TempDir()
+	kustomization := filepath.Join(dir, "kustomization.yaml")
+	if err := os.WriteFile(kustomization, []byte("resources:\n  - deployment.yaml\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 用脚本代替 kustomize，输出引用 Docker Hub 简写镜像的渲染结果
+	bin := filepath.Join(dir, "kustomize")
+	script := `#!/bin/sh
+cat <<'EOF'
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx:1.25
+EOF
+`
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	oldCfg := cfg
+	t.Cleanup(func() { cfg = oldCfg })
+	cfg = &config.Config{Destination: config.Destination{Host: "harbor.local"}, Journal: "off"}
+
+	if code := kustomizeDir([]string{"-no-migrate", "-kustomize", bin, dir}); code != exitOK {
+		t.Fatalf("退出码 %d", code)
+	}
+	data, err := os.ReadFile(kustomization)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"name: nginx", "newName: harbor.local/library/nginx", "newTag: \"1.25\""} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("kustomization 中缺少 %q:\n%s", want, data)
+		}
+	}
+}
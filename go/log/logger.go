@@ -3,6 +3,7 @@ package log
 import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"io"
 	"os"
 	"path/filepath"
 	"sync"
@@ -25,8 +26,14 @@ var (
 
 var once sync.Once
 
-// Init 初始化日志系统
+// Init 初始化日志系统，日志同时输出到标准输出与日志文件
 func Init() {
+	InitConsole(os.Stdout)
+}
+
+// InitConsole 初始化日志系统，控制台日志写入 console，
+// 子命令以标准输出输出结果时传入 os.Stderr
+func InitConsole(console io.Writer) {
 	once.Do(func() {
 		// 创建日志目录
 		logDir := "logs"
@@ -60,7 +67,7 @@ func Init() {
 
 		core := zapcore.NewCore(
 			zapcore.NewConsoleEncoder(encoderConfig), // 使用Console编码器替代JSON编码器
-			zapcore.NewMultiWriteSyncer(zapcore.AddSync(os.Stdout), zapcore.AddSync(logFile)),
+			zapcore.NewMultiWriteSyncer(zapcore.AddSync(console), zapcore.AddSync(logFile)),
 			zap.NewAtomicLevelAt(zap.DebugLevel),
 		)
 
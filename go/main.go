@@ -1,229 +1,331 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
+	"dockerImageMigrator/config"
+	"dockerImageMigrator/credentials"
 	"dockerImageMigrator/harbor"
+	"dockerImageMigrator/journal"
 	"dockerImageMigrator/log"
-	"dockerImageMigrator/ssh"
+	"dockerImageMigrator/mapping"
+	"dockerImageMigrator/workload"
 	"fmt"
-	"gopkg.in/yaml.v3"
-	"io"
 	"net/url"
 	"os"
-	"path/filepath"
 	"strings"
-	"time"
 )
 
-// 修改 main 函数来使用新的结构体
-func deploy(localFile string) {
-	log.Info(">>>>>> 开始部署", localFile)
-	dest := harbor.HarborConfig{
-		HarborApi:  "https://10.100.100.21:10080",
-		HarborHost: "dockerhub.cestc.local",
-		Username:   "admin",
-		Password:   "Harbor12345",
+// 运行配置：仓库凭据、目标 Harbor 与 SSH 目标
+var cfg *config.Config
+
+// 源仓库凭据解析：docker 配置中的 credHelpers/credsStore/auths，最后是配置文件中的条目
+var credentialResolver *credentials.Resolver
+
+// newCredentialResolver 根据配置创建凭据解析器
+func newCredentialResolver(cfg *config.Config) (*credentials.Resolver, error) {
+	path := cfg.DockerConfig
+	if path == "" {
+		path = credentials.DefaultDockerConfigPath()
+	}
+	docker, err := credentials.LoadDockerConfig(path)
+	if err != nil {
+		return nil, err
 	}
+	return credentials.NewResolver(docker, func(host string) (credentials.Credential, bool) {
+		registry := cfg.Registry(host)
+		if registry == nil || (registry.Username == "" && registry.Password == "") {
+			return credentials.Credential{}, false
+		}
+		return credentials.Credential{Username: registry.Username, Password: registry.Password}, true
+	}), nil
+}
 
-	// 读取文件内容
-	yamlFile, err := os.ReadFile(localFile)
+// sourceHarbor 生成源仓库配置，凭据按仓库主机名解析
+func sourceHarbor(registry, path, tag string) harbor.HarborConfig {
+	source := cfg.SourceHarbor(registry, path, tag)
+	cred, ok, err := credentialResolver.Resolve(registry)
 	if err != nil {
-		log.Errorf("读取yaml文件失败: %v", err)
+		log.Errorf("获取 %s 的凭据失败: %v", registry, err)
+	} else if ok {
+		source.Username = cred.Username
+		source.Password = cred.Password
 	}
+	return source
+}
 
-	decoder := yaml.NewDecoder(bytes.NewReader(yamlFile))
-	var finalDocs []map[string]interface{}
+// 镜像映射规则，未配置时保持源路径与标签
+var imageMapper *mapping.Mapper
 
-	for {
-		var parsedDoc map[string]interface{}
-		err := decoder.Decode(&parsedDoc)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			log.Errorf("解码YAML文档失败: %v", err)
-		}
+// 自定义资源的镜像字段规则，未配置时只处理内置工作负载
+var imagePathRules *workload.PathRules
 
-		finalDocs = append(finalDocs, parsedDoc)
+// optionalFile 返回环境变量指定的文件，未指定时若当前目录存在 defaultName 则返回它
+func optionalFile(env, defaultName string) string {
+	if file := os.Getenv(env); file != "" {
+		return file
+	}
+	if _, err := os.Stat(defaultName); err == nil {
+		return defaultName
+	}
+	return ""
+}
 
-		// 只处理 Deployment 类型的文档
-		kind, ok := parsedDoc["kind"].(string)
-		if !ok || kind != "Deployment" {
-			continue
+// loadRules 加载镜像映射规则（MIGRATOR_RULES 或 rules.yaml）
+// 与自定义资源镜像字段规则（MIGRATOR_IMAGE_PATHS 或 image-paths.yaml）
+func loadRules() error {
+	if rulesFile := optionalFile("MIGRATOR_RULES", "rules.yaml"); rulesFile != "" {
+		mapper, err := mapping.Load(rulesFile)
+		if err != nil {
+			return err
 		}
+		log.Infof("已加载镜像映射规则 %s，共 %d 条", rulesFile, len(mapper.Rules))
+		imageMapper = mapper
+	}
 
-		// 获取 containers 部分
-		spec, ok := parsedDoc["spec"].(map[string]interface{})
-		if !ok {
-			continue
-		}
-		template, ok := spec["template"].(map[string]interface{})
-		if !ok {
-			continue
-		}
-		podSpec, ok := template["spec"].(map[string]interface{})
-		if !ok {
-			continue
-		}
-		containers, ok := podSpec["containers"].([]interface{})
-		if !ok {
-			continue
+	if pathsFile := optionalFile("MIGRATOR_IMAGE_PATHS", "image-paths.yaml"); pathsFile != "" {
+		rules, err := workload.LoadPathRules(pathsFile)
+		if err != nil {
+			return err
 		}
+		log.Infof("已加载自定义资源镜像字段规则 %s，共 %d 条", pathsFile, len(rules.Resources))
+		imagePathRules = rules
+	}
+	return nil
+}
 
-		// 处理每个容器的镜像
-		for j, container := range containers {
-			containerMap, ok := container.(map[string]interface{})
-			if !ok {
-				continue
-			}
-			imageRaw, exists := containerMap["image"].(string)
-			if !exists {
-				continue
-			}
+// parseImage 将镜像地址拆分为 registry（带协议）、路径与标签，
+// 形如 app@sha256:... 的地址返回 digest 作为标签；未写仓库主机的 Docker Hub 简写（如 nginx:1.25）先补全
+func parseImage(imageRaw string) (registry, path, tag string, err error) {
+	if !strings.HasPrefix(imageRaw, "http://") && !strings.HasPrefix(imageRaw, "https://") {
+		imageRaw = "https://" + workload.NormalizeImage(imageRaw)
+	}
 
-			// 处理镜像地址
-			if !strings.HasPrefix(imageRaw, "http://") && !strings.HasPrefix(imageRaw, "https://") {
-				imageRaw = "https://" + imageRaw
-			}
+	var imageURLStr string
+	if at := strings.LastIndex(imageRaw, "@"); at > strings.LastIndex(imageRaw, "/") {
+		imageURLStr = imageRaw[:at]
+		tag = imageRaw[at+1:]
+	} else {
+		colonIndex := strings.LastIndex(imageRaw, ":")
+		if colonIndex == -1 || colonIndex < strings.LastIndex(imageRaw, "/") {
+			return "", "", "", fmt.Errorf("镜像地址 %s 缺少标签部分", imageRaw)
+		}
+		imageURLStr = imageRaw[:colonIndex]
+		tag = imageRaw[colonIndex+1:]
+	}
 
-			colonIndex := strings.LastIndex(imageRaw, ":")
-			if colonIndex == -1 {
-				log.Errorf("镜像地址 %s 缺少标签部分", imageRaw)
-			}
-			imageURLStr := imageRaw[:colonIndex]
-			tag := imageRaw[colonIndex+1:]
+	imageURL, err := url.ParseRequestURI(imageURLStr)
+	if err != nil {
+		return "", "", "", fmt.Errorf("解析URL失败: %v", err)
+	}
+	return imageURL.Scheme + "://" + imageURL.Host, imageURL.Path, tag, nil
+}
 
-			imageURL, err := url.ParseRequestURI(imageURLStr)
-			if err != nil {
-				log.Errorf("解析URL失败: %v", err)
-			}
-			registry := imageURL.Scheme + "://" + imageURL.Host
-			path := imageURL.Path
+// formatImage 拼接镜像地址，reference 为 digest 时使用 @ 分隔
+func formatImage(host, path, reference string) string {
+	if strings.HasPrefix(reference, "sha256:") {
+		return fmt.Sprintf("%s%s@%s", host, path, reference)
+	}
+	return fmt.Sprintf("%s%s:%s", host, path, reference)
+}
 
-			log.Infof("开始处理 registry: %v, path: %v, tag: %v", registry, path, tag)
+// destImage 根据映射规则生成目标镜像配置
+func destImage(path, tag string) (harbor.HarborConfig, mapping.Target) {
+	target := imageMapper.Map(path, tag)
+	dest := cfg.DestHarbor()
+	dest.ImagePath = target.Path
+	dest.ImageTag = target.Tag
+	return dest, target
+}
 
-			exist, err := harbor.CheckImageExists(dest.HarborApi, path, tag, dest.Username, dest.Password)
-			if err != nil {
-				log.Errorf("检查镜像 %s 失败: %v", imageRaw, err)
-			}
+// resolvedImage 源镜像对应的目标镜像
+type resolvedImage struct {
+	dest   harbor.HarborConfig
+	digest string // 按规则固定 digest 时目标镜像的 digest
+	image  string // 改写后的镜像地址
+}
 
-			dest.ImagePath = path
-			dest.ImageTag = tag
-
-			if !exist {
-				log.Infof("检测到 %v 里不存在，现在开始推送镜像", dest.HarborApi)
-				source := harbor.HarborConfig{
-					HarborApi:  registry,
-					HarborHost: registry,
-					Username:   "cmq",
-					Password:   "Cmq12345",
-					ImagePath:  path,
-					ImageTag:   tag,
-				}
-				if err := harbor.MigrateImage(source, dest); err != nil {
-					log.Errorf("[ERROR] 镜像 %v 迁移失败: %v", imageRaw, err)
-				}
-			} else {
-				log.Infof("检测到镜像已存在，跳过")
-			}
+// resolveImage 按映射规则计算目标镜像，migrate 为 true 时同时迁移镜像。
+// 地址无法解析时返回 nil，迁移失败时仍返回目标镜像，ok 为 false
+func resolveImage(imageRaw string, migrate bool) (resolved *resolvedImage, ok bool) {
+	// 处理镜像地址
+	registry, path, tag, err := parseImage(imageRaw)
+	if err != nil {
+		log.Errorf("%v", err)
+		return nil, false
+	}
 
-			// 修改镜像地址
-			newImage := fmt.Sprintf("%s%s:%s", dest.HarborHost, dest.ImagePath, dest.ImageTag)
-			log.Infof("将配置文件中镜像地址%s修改为: %v", registry, newImage)
-			containerMap["image"] = newImage
-			containers[j] = containerMap
-		}
+	log.Infof("开始处理 registry: %v, path: %v, tag: %v", registry, path, tag)
 
-		// 更新文档中的容器信息
-		podSpec["containers"] = containers
-		template["spec"] = podSpec
-		spec["template"] = template
-		parsedDoc["spec"] = spec
+	dest, target := destImage(path, tag)
+	if dest.ImagePath != path || dest.ImageTag != tag {
+		log.Infof("根据映射规则，目标镜像为 %s:%s", dest.ImagePath, dest.ImageTag)
 	}
 
-	// 将修改后的文档重新组合成YAML字符串
-	var yamlBuilder strings.Builder
-	encoder := yaml.NewEncoder(&yamlBuilder)
-	defer encoder.Close()
-	for _, doc := range finalDocs {
-		if err := encoder.Encode(doc); err != nil {
-			log.Errorf("序列化YAML文档失败: %v", err)
-		}
+	ok = true
+	if migrate {
+		ok = migrateImage(imageRaw, registry, path, tag, dest)
 	}
 
-	yamlString := yamlBuilder.String()
+	resolved = &resolvedImage{dest: dest, image: formatImage(dest.HarborHost, dest.ImagePath, dest.ImageTag)}
+	if target.PinDigest {
+		if digest, err := harbor.ManifestDigest(dest); err != nil {
+			log.Errorf("获取镜像 %s 的 digest 失败，保留标签: %v", resolved.image, err)
+		} else {
+			resolved.digest = digest
+			resolved.image = formatImage(dest.HarborHost, dest.ImagePath, digest)
+		}
+	}
+	log.Infof("将配置文件中镜像地址%s修改为: %v", registry, resolved.image)
+	return resolved, ok
+}
 
-	// SSH相关操作
-	config := ssh.SSHConfig{
-		Host:      "10.100.100.21",
-		Port:      22,
-		Username:  "root",
-		Password:  "Cestc@2024",
-		RemoteDir: "/opt/baseline/tmp/",
+// resolveResult 调用 resolveImage 并生成处理结果
+func resolveResult(imageRaw string, migrate bool) (imageResult, *resolvedImage) {
+	resolved, ok := resolveImage(imageRaw, migrate)
+	result := imageResult{Source: imageRaw, OK: ok}
+	switch {
+	case resolved == nil:
+		result.Error = "无法解析镜像地址"
+	case !ok:
+		result.Error = "镜像迁移失败"
 	}
-	// 创建SSH客户端
-	client, err := ssh.NewSSHClient(&config)
-	if err != nil {
-		log.Errorf("创建SSH客户端失败: %v", err)
+	if resolved != nil {
+		result.Dest = resolved.image
 	}
-	// 连接到远程服务器
-	if err := client.Connect(); err != nil {
-		log.Errorf("连接到远程服务器失败: %v", err)
+	return result, resolved
+}
+
+// rewriteImages 将文件中的镜像地址改为目标仓库地址，migrate 为 false 时只改写不迁移，
+// 返回每个镜像的处理结果
+func rewriteImages(file *workload.File, migrate bool) []imageResult {
+	var results []imageResult
+	// 处理每个容器（包括 initContainers 与 ephemeralContainers）、自定义资源及 compose 服务中的镜像
+	for _, field := range file.AllImages(imagePathRules) {
+		result, resolved := resolveResult(field.Value, migrate)
+		if resolved != nil {
+			field.Set(resolved.image)
+		}
+		results = append(results, result)
 	}
-	defer client.Close()
+	return results
+}
 
-	// 1. 获取文件名（带后缀）
-	fileName := filepath.Base(localFile) // "backend-portal-front.yaml"
-	// 2. 分离文件名和后缀
-	name := strings.TrimSuffix(fileName, filepath.Ext(fileName)) // "backend-portal-front"
-	ext := filepath.Ext(fileName)                                // ".yaml"
+// migrateImage 目标仓库中不存在时迁移镜像，返回是否成功；启用迁移日志时记录镜像状态
+func migrateImage(imageRaw, registry, path, tag string, dest harbor.HarborConfig) bool {
+	destRef := formatImage(dest.HarborHost, dest.ImagePath, dest.ImageTag)
+	if imageDone(imageRaw, destRef) {
+		log.Infof("镜像已在上次运行中迁移完成，跳过")
+		return true
+	}
+	recordImage(imageRaw, destRef, journal.Planned, nil)
 
-	// 3. 在文件名和后缀之间添加内容
-	remotePath := fmt.Sprintf("%s%s_%s%s", config.RemoteDir, name, time.Now().Format("20060102150405"), ext)
+	exist, err := harbor.NewHTTPRegistryFromConfig(dest).ManifestExists(dest.ImagePath, dest.ImageTag)
+	if err != nil {
+		log.Errorf("检查镜像 %s 失败: %v", imageRaw, err)
+	}
 
-	log.Infof("正在传输文件: %s\n", fileName)
-	if err := client.WriteStringToFile(yamlString, remotePath); err != nil {
-		log.Infof("文件传输失败 %s: %v\n", fileName, err)
-	} else {
-		log.Infof("成功传输文件 %s 到 %s\n", fileName, remotePath)
+	if exist {
+		log.Infof("检测到镜像已存在，跳过")
+		recordImage(imageRaw, destRef, journal.Done, nil)
+		return true
 	}
 
-	output, err := client.ExecuteCommand("kubectl apply -f " + remotePath)
-	if err != nil {
-		log.Infof("执行命令失败: %v\n", err)
-	} else {
-		log.Infof("命令输出:\n%s\n", output)
+	log.Infof("检测到 %v 里不存在，现在开始推送镜像", dest.HarborApi)
+	recordImage(imageRaw, destRef, journal.Transferring, nil)
+	if err := harbor.MigrateImageWithJournal(sourceHarbor(registry, path, tag), dest, blobJournal(dest)); err != nil {
+		log.Errorf("[ERROR] 镜像 %v 迁移失败: %v", imageRaw, err)
+		recordImage(imageRaw, destRef, journal.Failed, err)
+		return false
 	}
+	recordImage(imageRaw, destRef, journal.Done, nil)
+	return true
+}
 
-	fmt.Printf("👌 %s 部署结束\n\n\n", localFile)
+// configFlag 从子命令之前的参数中取出 --config <文件>（或 --config=<文件>、-config）
+func configFlag(args []string) (rest []string, configFile string) {
+	for len(args) > 0 {
+		arg := args[0]
+		name, value, hasValue := strings.Cut(arg, "=")
+		if name != "--config" && name != "-config" {
+			break
+		}
+		if hasValue {
+			configFile = value
+			args = args[1:]
+			continue
+		}
+		if len(args) < 2 {
+			break
+		}
+		configFile = args[1]
+		args = args[2:]
+	}
+	return args, configFile
 }
 
 func main() {
-	// 初始化日志
-	log.Init()
-
-	const promptMessage = ">>> 请拖拽k8s yaml文件进来"
+	args, configFile := configFlag(os.Args[1:])
+	if len(args) > 0 && (args[0] == "help" || args[0] == "-h" || args[0] == "--help") {
+		usage(os.Stdout)
+		return
+	}
 
-	fmt.Println(promptMessage)
-	scanner := bufio.NewScanner(os.Stdin)
+	// 初始化日志，子命令的结果写到标准输出，日志改写到标准错误
+	if len(args) == 0 || args[0] == "interactive" {
+		log.Init()
+	} else {
+		log.InitConsole(os.Stderr)
+	}
 
-	for scanner.Scan() {
-		input := scanner.Text()
+	if err := loadRules(); err != nil {
+		log.Errorf("%v", err)
+		os.Exit(exitUsage)
+	}
 
-		if strings.ToLower(input) == "exit" {
-			break
+	// 本地镜像仓库服务与保险库管理不需要迁移配置
+	if len(args) > 0 {
+		switch args[0] {
+		case "serve":
+			if err := serve(args[1:]); err != nil {
+				log.Errorf("镜像仓库服务退出: %v", err)
+				os.Exit(1)
+			}
+			return
+		case "secrets":
+			os.Exit(secrets(args[1:]))
 		}
+	}
 
-		// 处理所有输入的文件
-		for _, path := range strings.Fields(input) {
-			deploy(path)
+	// 不带子命令时进入交互模式
+	c := findCommand("interactive")
+	if len(args) > 0 {
+		if c = findCommand(args[0]); c == nil {
+			fmt.Fprintf(os.Stderr, "❌ 未知的子命令 %s\n\n", args[0])
+			usage(os.Stderr)
+			os.Exit(exitUsage)
 		}
-
-		fmt.Println(promptMessage)
+		args = args[1:]
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Infof("读取输入错误: %v\n", err)
+	loaded, err := config.Load(config.Find(configFile))
+	if err != nil {
+		log.Errorf("%v", err)
+		os.Exit(exitUsage)
 	}
+	cfg = loaded
+	if cfg.Path != "" {
+		log.Infof("已加载配置文件 %s", cfg.Path)
+	}
+	if err := resolveConfigSecrets(); err != nil {
+		log.Errorf("%v", err)
+		os.Exit(exitUsage)
+	}
+	credentialResolver, err = newCredentialResolver(cfg)
+	if err != nil {
+		log.Errorf("%v", err)
+		os.Exit(exitUsage)
+	}
+
+	code := c.run(args)
+	finishJournal(code)
+	os.Exit(code)
 }
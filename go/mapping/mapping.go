@@ -0,0 +1,169 @@
+package mapping
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// TagRule 标签转换规则，先做正则替换，再添加前后缀
+type TagRule struct {
+	Regex   string `yaml:"regex"`
+	Replace string `yaml:"replace"`
+	Prefix  string `yaml:"prefix"`
+	Suffix  string `yaml:"suffix"`
+	// Digest 为 true 时，写回 yaml 的镜像地址使用 digest 而不是标签
+	Digest bool `yaml:"digest"`
+
+	regex *regexp.Regexp
+}
+
+// Rule 一条仓库路径映射规则，Prefix、Project、Regex 最多指定一个，都不指定时匹配所有镜像。
+// 路径不带前导斜杠，如 digital/dev/portal-front
+type Rule struct {
+	// Prefix 前缀替换：digital/dev/ -> prod-mirror/
+	Prefix string `yaml:"prefix"`
+	// Project 项目重映射：digital/dev/* -> prod-mirror/*
+	Project string `yaml:"project"`
+	// Regex 正则替换，Replace 中可以使用 $1 等分组引用
+	Regex   string   `yaml:"regex"`
+	Replace string   `yaml:"replace"`
+	Tag     *TagRule `yaml:"tag"`
+
+	regex *regexp.Regexp
+}
+
+// Mapper 按顺序匹配规则，第一条命中的规则生效；nil Mapper 保持原样
+type Mapper struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+// Target 映射后的目标镜像
+type Target struct {
+	Path      string // 带前导斜杠的仓库路径，与 HarborConfig.ImagePath 一致
+	Tag       string
+	PinDigest bool // 写回 yaml 时使用 digest
+}
+
+// Load 从 yaml 文件加载映射规则
+func Load(path string) (*Mapper, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取映射规则文件失败: %v", err)
+	}
+	var m Mapper
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("解析映射规则文件 %s 失败: %v", path, err)
+	}
+	if err := m.Compile(); err != nil {
+		return nil, fmt.Errorf("映射规则文件 %s 无效: %v", path, err)
+	}
+	return &m, nil
+}
+
+// Compile 校验规则并预编译正则表达式
+func (m *Mapper) Compile() error {
+	for i, rule := range m.Rules {
+		matchers := 0
+		for _, s := range []string{rule.Prefix, rule.Project, rule.Regex} {
+			if s != "" {
+				matchers++
+			}
+		}
+		if matchers > 1 {
+			return fmt.Errorf("第 %d 条规则只能指定 prefix、project、regex 之一", i+1)
+		}
+
+		if rule.Project != "" {
+			if !strings.HasSuffix(rule.Project, "/*") {
+				return fmt.Errorf("第 %d 条规则的 project 必须以 /* 结尾: %s", i+1, rule.Project)
+			}
+			if rule.Replace != "" && !strings.HasSuffix(rule.Replace, "/*") {
+				return fmt.Errorf("第 %d 条规则的 replace 必须以 /* 结尾: %s", i+1, rule.Replace)
+			}
+		}
+
+		if rule.Regex != "" {
+			re, err := regexp.Compile(rule.Regex)
+			if err != nil {
+				return fmt.Errorf("第 %d 条规则的正则表达式无效: %v", i+1, err)
+			}
+			rule.regex = re
+		}
+
+		if rule.Tag != nil && rule.Tag.Regex != "" {
+			re, err := regexp.Compile(rule.Tag.Regex)
+			if err != nil {
+				return fmt.Errorf("第 %d 条规则的标签正则表达式无效: %v", i+1, err)
+			}
+			rule.Tag.regex = re
+		}
+	}
+	return nil
+}
+
+// Map 计算镜像在目标仓库中的路径与标签，path 可以带前导斜杠，
+// tag 为 sha256: 开头的 digest 时不做标签转换
+func (m *Mapper) Map(path, tag string) Target {
+	name := strings.Trim(path, "/")
+	target := Target{Path: "/" + name, Tag: tag}
+	if m == nil {
+		return target
+	}
+
+	for _, rule := range m.Rules {
+		mapped, ok := rule.mapPath(name)
+		if !ok {
+			continue
+		}
+		target.Path = "/" + strings.Trim(mapped, "/")
+		if rule.Tag != nil {
+			if !strings.HasPrefix(tag, "sha256:") {
+				target.Tag = rule.Tag.apply(tag)
+			}
+			target.PinDigest = rule.Tag.Digest
+		}
+		return target
+	}
+	return target
+}
+
+// mapPath 规则命中时返回替换后的路径
+func (r *Rule) mapPath(name string) (string, bool) {
+	switch {
+	case r.Prefix != "":
+		if !strings.HasPrefix(name, r.Prefix) {
+			return "", false
+		}
+		return r.Replace + strings.TrimPrefix(name, r.Prefix), true
+
+	case r.Project != "":
+		prefix := strings.TrimSuffix(r.Project, "*")
+		if !strings.HasPrefix(name, prefix) {
+			return "", false
+		}
+		replace := prefix
+		if r.Replace != "" {
+			replace = strings.TrimSuffix(r.Replace, "*")
+		}
+		return replace + strings.TrimPrefix(name, prefix), true
+
+	case r.regex != nil:
+		if !r.regex.MatchString(name) {
+			return "", false
+		}
+		return r.regex.ReplaceAllString(name, r.Replace), true
+
+	default:
+		return name, true
+	}
+}
+
+func (t *TagRule) apply(tag string) string {
+	if t.regex != nil {
+		tag = t.regex.ReplaceAllString(tag, t.Replace)
+	}
+	return t.Prefix + tag + t.Suffix
+}
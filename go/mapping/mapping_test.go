@@ -0,0 +1,66 @@
+package mapping
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMapperMap(t *testing.T) {
+	m := &Mapper{Rules: []*Rule{
+		{Project: "digital/dev/*", Replace: "prod-mirror/*", Tag: &TagRule{Suffix: "-prod"}},
+		{Prefix: "library/", Replace: "mirror/library/"},
+		{Regex: `^team-(\w+)/(.*)$`, Replace: "teams/$1/$2", Tag: &TagRule{Regex: `^v(.*)$`, Replace: "$1", Digest: true}},
+	}}
+	if err := m.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path, tag string
+		want      Target
+	}{
+		{"/digital/dev/portal-front", "e173e09b5", Target{Path: "/prod-mirror/portal-front", Tag: "e173e09b5-prod"}},
+		{"/library/nginx", "1.25", Target{Path: "/mirror/library/nginx", Tag: "1.25"}},
+		{"/team-a/api", "v1.2.0", Target{Path: "/teams/a/api", Tag: "1.2.0", PinDigest: true}},
+		{"/other/app", "v1", Target{Path: "/other/app", Tag: "v1"}},
+		{"/digital/dev/app", "sha256:abc", Target{Path: "/prod-mirror/app", Tag: "sha256:abc"}},
+	}
+	for _, tt := range tests {
+		if got := m.Map(tt.path, tt.tag); got != tt.want {
+			t.Errorf("Map(%q, %q) = %+v, 期望 %+v", tt.path, tt.tag, got, tt.want)
+		}
+	}
+
+	var empty *Mapper
+	if got := empty.Map("digital/dev/app", "v1"); got != (Target{Path: "/digital/dev/app", Tag: "v1"}) {
+		t.Errorf("nil Mapper 应保持原样，得到 %+v", got)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := map[string]string{
+		"多个匹配条件":        "rules:\n  - prefix: a/\n    regex: b\n",
+		"project 缺少通配符": "rules:\n  - project: digital/dev\n",
+		"正则无效":          "rules:\n  - regex: '('\n",
+	}
+	for name, content := range tests {
+		path := filepath.Join(t.TempDir(), "rules.yaml")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("%s: 期望加载失败", name)
+		}
+	}
+}
+
+func TestLoadExample(t *testing.T) {
+	m, err := Load("../rules.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Rules) != 3 {
+		t.Fatalf("期望 3 条规则，得到 %d", len(m.Rules))
+	}
+}
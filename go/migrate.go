@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// migrate 迁移镜像到目标仓库，参数可以是镜像地址或 k8s yaml 文件
+func migrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	jsonOutput := fs.Bool("json", false, "以 JSON 格式输出报告")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: migrator migrate [-json] <镜像地址|yaml文件|->...")
+		fmt.Fprintln(fs.Output(), "参数为 - 时从标准输入逐行读取镜像地址")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	startJournal("migrate", args)
+
+	images, err := collectImages(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+
+	var results []imageResult
+	for _, image := range images {
+		result, _ := resolveResult(image, true)
+		results = append(results, result)
+	}
+
+	failed := countFailed(results)
+	if *jsonOutput {
+		printJSON(results)
+	} else {
+		printImageResults(os.Stdout, results)
+		fmt.Printf("\n共 %d 个镜像，失败 %d\n", len(results), failed)
+	}
+
+	if failed > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
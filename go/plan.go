@@ -0,0 +1,228 @@
+package main
+
+import (
+	"dockerImageMigrator/diff"
+	"dockerImageMigrator/harbor"
+	"dockerImageMigrator/log"
+	"fmt"
+	"time"
+)
+
+// imagePlan 单个镜像的迁移计划
+type imagePlan struct {
+	Source string `json:"source"`
+	Dest   string `json:"dest,omitempty"`
+	*harbor.CopyPlan
+	Error string `json:"error,omitempty"`
+}
+
+// deployPlan 单个文件的部署计划
+type deployPlan struct {
+	File       string        `json:"file"`
+	Images     []imagePlan   `json:"images"`
+	Secrets    []movedSecret `json:"secrets,omitempty"`
+	Diff       string        `json:"diff"`
+	RemotePath string        `json:"remotePath,omitempty"`
+	Command    string        `json:"command,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// failed 返回计划中出错的镜像数，文件本身出错时另计 1
+func (p *deployPlan) failed() int {
+	failed := 0
+	if p.Error != "" {
+		failed++
+	}
+	for _, image := range p.Images {
+		if image.Error != "" {
+			failed++
+		}
+	}
+	return failed
+}
+
+// deployPlanCommand 输出 deploy 的执行计划，只查询源与目标仓库，不迁移镜像、不上传文件
+func deployPlanCommand(paths []string, jsonOutput bool, opts *deployOptions) int {
+	planned := make(map[string]imagePlan)
+	var plans []*deployPlan
+	failed := 0
+	for _, path := range paths {
+		plan := planDeploy(path, planned, opts)
+		failed += plan.failed()
+		plans = append(plans, plan)
+	}
+
+	if jsonOutput {
+		printJSON(plans)
+	} else {
+		printDeployPlans(plans)
+	}
+
+	if failed > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// planDeploy 生成单个文件的部署计划，planned 缓存已查询过的镜像
+func planDeploy(path string, planned map[string]imagePlan, opts *deployOptions) *deployPlan {
+	localFile := manifestName(path)
+	plan := &deployPlan{File: localFile}
+
+	file, err := readManifest(path)
+	if err != nil {
+		plan.Error = err.Error()
+		return plan
+	}
+	source, err := file.Bytes()
+	if err != nil {
+		plan.Error = err.Error()
+		return plan
+	}
+
+	for _, field := range file.AllImages(imagePathRules) {
+		image, ok := planned[field.Value]
+		if !ok {
+			image = planImage(field.Value)
+			planned[field.Value] = image
+		}
+		if image.Dest != "" {
+			field.Set(image.Dest)
+		}
+		plan.Images = append(plan.Images, image)
+	}
+
+	if opts.extractSecrets && !file.IsCompose() {
+		if plan.Secrets, err = extractSecretEnv(file); err != nil {
+			plan.Error = err.Error()
+			return plan
+		}
+	}
+	if opts.pullSecret.Name != "" && !file.IsCompose() {
+		if _, err := addPullSecrets(file, opts.pullSecret, placeholderCredentials); err != nil {
+			plan.Error = err.Error()
+			return plan
+		}
+	}
+
+	data, err := file.Bytes()
+	if err != nil {
+		plan.Error = err.Error()
+		return plan
+	}
+	plan.Diff = diff.Unified(localFile, localFile, source, data)
+
+	if kubeClient != nil && !file.IsCompose() {
+		plan.Command = kubeApplyCommand()
+		return plan
+	}
+	config, err := cfg.SSHConfig("")
+	if err != nil {
+		plan.Error = err.Error()
+		return plan
+	}
+	plan.RemotePath = remoteFilePath(config.RemoteDir, localFile, time.Now())
+	plan.Command = deployCommandLine(file, localFile)(plan.RemotePath)
+	return plan
+}
+
+// planImage 按映射规则计算目标镜像，并查询迁移需要传输的内容
+func planImage(imageRaw string) imagePlan {
+	plan := imagePlan{Source: imageRaw}
+	registry, path, tag, err := parseImage(imageRaw)
+	if err != nil {
+		plan.Error = err.Error()
+		return plan
+	}
+
+	dest, target := destImage(path, tag)
+	plan.Dest = formatImage(dest.HarborHost, dest.ImagePath, dest.ImageTag)
+
+	log.Infof("正在查询 %s -> %s", imageRaw, plan.Dest)
+	plan.CopyPlan, err = harbor.PlanMigration(sourceHarbor(registry, path, tag), dest)
+	if err != nil {
+		plan.Error = err.Error()
+		return plan
+	}
+
+	if target.PinDigest {
+		// 迁移时 manifest 按原始字节复制，目标不存在时迁移后的 digest 与源端一致
+		digest := plan.SourceDigest
+		if plan.Exists {
+			if digest, err = harbor.ManifestDigest(dest); err != nil {
+				log.Errorf("获取镜像 %s 的 digest 失败，保留标签: %v", plan.Dest, err)
+				return plan
+			}
+		}
+		plan.Dest = formatImage(dest.HarborHost, dest.ImagePath, digest)
+	}
+	return plan
+}
+
+// printDeployPlans 打印部署计划，传输量按 blob 去重统计
+func printDeployPlans(plans []*deployPlan) {
+	missing := make(map[string]int64)
+	for _, plan := range plans {
+		fmt.Printf("📋 %s\n", plan.File)
+		if plan.Error != "" && plan.Images == nil {
+			fmt.Printf("  ❌ %s\n\n", plan.Error)
+			continue
+		}
+
+		for _, image := range plan.Images {
+			switch {
+			case image.Error != "":
+				fmt.Printf("  ❌ %s: %s\n", image.Source, image.Error)
+			case image.Exists:
+				fmt.Printf("  ✅ 已存在 %s -> %s\n", image.Source, image.Dest)
+			default:
+				fmt.Printf("  ⬆️  需迁移 %s -> %s（%d/%d 个 blob，%s）\n",
+					image.Source, image.Dest, len(image.MissingBlobs), image.Blobs, formatBytes(image.Bytes))
+				for _, blob := range image.MissingBlobs {
+					missing[blob.Digest] = blob.Size
+				}
+			}
+		}
+
+		for _, moved := range plan.Secrets {
+			fmt.Printf("  🔐 移入 Secret %v\n", moved)
+		}
+
+		if plan.Error != "" {
+			fmt.Printf("  ❌ %s\n", plan.Error)
+		} else {
+			if plan.RemotePath != "" {
+				fmt.Printf("  远程文件: %s\n", plan.RemotePath)
+			}
+			fmt.Printf("  执行命令: %s\n", plan.Command)
+		}
+		if plan.Diff != "" {
+			fmt.Printf("\n%s", plan.Diff)
+		} else {
+			fmt.Println("  yaml 无变化")
+		}
+		fmt.Println()
+	}
+
+	var total int64
+	for _, size := range missing {
+		if size > 0 {
+			total += size
+		}
+	}
+	fmt.Printf("共需传输 %d 个 blob，%s（未写入任何内容）\n", len(missing), formatBytes(total))
+}
+
+// formatBytes 以 KiB/MiB/GiB 显示字节数
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
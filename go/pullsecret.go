@@ -0,0 +1,312 @@
+package main
+
+import (
+	"crypto/sha256"
+	"dockerImageMigrator/config"
+	"dockerImageMigrator/harbor"
+	"dockerImageMigrator/kube"
+	"dockerImageMigrator/log"
+	"dockerImageMigrator/workload"
+	"encoding/hex"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pullSecretRegistries 拉取凭据适用的仓库：写入 yaml 的镜像地址前缀，接口地址的主机不同时一并加入
+func pullSecretRegistries() []string {
+	registries := []string{cfg.Destination.Host}
+	if u, err := url.Parse(cfg.Destination.API); err == nil && u.Host != "" && u.Host != cfg.Destination.Host {
+		registries = append(registries, u.Host)
+	}
+	return registries
+}
+
+// pullCredentials 返回命名空间中拉取凭据使用的用户名与密码，projects 为该命名空间用到的目标 Harbor 项目
+type pullCredentials func(namespace string, projects []string) (username, password string, err error)
+
+// pullSecretDoc 追加到文件中的拉取凭据 Secret
+type pullSecretDoc struct {
+	node      *yaml.Node
+	namespace string   // 未写 namespace 时为空
+	projects  []string // 命名空间中的工作负载用到的目标 Harbor 项目
+}
+
+// addPullSecrets 为文件中每个含 pod spec 的命名空间追加拉取凭据 Secret，Target 为 pod 时同时写入
+// pod spec 的 imagePullSecrets。未写 namespace 的对象对应的 Secret 同样不写 namespace，与它们部署到同一命名空间。
+// 文件中已有同名 Secret 的命名空间不再追加。返回追加的 Secret
+func addPullSecrets(file *workload.File, pullSecret config.PullSecret, credentials pullCredentials) ([]*pullSecretDoc, error) {
+	projects := make(map[string]map[string]bool)
+	declared := make(map[string]bool)
+	for _, obj := range file.Objects() {
+		namespace := workload.ScalarValue(workload.Get(obj, "metadata"), "namespace")
+		if workload.PodSpec(obj) != nil {
+			if projects[namespace] == nil {
+				projects[namespace] = make(map[string]bool)
+			}
+			for _, field := range file.Images(obj, imagePathRules) {
+				if project := destProject(field.Value); project != "" {
+					projects[namespace][project] = true
+				}
+			}
+		}
+		if workload.Kind(obj) == "Secret" && workload.ScalarValue(workload.Get(obj, "metadata"), "name") == pullSecret.Name {
+			declared[namespace] = true
+		}
+	}
+	if len(projects) == 0 {
+		return nil, nil
+	}
+
+	if pullSecret.Target == config.PullSecretPod {
+		if modified := file.AddPullSecret(pullSecret.Name); len(modified) > 0 {
+			log.Infof("%d 个工作负载加入 imagePullSecrets %s", len(modified), pullSecret.Name)
+		}
+	}
+
+	namespaces := make([]string, 0, len(projects))
+	for namespace := range projects {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	var docs []*pullSecretDoc
+	for _, namespace := range namespaces {
+		if declared[namespace] {
+			continue
+		}
+		names := make([]string, 0, len(projects[namespace]))
+		for project := range projects[namespace] {
+			names = append(names, project)
+		}
+		sort.Strings(names)
+		username, password, err := credentials(namespace, names)
+		if err != nil {
+			return nil, err
+		}
+		doc := &pullSecretDoc{node: &yaml.Node{}, namespace: namespace, projects: names}
+		if err := doc.encode(pullSecret.Name, username, password); err != nil {
+			return nil, err
+		}
+		file.Append(doc.node)
+		docs = append(docs, doc)
+		log.Infof("追加拉取凭据 Secret %s（命名空间 %s）", pullSecret.Name, namespaceName(namespace))
+	}
+	return docs, nil
+}
+
+// encode 以 username 与 password 生成 Secret，替换文件中原有的内容
+func (d *pullSecretDoc) encode(name, username, password string) error {
+	if err := d.node.Encode(kube.PullSecret(name, d.namespace, pullSecretRegistries(), username, password)); err != nil {
+		return fmt.Errorf("生成拉取凭据 %s 失败: %v", name, err)
+	}
+	return nil
+}
+
+// destProject 返回目标 Harbor 中镜像所在的项目，不是目标 Harbor 的镜像返回空
+func destProject(image string) string {
+	rest, ok := strings.CutPrefix(image, cfg.Destination.Host+"/")
+	if !ok {
+		return ""
+	}
+	project, _, ok := strings.Cut(rest, "/")
+	if !ok {
+		return ""
+	}
+	return project
+}
+
+// deployCredentials 部署时使用的拉取凭据：启用机器人账号时先写入占位凭据，用户确认部署后才由
+// pullRobots.issue 签发账号并填入，否则使用配置的用户名，未配置时使用 destination 的凭据
+func deployCredentials(pullSecret config.PullSecret) pullCredentials {
+	return func(namespace string, projects []string) (string, string, error) {
+		if pullSecret.Robot {
+			if len(projects) == 0 {
+				return "", "", fmt.Errorf("命名空间 %s 中的工作负载没有使用 %s 中的镜像，无法确定机器人账号的项目", namespaceName(namespace), cfg.Destination.Host)
+			}
+			return placeholderCredentials(namespace, projects)
+		}
+		if pullSecret.Username == "" {
+			log.Warnf("拉取凭据 %s 使用 destination 的账号 %s，建议配置 kubernetes.pullSecret.robot", pullSecret.Name, cfg.Destination.Username)
+		}
+		username, password := pullSecret.Credentials(cfg.Destination)
+		return username, password, nil
+	}
+}
+
+// pullRobots 一次部署中为各命名空间签发的机器人账号。账号在用户确认 diff 之后、apply 之前才创建，
+// 同一命名空间的多个文件共用一个账号；apply 成功后才删除该命名空间的旧账号，失败回滚时删除新账号，
+// 集群中的拉取凭据因此始终可用
+type pullRobots struct {
+	api     *harbor.API
+	days    int
+	cluster string                   // 部署的目标集群，写入账号名称
+	issued  map[string]*harbor.Robot // 命名空间 -> 本次部署签发的账号
+}
+
+func newPullRobots(pullSecret config.PullSecret) *pullRobots {
+	return &pullRobots{api: harbor.NewAPI(cfg.DestHarbor()), days: pullSecret.RobotDays, cluster: clusterID(), issued: make(map[string]*harbor.Robot)}
+}
+
+// clusterID 标识部署的目标集群：API 服务器地址（经由 SSH 部署时为 SSH 目标）的 sha256 前 8 位。
+// 多个集群共用一个 Harbor 时，同名命名空间的账号按集群区分，部署一个集群不会删除另一个集群正在使用的账号
+func clusterID() string {
+	target := ""
+	if kubeClient != nil {
+		target = kubeClient.Server
+	} else if len(cfg.SSH) > 0 {
+		target = fmt.Sprintf("ssh://%s:%d", cfg.SSH[0].Host, cfg.SSH[0].Port)
+	}
+	sum := sha256.Sum256([]byte(target))
+	return hex.EncodeToString(sum[:4])
+}
+
+// issuedRobot 一个命名空间在本次 apply 中使用的账号
+type issuedRobot struct {
+	namespace string
+	robot     *harbor.Robot
+	previous  *harbor.Robot // 本次部署中之前签发的账号，robot 为新建时记录，撤销时恢复
+	created   bool
+}
+
+// issue 为 docs 所在的命名空间签发账号并把凭据写入 Secret，本次部署已签发的账号可以拉取所需项目时直接使用。
+// 未写 namespace 的 Secret 部署到 namespace。失败时删除已新建的账号
+func (p *pullRobots) issue(name string, docs []*pullSecretDoc, namespace string) ([]issuedRobot, error) {
+	var issued []issuedRobot
+	var projects [][]string
+	index := make(map[string]int)
+	for _, doc := range docs {
+		ns := doc.namespace
+		if ns == "" {
+			ns = namespace
+		}
+		i, ok := index[ns]
+		if !ok {
+			i = len(issued)
+			index[ns] = i
+			issued = append(issued, issuedRobot{namespace: ns, robot: p.issued[ns]})
+			projects = append(projects, nil)
+		}
+		projects[i] = append(projects[i], doc.projects...)
+	}
+
+	for i := range issued {
+		entry := &issued[i]
+		if entry.robot != nil && entry.robot.Covers(projects[i]) {
+			continue
+		}
+		if entry.robot != nil {
+			projects[i] = append(projects[i], entry.robot.Projects...)
+		}
+		robot, err := p.api.IssuePullRobot(p.cluster, entry.namespace, projects[i], p.days, time.Now())
+		if err != nil {
+			p.discard(issued)
+			return nil, err
+		}
+		entry.previous, entry.robot, entry.created = entry.robot, robot, true
+		p.issued[entry.namespace] = robot
+		expires := "永不过期"
+		if !robot.ExpiresAt.IsZero() {
+			expires = robot.ExpiresAt.Format("2006-01-02") + " 过期"
+		}
+		log.Infof("创建机器人账号 %s（可拉取项目 %s，%s）", robot.Name, strings.Join(robot.Projects, ", "), expires)
+	}
+
+	for _, doc := range docs {
+		ns := doc.namespace
+		if ns == "" {
+			ns = namespace
+		}
+		robot := issued[index[ns]].robot
+		if err := doc.encode(name, robot.Name, robot.Secret); err != nil {
+			p.discard(issued)
+			return nil, err
+		}
+	}
+	return issued, nil
+}
+
+// commit apply 成功后删除各命名空间的旧账号。删除失败不影响部署，旧账号可以用 migrator robots rm 删除
+func (p *pullRobots) commit(issued []issuedRobot) {
+	for _, entry := range issued {
+		revoked, err := p.api.RevokePullRobots(p.cluster, entry.namespace, entry.robot)
+		for _, robot := range revoked {
+			log.Infof("删除命名空间 %s 的旧机器人账号 %s", entry.namespace, robot.Name)
+		}
+		if err != nil {
+			log.Warnf("删除命名空间 %s 的旧机器人账号失败: %v", entry.namespace, err)
+		}
+	}
+}
+
+// discard apply 失败并已回滚（或尚未 apply）时删除本次新建的账号，集群中的 Secret 仍使用之前的账号
+func (p *pullRobots) discard(issued []issuedRobot) {
+	for i := len(issued) - 1; i >= 0; i-- {
+		entry := issued[i]
+		if !entry.created {
+			continue
+		}
+		if err := p.api.DeleteRobot(entry.robot); err != nil {
+			log.Warnf("%v", err)
+		}
+		if entry.previous != nil {
+			p.issued[entry.namespace] = entry.previous
+		} else {
+			delete(p.issued, entry.namespace)
+		}
+	}
+}
+
+// defaultNamespace 未写 namespace 的对象部署到的命名空间，经由 SSH 部署时无法得知，按 default 处理
+func defaultNamespace() string {
+	if kubeClient != nil {
+		return kubeClient.Namespace
+	}
+	return "default"
+}
+
+// placeholderCredentials 部署计划中使用的凭据，不创建机器人账号，diff 中也不显示真实凭据
+func placeholderCredentials(string, []string) (string, string, error) {
+	return "<username>", "<password>", nil
+}
+
+// serviceAccountRefs 含 pod spec 的对象所在命名空间的 default ServiceAccount，
+// 只在拉取凭据写入 ServiceAccount 时返回
+func serviceAccountRefs(objects []manifestObject, pullSecret config.PullSecret) []kube.ObjectRef {
+	if pullSecret.Name == "" || pullSecret.Target != config.PullSecretServiceAccount {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var refs []kube.ObjectRef
+	for _, obj := range objects {
+		if !obj.pod || seen[obj.ref.Namespace] {
+			continue
+		}
+		seen[obj.ref.Namespace] = true
+		refs = append(refs, kube.ObjectRef{APIVersion: "v1", Kind: "ServiceAccount", Namespace: obj.ref.Namespace, Name: "default"})
+	}
+	return refs
+}
+
+// addServiceAccountPullSecrets 在 apply 前把拉取凭据 secret 加入 default ServiceAccount，之后创建的 Pod 才会带上它
+func addServiceAccountPullSecrets(c kube.Cluster, accounts []kube.ObjectRef, secret string) error {
+	for _, account := range accounts {
+		changed, err := kube.AddServiceAccountPullSecret(c, account.Namespace, secret)
+		if err != nil {
+			return err
+		}
+		if changed {
+			log.Infof("命名空间 %s 的 default ServiceAccount 加入 imagePullSecrets %s", account.Namespace, secret)
+		}
+	}
+	return nil
+}
+
+func namespaceName(namespace string) string {
+	if namespace == "" {
+		return "默认"
+	}
+	return namespace
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"dockerImageMigrator/config"
+	"dockerImageMigrator/kube"
+	"dockerImageMigrator/log"
+	"dockerImageMigrator/workload"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	log.Init()
+	os.Exit(m.Run())
+}
+
+// fakeHarbor 模拟目标 Harbor 的机器人账号接口，记录每个账号的密码用于验证拉取凭据
+type fakeHarbor struct {
+	mu      sync.Mutex
+	robots  map[int64]map[string]interface{}
+	secrets map[string]string // 完整名称 -> 密码
+	nextID  int64
+	created int
+}
+
+func (h *fakeHarbor) add(name, secret string, projects ...string) {
+	var permissions []interface{}
+	for _, project := range projects {
+		permissions = append(permissions, map[string]interface{}{"kind": "project", "namespace": project})
+	}
+	h.nextID++
+	h.robots[h.nextID] = map[string]interface{}{"id": h.nextID, "name": "robot$" + name, "expires_at": -1, "permissions": permissions}
+	h.secrets["robot$"+name] = secret
+}
+
+// valid 判断凭据能否登录
+func (h *fakeHarbor) valid(username, password string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	secret, ok := h.secrets[username]
+	return ok && secret == password
+}
+
+func (h *fakeHarbor) serve(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/api/v2.0/robots":
+		list := []interface{}{}
+		if r.URL.Query().Get("page") == "1" {
+			for i := int64(1); i <= h.nextID; i++ {
+				if robot, ok := h.robots[i]; ok {
+					list = append(list, robot)
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(list)
+	case r.Method == "POST" && r.URL.Path == "/api/v2.0/robots":
+		var body struct {
+			Name        string
+			Permissions []struct{ Namespace string }
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		var projects []string
+		for _, permission := range body.Permissions {
+			projects = append(projects, permission.Namespace)
+		}
+		h.created++
+		secret := fmt.Sprintf("new-secret-%d", h.created)
+		h.add(body.Name, secret, projects...)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": h.nextID, "name": "robot$" + body.Name, "secret": secret})
+	case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/api/v2.0/robots/"):
+		id, _ := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/v2.0/robots/"), 10, 64)
+		robot, ok := h.robots[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(h.secrets, robot["name"].(string))
+		delete(h.robots, id)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// fakeCluster 内存中的 Kubernetes API，支持 discovery、GET、server-side apply、PUT 与 DELETE
+type fakeCluster struct {
+	mu      sync.Mutex
+	objects map[string]map[string]interface{}
+	version int
+	fail    map[string]bool // apply 时返回错误的对象路径
+	applies int
+}
+
+func (c *fakeCluster) status(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{"kind": "Status", "message": message, "code": code})
+}
+
+func (c *fakeCluster) serve(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/v1":
+		io.WriteString(w, `{"resources":[{"name":"secrets","namespaced":true,"kind":"Secret"}]}`)
+		return
+	case "/apis/apps/v1":
+		io.WriteString(w, `{"resources":[{"name":"deployments","namespaced":true,"kind":"Deployment"}]}`)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	path := r.URL.Path
+	switch r.Method {
+	case "GET":
+		obj, ok := c.objects[path]
+		if !ok {
+			c.status(w, http.StatusNotFound, "not found")
+			return
+		}
+		json.NewEncoder(w).Encode(obj)
+	case "PATCH", "PUT":
+		var obj map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&obj)
+		if r.Method == "PATCH" {
+			c.applies++
+			if c.fail[path] {
+				c.status(w, http.StatusUnprocessableEntity, "invalid")
+				return
+			}
+		}
+		c.version++
+		obj["metadata"].(map[string]interface{})["resourceVersion"] = strconv.Itoa(c.version)
+		c.objects[path] = obj
+		json.NewEncoder(w).Encode(obj)
+	case "DELETE":
+		delete(c.objects, path)
+		c.status(w, http.StatusOK, "deleted")
+	}
+}
+
+// pullCredentialsOf 读取集群中拉取凭据 Secret 的用户名与密码
+func (c *fakeCluster) pullCredentialsOf(t *testing.T, path string) (string, string) {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	obj, ok := c.objects[path]
+	if !ok {
+		t.Fatalf("集群中没有 %s", path)
+	}
+	encoded := obj["data"].(map[string]interface{})[".dockerconfigjson"].(string)
+	data, _ := base64.StdEncoding.DecodeString(encoded)
+	var dockerConfig struct {
+		Auths map[string]struct{ Username, Password string }
+	}
+	if err := json.Unmarshal(data, &dockerConfig); err != nil {
+		t.Fatal(err)
+	}
+	auth := dockerConfig.Auths["harbor.local"]
+	return auth.Username, auth.Password
+}
+
+const pullSecretPath = "/api/v1/namespaces/apps/secrets/harbor-pull"
+
+// 另一个集群的 apps 命名空间使用的机器人账号，部署本集群时不应删除
+const otherClusterRobot = "migrator-00000000.apps.20250101000000000"
+
+// oldRobotName 部署前集群中的拉取凭据使用的机器人账号
+func oldRobotName() string {
+	return "robot$migrator-" + clusterID() + ".apps.20250101000000000"
+}
+
+// setupRobotDeploy 目标 Harbor 中已有 apps 的机器人账号，集群中已有使用它的拉取凭据 Secret
+func setupRobotDeploy(t *testing.T, answer bool) (*fakeHarbor, *fakeCluster, *deployOptions) {
+	h := &fakeHarbor{robots: make(map[int64]map[string]interface{}), secrets: make(map[string]string)}
+	harborServer := httptest.NewServer(http.HandlerFunc(h.serve))
+	t.Cleanup(harborServer.Close)
+
+	c := &fakeCluster{objects: make(map[string]map[string]interface{}), fail: make(map[string]bool)}
+	clusterServer := httptest.NewServer(http.HandlerFunc(c.serve))
+	t.Cleanup(clusterServer.Close)
+
+	oldCfg, oldClient, oldConfirm := cfg, kubeClient, confirm
+	t.Cleanup(func() { cfg, kubeClient, confirm = oldCfg, oldClient, oldConfirm })
+	cfg = &config.Config{Destination: config.Destination{API: harborServer.URL, Host: "harbor.local", Username: "admin", Password: "Harbor12345"}}
+	kubeClient = kube.NewClient(&kube.Config{Server: clusterServer.URL, Namespace: "apps"})
+	confirm = func(string) (bool, error) { return answer, nil }
+
+	h.add(strings.TrimPrefix(oldRobotName(), "robot$"), "old-secret", "app")
+	h.add(otherClusterRobot, "other-secret", "app")
+	existing := kube.PullSecret("harbor-pull", "apps", []string{"harbor.local"}, oldRobotName(), "old-secret")
+	existing["metadata"].(map[string]interface{})["resourceVersion"] = "1"
+	c.objects[pullSecretPath] = existing
+	c.version = 1
+
+	opts := newDeployOptions()
+	opts.rolloutTimeout = 0
+	opts.pullSecret = config.PullSecret{Name: "harbor-pull", Target: config.PullSecretPod, Robot: true, RobotDays: 30}
+	return h, c, opts
+}
+
+// deployManifest 与 deploy 相同地追加拉取凭据后 apply，不迁移镜像
+func deployManifest(t *testing.T, opts *deployOptions, name string) error {
+	t.Helper()
+	file, err := workload.Parse([]byte(fmt.Sprintf(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: %s
+spec:
+  template:
+    spec:
+      containers:
+        - name: %s
+          image: harbor.local/app/%s:1.0
+`, name, name, name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pullSecrets, err := addPullSecrets(file, opts.pullSecret, deployCredentials(opts.pullSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := file.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return applyManifest(&deployResult{File: name + ".yaml"}, file, name+".yaml", data, pullSecrets, opts)
+}
+
+func TestRobotPullSecretKeptWhenDeployCancelled(t *testing.T) {
+	h, c, opts := setupRobotDeploy(t, false)
+
+	if err := deployManifest(t, opts, "web"); err != errDeployCancelled {
+		t.Fatalf("应取消部署: %v", err)
+	}
+	if h.created != 0 || c.applies != 0 {
+		t.Errorf("取消部署时不应创建账号（%d）或 apply（%d）", h.created, c.applies)
+	}
+	if username, password := c.pullCredentialsOf(t, pullSecretPath); !h.valid(username, password) {
+		t.Errorf("取消部署后集群中的拉取凭据 %s 应仍然可用", username)
+	}
+}
+
+func TestRobotPullSecretIssuedOncePerNamespace(t *testing.T) {
+	h, c, opts := setupRobotDeploy(t, true)
+
+	for _, name := range []string{"web", "worker"} {
+		if err := deployManifest(t, opts, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if h.created != 1 {
+		t.Errorf("同一命名空间应只签发一个账号，实际 %d", h.created)
+	}
+	username, password := c.pullCredentialsOf(t, pullSecretPath)
+	if !h.valid(username, password) || !strings.HasPrefix(username, "robot$migrator-"+clusterID()+".apps.") || username == oldRobotName() {
+		t.Errorf("集群中的拉取凭据应使用新账号: %s", username)
+	}
+	if h.valid(oldRobotName(), "old-secret") {
+		t.Error("apply 成功后应删除旧账号")
+	}
+	if !h.valid("robot$"+otherClusterRobot, "other-secret") {
+		t.Error("不应删除其他集群同名命名空间的账号")
+	}
+}
+
+func TestRobotPullSecretRolledBack(t *testing.T) {
+	h, c, opts := setupRobotDeploy(t, true)
+	c.fail["/apis/apps/v1/namespaces/apps/deployments/web"] = true
+
+	if err := deployManifest(t, opts, "web"); err == nil || !strings.Contains(err.Error(), "已回滚") {
+		t.Fatalf("apply 失败时应回滚: %v", err)
+	}
+	username, password := c.pullCredentialsOf(t, pullSecretPath)
+	if username != oldRobotName() || !h.valid(username, password) {
+		t.Errorf("回滚后集群中的拉取凭据应恢复为仍然可用的旧账号: %s", username)
+	}
+	if h.created != 1 || len(h.secrets) != 2 {
+		t.Errorf("回滚后应删除新账号: %v", h.secrets)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"dockerImageMigrator/harbor"
+	"dockerImageMigrator/journal"
+	"dockerImageMigrator/log"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 迁移日志，未启用时为 nil
+var migrationJournal *journal.Journal
+
+// openJournal 打开配置中的迁移日志，配置为 off 时返回 nil
+func openJournal() (*journal.Journal, error) {
+	path := cfg.Journal
+	if path == "off" {
+		return nil, nil
+	}
+	if path == "" {
+		path = journal.DefaultPath()
+	}
+	return journal.Open(path)
+}
+
+// startJournal 在子命令解析参数后开始一次新的运行记录，只输出计划等不写入内容的运行不调用。
+// resume 时沿用被恢复的运行；日志无法打开时只记录警告
+func startJournal(name string, args []string) {
+	if migrationJournal != nil {
+		return
+	}
+	j, err := openJournal()
+	if err != nil {
+		log.Warnf("迁移日志不可用，本次运行中断后无法 resume: %v", err)
+		return
+	}
+	if j == nil {
+		return
+	}
+	dir, _ := os.Getwd()
+	if _, err := j.Start(append([]string{name}, args...), dir); err != nil {
+		log.Warnf("迁移日志不可用，本次运行中断后无法 resume: %v", err)
+		j.Close()
+		return
+	}
+	migrationJournal = j
+}
+
+// finishJournal 记录运行结束并关闭迁移日志
+func finishJournal(exitCode int) {
+	if migrationJournal == nil {
+		return
+	}
+	if err := migrationJournal.Finish(exitCode); err != nil {
+		log.Warnf("%v", err)
+	}
+	migrationJournal.Close()
+	migrationJournal = nil
+}
+
+// recordImage 在迁移日志中记录镜像状态
+func recordImage(image, dest string, state journal.State, err error) {
+	if migrationJournal == nil {
+		return
+	}
+	if err := migrationJournal.RecordImage(image, dest, state, err); err != nil {
+		log.Warnf("%v", err)
+	}
+}
+
+// imageDone 判断镜像是否已在当前运行（resume 时为被恢复的运行）中迁移完成
+func imageDone(image, dest string) bool {
+	return migrationJournal != nil && migrationJournal.ImageState(image, dest) == journal.Done
+}
+
+// blobJournal 返回目标仓库的 blob 日志，未启用迁移日志时返回 nil
+func blobJournal(dest harbor.HarborConfig) harbor.BlobJournal {
+	if migrationJournal == nil {
+		return nil
+	}
+	return migrationJournal.Blobs(dest.HarborApi)
+}
+
+// resume 从迁移日志中恢复最近一次中断或失败的运行：
+// 已完成的镜像与 blob 直接跳过，未完成的上传从仓库已确认的位置续传
+func resume(args []string) int {
+	fs := flag.NewFlagSet("resume", flag.ContinueOnError)
+	list := fs.Bool("list", false, "列出可以恢复的运行")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: migrator resume [-list] [运行ID]")
+		fmt.Fprintln(fs.Output(), "重新执行中断或失败的运行，参数与工作目录沿用原运行，配置使用本次指定的配置文件")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	j, err := openJournal()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+	if j == nil {
+		fmt.Fprintln(os.Stderr, "❌ 配置中已关闭迁移日志（journal: off），无法 resume")
+		return exitUsage
+	}
+
+	if *list {
+		defer j.Close()
+		for _, run := range j.Runs() {
+			if !run.Unfinished() {
+				continue
+			}
+			status := "中断"
+			if run.Finished {
+				status = fmt.Sprintf("失败(退出码 %d)", run.ExitCode)
+			}
+			counts := run.Counts()
+			fmt.Printf("%s  %s  %s  完成 %d，失败 %d，未完成 %d\n", run.ID, status, strings.Join(run.Args, " "),
+				counts[journal.Done], counts[journal.Failed], counts[journal.Planned]+counts[journal.Transferring])
+		}
+		return exitOK
+	}
+
+	var run *journal.Run
+	if fs.NArg() == 1 {
+		run = j.Find(fs.Arg(0))
+	} else {
+		run = j.LastUnfinished()
+	}
+	if run == nil {
+		j.Close()
+		fmt.Fprintln(os.Stderr, "❌ 没有需要恢复的运行")
+		return exitUsage
+	}
+
+	c := findCommand(run.Args[0])
+	if c == nil || !c.journal {
+		j.Close()
+		fmt.Fprintf(os.Stderr, "❌ 运行 %s 的子命令 %s 不支持恢复\n", run.ID, run.Args[0])
+		return exitUsage
+	}
+	for _, arg := range run.Args[1:] {
+		if arg == stdinArg {
+			j.Close()
+			fmt.Fprintf(os.Stderr, "❌ 运行 %s 从标准输入读取参数，无法恢复\n", run.ID)
+			return exitUsage
+		}
+	}
+	if run.Dir != "" {
+		if err := os.Chdir(run.Dir); err != nil {
+			j.Close()
+			fmt.Fprintf(os.Stderr, "❌ 切换到原工作目录失败: %v\n", err)
+			return exitUsage
+		}
+	}
+
+	if err := j.Resume(run.ID); err != nil {
+		j.Close()
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+	migrationJournal = j
+	log.Infof("恢复运行 %s: %s", run.ID, strings.Join(run.Args, " "))
+	code := c.run(run.Args[1:])
+	finishJournal(code)
+	return code
+}
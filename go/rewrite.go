@@ -0,0 +1,243 @@
+package main
+
+import (
+	"dockerImageMigrator/diff"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 未指定输出目录时，改写结果写在原文件旁，文件名加上该后缀
+const rewriteSuffix = ".migrated"
+
+// rewriteInput 一个待改写的文件，rel 为写入输出目录时使用的相对路径
+type rewriteInput struct {
+	path string
+	rel  string
+}
+
+// rewrite 迁移并改写 yaml 文件中的镜像，结果写入磁盘而不是部署到集群
+func rewrite(args []string) int {
+	fs := flag.NewFlagSet("rewrite", flag.ContinueOnError)
+	noMigrate := fs.Bool("no-migrate", false, "只改写镜像地址，不迁移镜像")
+	outputDir := fs.String("o", "", "输出目录，默认写在原文件旁（文件名加 "+rewriteSuffix+" 后缀）")
+	inPlace := fs.Bool("in-place", false, "直接覆盖原文件")
+	quiet := fs.Bool("quiet", false, "不打印 diff")
+	jsonOutput := fs.Bool("json", false, "以 JSON 格式输出报告，不打印 diff")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: migrator rewrite [-no-migrate] [-o 输出目录 | -in-place] [-quiet] [-json] <文件|目录|通配符|->...")
+		fmt.Fprintln(fs.Output(), "参数为 - 时从标准输入读取 yaml，改写结果写到标准输出，diff 与报告写到标准错误")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *inPlace && *outputDir != "" {
+		fmt.Fprintln(os.Stderr, "❌ -o 与 -in-place 不能同时使用")
+		return exitUsage
+	}
+	startJournal("rewrite", args)
+
+	inputs, err := expandInputs(fs.Args())
+	if err == nil && *outputDir != "" {
+		err = checkOutputNames(inputs)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+
+	// 改写结果写到标准输出时，diff 与报告改写到标准错误
+	report := os.Stdout
+	for _, input := range inputs {
+		if input.path == stdinArg {
+			report = os.Stderr
+		}
+	}
+	if *jsonOutput && report == os.Stderr {
+		fmt.Fprintln(os.Stderr, "❌ -json 不能与 - 同时使用")
+		return exitUsage
+	}
+
+	var results []*rewriteResult
+	failed := 0
+	for _, input := range inputs {
+		output := input.path
+		switch {
+		case input.path == stdinArg:
+		case *outputDir != "":
+			output = filepath.Join(*outputDir, input.rel)
+		case !*inPlace:
+			ext := filepath.Ext(input.path)
+			output = strings.TrimSuffix(input.path, ext) + rewriteSuffix + ext
+		}
+
+		var diffOutput io.Writer
+		if !*quiet && !*jsonOutput {
+			diffOutput = report
+		}
+		result := &rewriteResult{File: manifestName(input.path), Output: manifestName(output)}
+		result.Images, err = rewriteFile(input.path, output, !*noMigrate, diffOutput)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", result.File, err)
+			result.Error = err.Error()
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if *jsonOutput {
+		printJSON(results)
+	} else {
+		fmt.Fprintf(report, "\n共 %d 个文件，失败 %d\n", len(inputs), failed)
+	}
+	if failed > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// rewriteResult 单个文件的改写结果
+type rewriteResult struct {
+	File   string        `json:"file"`
+	Output string        `json:"output"`
+	Images []imageResult `json:"images"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// rewriteFile 改写单个文件并写入 output，diffOutput 不为 nil 时向其打印 diff；
+// input 与 output 为 - 时分别表示标准输入与标准输出
+func rewriteFile(input, output string, migrate bool, diffOutput io.Writer) ([]imageResult, error) {
+	file, err := readManifest(input)
+	if err != nil {
+		return nil, err
+	}
+	source, err := file.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	images := rewriteImages(file, migrate)
+
+	data, err := file.Bytes()
+	if err != nil {
+		return images, err
+	}
+	if diffOutput != nil {
+		fmt.Fprint(diffOutput, diff.Unified(manifestName(input), manifestName(output), source, data))
+	}
+
+	if output == stdinArg {
+		if _, err := os.Stdout.Write(data); err != nil {
+			return images, fmt.Errorf("写入标准输出失败: %v", err)
+		}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+			return images, fmt.Errorf("创建输出目录失败: %v", err)
+		}
+		if err := os.WriteFile(output, data, 0644); err != nil {
+			return images, fmt.Errorf("写入文件失败: %v", err)
+		}
+	}
+	if n := countFailed(images); n > 0 {
+		return images, fmt.Errorf("%d 个镜像处理失败，已写入 %s", n, manifestName(output))
+	}
+	return images, nil
+}
+
+// expandInputs 展开参数中的目录与通配符，目录下递归查找 .yaml/.yml 文件
+func expandInputs(args []string) ([]rewriteInput, error) {
+	var inputs []rewriteInput
+	seen := make(map[string]bool)
+	add := func(path, rel string) {
+		if !seen[path] {
+			seen[path] = true
+			inputs = append(inputs, rewriteInput{path: path, rel: rel})
+		}
+	}
+
+	for _, arg := range args {
+		if arg == stdinArg {
+			add(stdinArg, stdinArg)
+			continue
+		}
+
+		var paths []string
+		if strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("通配符 %s 无效: %v", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("%s 没有匹配的文件", arg)
+			}
+			paths = matches
+		} else {
+			paths = []string{arg}
+		}
+
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				add(path, filepath.Base(path))
+				continue
+			}
+
+			root := path
+			err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() || !isYAMLFile(path) {
+					return nil
+				}
+				rel, err := filepath.Rel(root, path)
+				if err != nil {
+					return err
+				}
+				add(path, rel)
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("遍历目录 %s 失败: %v", root, err)
+			}
+		}
+	}
+	return inputs, nil
+}
+
+// checkOutputNames 检查写入输出目录时是否有多个输入对应同一个输出文件，
+// 如 a/deploy.yaml 与 b/deploy.yaml 作为文件参数时都写入 <输出目录>/deploy.yaml
+func checkOutputNames(inputs []rewriteInput) error {
+	seen := make(map[string]string)
+	for _, input := range inputs {
+		if input.path == stdinArg {
+			continue
+		}
+		if other, ok := seen[input.rel]; ok {
+			return fmt.Errorf("%s 与 %s 在输出目录中同名（%s），请分别改写或改为传入它们共同的上级目录", other, input.path, input.rel)
+		}
+		seen[input.rel] = input.path
+	}
+	return nil
+}
+
+// isYAMLFile 判断是否为 yaml 文件，之前生成的改写结果不算在内
+func isYAMLFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".yaml" && ext != ".yml" {
+		return false
+	}
+	return !strings.HasSuffix(strings.TrimSuffix(path, filepath.Ext(path)), rewriteSuffix)
+}
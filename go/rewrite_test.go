@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckOutputNames(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a/deploy.yaml", "b/deploy.yaml", "b/svc.yaml"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("kind: Service\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inputs, err := expandInputs([]string{filepath.Join(dir, "a", "deploy.yaml"), filepath.Join(dir, "b", "deploy.yaml")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkOutputNames(inputs); err == nil || !strings.Contains(err.Error(), "deploy.yaml") {
+		t.Errorf("同名文件写入输出目录时应报错: %v", err)
+	}
+
+	// 传入共同的上级目录时保留相对路径，不会同名
+	inputs, err = expandInputs([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkOutputNames(inputs); err != nil || len(inputs) != 3 {
+		t.Errorf("相对路径不同的文件不应报错: %v, %v", inputs, err)
+	}
+}
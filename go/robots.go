@@ -0,0 +1,156 @@
+package main
+
+import (
+	"dockerImageMigrator/harbor"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// robotResult 清理或删除机器人账号的结果
+type robotResult struct {
+	Robot *harbor.Robot `json:"robot"`
+	OK    bool          `json:"ok"`
+	Error string        `json:"error,omitempty"`
+}
+
+// robots 查看与清理目标 Harbor 中由迁移工具创建的拉取机器人账号
+func robots(args []string) int {
+	fs := flag.NewFlagSet("robots", flag.ContinueOnError)
+	jsonOutput := fs.Bool("json", false, "以 JSON 格式输出")
+	all := fs.Bool("all", false, "list 时同时列出不是迁移工具创建的账号")
+	olderThan := fs.Duration("older-than", 0, "clean 时同时清理创建时间早于该时长的账号，如 720h")
+	dryRun := fs.Bool("dry-run", false, "clean 与 rm 只列出将删除的账号，不删除")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: migrator robots [-json] [-all] [-older-than 时长] [-dry-run] list | clean | rm <名称>...")
+		fmt.Fprintln(fs.Output(), "账号由 deploy -pull-robot 为每个命名空间签发，名称为 migrator-<集群>.<命名空间>.<时间>，<集群> 为 API 服务器地址或 SSH 目标的摘要；clean 删除已过期或被禁用的账号")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	action, names := fs.Arg(0), fs.Args()[1:]
+	if (action == "rm") != (len(names) > 0) || (action != "list" && action != "clean" && action != "rm") {
+		fs.Usage()
+		return exitUsage
+	}
+
+	api := harbor.NewAPI(cfg.DestHarbor())
+	list, err := api.ListRobots()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailed
+	}
+	now := time.Now()
+
+	var selected []*harbor.Robot
+	switch action {
+	case "list":
+		for _, robot := range list {
+			if *all || robot.Managed() {
+				selected = append(selected, robot)
+			}
+		}
+		if *jsonOutput {
+			printJSON(selected)
+		} else {
+			printRobots(os.Stdout, selected, now)
+		}
+		return exitOK
+	case "clean":
+		for _, robot := range list {
+			if robot.Managed() && (robot.Stale(now) || *olderThan > 0 && robot.Created.Before(now.Add(-*olderThan))) {
+				selected = append(selected, robot)
+			}
+		}
+	case "rm":
+		for _, name := range names {
+			robot := findRobot(list, name)
+			if robot == nil {
+				fmt.Fprintf(os.Stderr, "❌ 机器人账号 %s 不存在或不是迁移工具创建的\n", name)
+				return exitFailed
+			}
+			selected = append(selected, robot)
+		}
+	}
+
+	var results []robotResult
+	failed := 0
+	for _, robot := range selected {
+		result := robotResult{Robot: robot, OK: true}
+		if !*dryRun {
+			if err := api.DeleteRobot(robot); err != nil {
+				result.OK, result.Error = false, err.Error()
+				failed++
+			}
+		}
+		results = append(results, result)
+	}
+
+	if *jsonOutput {
+		printJSON(results)
+	} else {
+		verb := "已删除"
+		if *dryRun {
+			verb = "将删除"
+		}
+		for _, result := range results {
+			if result.OK {
+				fmt.Printf("🗑️  %s %s（%s）\n", verb, result.Robot.Name, robotStatus(result.Robot, now))
+			} else {
+				fmt.Printf("❌ %s\n", result.Error)
+			}
+		}
+		fmt.Printf("\n共 %d 个账号，失败 %d\n", len(results), failed)
+	}
+	if failed > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// findRobot 按名称查找迁移工具创建的账号，名称可以省略 Harbor 前缀与 migrator- 前缀
+func findRobot(list []*harbor.Robot, name string) *harbor.Robot {
+	for _, robot := range list {
+		if !robot.Managed() {
+			continue
+		}
+		if robot.Name == name || robot.ShortName() == name || robot.ShortName() == harbor.RobotPrefix+name {
+			return robot
+		}
+	}
+	return nil
+}
+
+// robotStatus 账号的状态与有效期
+func robotStatus(robot *harbor.Robot, now time.Time) string {
+	switch {
+	case robot.Disabled:
+		return "已禁用"
+	case robot.Expired(now):
+		return "已于 " + robot.ExpiresAt.Format("2006-01-02") + " 过期"
+	case robot.ExpiresAt.IsZero():
+		return "永不过期"
+	}
+	return fmt.Sprintf("%s 过期，剩余 %d 天", robot.ExpiresAt.Format("2006-01-02"), int(robot.ExpiresAt.Sub(now).Hours()/24))
+}
+
+// printRobots 逐个账号打印项目、创建时间与有效期
+func printRobots(w io.Writer, list []*harbor.Robot, now time.Time) {
+	for _, robot := range list {
+		mark := "✅"
+		if robot.Stale(now) {
+			mark = "⚠️ "
+		}
+		fmt.Fprintf(w, "%s %s 项目 %s，创建于 %s，%s\n", mark, robot.Name, strings.Join(robot.Projects, ", "),
+			robot.Created.Local().Format("2006-01-02 15:04"), robotStatus(robot, now))
+	}
+	fmt.Fprintf(w, "\n共 %d 个账号\n", len(list))
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"dockerImageMigrator/kube"
+	"dockerImageMigrator/log"
+	"dockerImageMigrator/workload"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"strings"
+)
+
+// secretSuffix 生成的 Secret 名称为 <工作负载名称>-<类型小写>-secrets，同名的 Deployment 与 Job 各自生成
+const secretSuffix = "-secrets"
+
+// movedSecret 移入 Secret 的环境变量
+type movedSecret struct {
+	Object    string `json:"object"`
+	Container string `json:"container"`
+	Env       string `json:"env"`
+	Secret    string `json:"secret"`
+	Key       string `json:"key"`
+	Reason    string `json:"reason"` // name：变量名匹配；entropy：值为高熵字符串
+}
+
+// generatedSecret 为一个工作负载生成的 Secret
+type generatedSecret struct {
+	name      string
+	namespace string
+	data      map[string]string
+}
+
+// extractSecretEnv 把文件中疑似密钥的 env 改为引用 Secret，每个工作负载生成一个 Secret 追加到文件末尾。
+// 同一工作负载中同名变量的值不同时，key 加上容器名区分；生成的 Secret 与文件中已有的或另一个生成的 Secret 同名时报错
+func extractSecretEnv(file *workload.File) ([]movedSecret, error) {
+	envs := file.FindSecretEnv()
+	if len(envs) == 0 {
+		return nil, nil
+	}
+
+	declared := make(map[kube.ObjectRef]bool)
+	for _, obj := range file.Objects() {
+		declared[objectRef(obj)] = true
+	}
+
+	var moved []movedSecret
+	var secrets []*generatedSecret
+	byObject := make(map[*yaml.Node]*generatedSecret)
+	generated := make(map[kube.ObjectRef]kube.ObjectRef) // 生成的 Secret -> 它保存密钥的工作负载
+	for _, env := range envs {
+		ref := objectRef(env.Object)
+		secret := byObject[env.Object]
+		if secret == nil {
+			secret = &generatedSecret{name: ref.Name + "-" + strings.ToLower(ref.Kind) + secretSuffix, namespace: ref.Namespace, data: make(map[string]string)}
+			secretRef := kube.ObjectRef{APIVersion: "v1", Kind: "Secret", Namespace: secret.namespace, Name: secret.name}
+			if declared[secretRef] {
+				return nil, fmt.Errorf("文件中已有 Secret %s，无法生成同名的 Secret 保存 %s 的密钥", secret.name, ref)
+			}
+			if other, ok := generated[secretRef]; ok {
+				return nil, fmt.Errorf("%s 与 %s 生成的 Secret 同名（%s）", ref, other, secret.name)
+			}
+			generated[secretRef] = ref
+			byObject[env.Object] = secret
+			secrets = append(secrets, secret)
+		}
+
+		key := env.Name
+		if value, ok := secret.data[key]; ok && value != env.Value {
+			key = env.Container + "." + env.Name
+		}
+		secret.data[key] = env.Value
+		file.MoveToSecret(env, secret.name, key)
+		moved = append(moved, movedSecret{
+			Object:    ref.String(),
+			Container: env.Container,
+			Env:       env.Name,
+			Secret:    secret.name,
+			Key:       key,
+			Reason:    env.Reason,
+		})
+		log.Infof("%s 容器 %s 的 %s 移入 Secret %s", ref, env.Container, env.Name, secret.name)
+	}
+
+	for _, secret := range secrets {
+		var node yaml.Node
+		if err := node.Encode(kube.Secret(secret.name, secret.namespace, secret.data)); err != nil {
+			return nil, fmt.Errorf("生成 Secret %s 失败: %v", secret.name, err)
+		}
+		file.Append(&node)
+	}
+	return moved, nil
+}
+
+// objectRef 返回 yaml 中对象的引用，namespace 为 yaml 中写出的值
+func objectRef(obj *yaml.Node) kube.ObjectRef {
+	metadata := workload.Get(obj, "metadata")
+	return kube.ObjectRef{
+		APIVersion: workload.ScalarValue(obj, "apiVersion"),
+		Kind:       workload.Kind(obj),
+		Namespace:  workload.ScalarValue(metadata, "namespace"),
+		Name:       workload.ScalarValue(metadata, "name"),
+	}
+}
+
+// String 显示为 对象 容器: 变量 → Secret 名称[key]（判断依据）
+func (m movedSecret) String() string {
+	reason := "变量名"
+	if m.Reason == workload.ReasonEntropy {
+		reason = "高熵值"
+	}
+	return fmt.Sprintf("%s 容器 %s: %s → Secret %s[%s]（%s）", m.Object, m.Container, m.Env, m.Secret, m.Key, reason)
+}
+
+// printMovedSecrets 逐个打印移入 Secret 的环境变量
+func printMovedSecrets(w io.Writer, moved []movedSecret) {
+	for _, m := range moved {
+		fmt.Fprintf(w, "🔐 %v\n", m)
+	}
+}
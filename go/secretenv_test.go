@@ -0,0 +1,76 @@
+package main
+
+import (
+	"dockerImageMigrator/workload"
+	"strings"
+	"testing"
+)
+
+const secretEnvWorkloads = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: harbor.local/app/web:1.0
+        env:
+        - name: MYSQL_PWD
+          value: UserPasswordnN57:2
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: migrate
+        image: harbor.local/app/web:1.0
+        env:
+        - name: MYSQL_PWD
+          value: MigratePasswordQ8z:4
+`
+
+func TestExtractSecretEnvNamesByKind(t *testing.T) {
+	file, err := workload.Parse([]byte(secretEnvWorkloads))
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved, err := extractSecretEnv(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != 2 || moved[0].Secret != "web-deployment-secrets" || moved[1].Secret != "web-job-secrets" {
+		t.Fatalf("同名的 Deployment 与 Job 应生成不同的 Secret: %v", moved)
+	}
+
+	secrets := 0
+	for _, obj := range file.Objects() {
+		if workload.Kind(obj) == "Secret" {
+			secrets++
+		}
+	}
+	data, err := file.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secrets != 2 || strings.Count(string(data), "name: web-deployment-secrets") != 2 || strings.Count(string(data), "name: web-job-secrets") != 2 {
+		t.Errorf("每个 Secret 应被生成一次并被 secretKeyRef 引用一次:\n%s", data)
+	}
+}
+
+func TestExtractSecretEnvGeneratedNameConflict(t *testing.T) {
+	// 同一文件中重复的 Deployment web 会生成同名的 Secret，后一个会覆盖前一个的密钥
+	deployment, _, _ := strings.Cut(secretEnvWorkloads, "---\n")
+	file, err := workload.Parse([]byte(deployment + "---\n" + deployment))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := extractSecretEnv(file); err == nil || !strings.Contains(err.Error(), "web-deployment-secrets") {
+		t.Errorf("生成的 Secret 同名时应报错: %v", err)
+	}
+}
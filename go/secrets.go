@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"dockerImageMigrator/vault"
+	"flag"
+	"fmt"
+	"golang.org/x/term"
+	"os"
+	"strings"
+)
+
+// 非终端输入时按行读取口令与条目值
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// readSecret 读取一行不回显的输入，标准输入不是终端时直接读取一行
+func readSecret(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, prompt)
+		data, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("读取输入失败: %v", err)
+		}
+		return string(data), nil
+	}
+	line, err := stdinReader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("读取输入失败: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// openVault 打开保险库，口令取自 MIGRATOR_VAULT_PASSPHRASE，未设置时提示输入；
+// 新建保险库时在终端上要求再次输入确认
+func openVault(path string) (*vault.Vault, error) {
+	passphrase := os.Getenv("MIGRATOR_VAULT_PASSPHRASE")
+	if passphrase == "" {
+		var err error
+		passphrase, err = readSecret(fmt.Sprintf("请输入保险库 %s 的口令: ", path))
+		if err != nil {
+			return nil, err
+		}
+		if _, statErr := os.Stat(path); os.IsNotExist(statErr) && term.IsTerminal(int(os.Stdin.Fd())) {
+			confirm, err := readSecret("保险库不存在，将新建，请再次输入口令: ")
+			if err != nil {
+				return nil, err
+			}
+			if confirm != passphrase {
+				return nil, fmt.Errorf("两次输入的口令不一致")
+			}
+		}
+	}
+	return vault.Open(path, passphrase)
+}
+
+// resolveConfigSecrets 将配置中的 vault:<名称> 引用替换为保险库中的值
+func resolveConfigSecrets() error {
+	if !cfg.HasSecretRefs() {
+		return nil
+	}
+	path := cfg.Vault
+	if path == "" {
+		path = vault.DefaultPath()
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("配置引用了保险库，但无法访问 %s: %v", path, err)
+	}
+	v, err := openVault(path)
+	if err != nil {
+		return err
+	}
+	return cfg.ResolveSecrets(v.Get)
+}
+
+// secrets 管理加密保险库中的条目
+func secrets(args []string) int {
+	fs := flag.NewFlagSet("secrets", flag.ContinueOnError)
+	path := fs.String("vault", vault.DefaultPath(), "保险库文件")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: migrator secrets [-vault 文件] set <名称> [值] | get <名称> | list | rm <名称>")
+		fmt.Fprintln(fs.Output(), "配置文件中以 vault:<名称> 引用条目，口令可通过 MIGRATOR_VAULT_PASSPHRASE 提供")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	action, rest := fs.Arg(0), fs.Args()[1:]
+	wantArgs := map[string][2]int{"set": {1, 2}, "get": {1, 1}, "list": {0, 0}, "rm": {1, 1}}
+	want, ok := wantArgs[action]
+	if !ok || len(rest) < want[0] || len(rest) > want[1] {
+		fs.Usage()
+		return exitUsage
+	}
+
+	v, err := openVault(*path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailed
+	}
+
+	switch action {
+	case "set":
+		value := ""
+		if len(rest) == 2 {
+			value = rest[1]
+		} else if value, err = readSecret(fmt.Sprintf("请输入 %s 的值: ", rest[0])); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitFailed
+		}
+		v.Set(rest[0], value)
+	case "get":
+		value, ok := v.Get(rest[0])
+		if !ok {
+			fmt.Fprintf(os.Stderr, "❌ 条目 %s 不存在\n", rest[0])
+			return exitFailed
+		}
+		fmt.Println(value)
+		return exitOK
+	case "list":
+		for _, name := range v.Names() {
+			fmt.Println(name)
+		}
+		return exitOK
+	case "rm":
+		if !v.Delete(rest[0]) {
+			fmt.Fprintf(os.Stderr, "❌ 条目 %s 不存在\n", rest[0])
+			return exitFailed
+		}
+	}
+
+	if err := v.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitFailed
+	}
+	return exitOK
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"dockerImageMigrator/log"
+	"dockerImageMigrator/server"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// serve 启动内置的 OCI 镜像仓库，供离线环境的节点直接拉取
+func serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", ":5000", "监听地址")
+	dir := fs.String("dir", "./registry-data", "镜像存储目录（OCI 布局）")
+	username := fs.String("username", "", "Basic 认证用户名，为空时允许匿名访问")
+	password := fs.String("password", os.Getenv("MIGRATOR_SERVE_PASSWORD"), "Basic 认证密码，默认读取 MIGRATOR_SERVE_PASSWORD")
+	tlsCert := fs.String("tls-cert", "", "TLS 证书文件")
+	tlsKey := fs.String("tls-key", "", "TLS 私钥文件")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		return fmt.Errorf("-tls-cert 与 -tls-key 必须同时指定")
+	}
+
+	srv, err := server.NewLocalServer(*dir)
+	if err != nil {
+		return err
+	}
+	srv.Username = *username
+	srv.Password = *password
+
+	if *tlsCert != "" {
+		log.Infof("镜像仓库已启动: https://%s，存储目录 %s", *addr, *dir)
+		return http.ListenAndServeTLS(*addr, *tlsCert, *tlsKey, srv)
+	}
+	log.Infof("镜像仓库已启动: http://%s，存储目录 %s", *addr, *dir)
+	return http.ListenAndServe(*addr, srv)
+}
@@ -0,0 +1,525 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"dockerImageMigrator/harbor"
+	"dockerImageMigrator/log"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 最大 manifest 大小，防止恶意请求占用内存
+const maxManifestSize = 4 << 20
+
+// Catalog 可选接口，存储实现它时 /v2/_catalog 才能列出仓库
+type Catalog interface {
+	Repositories() ([]string, error)
+}
+
+// Server 实现 OCI Distribution API（v2 拉取、推送、tags/list 与 catalog），
+// 镜像内容存放在任意 harbor.Registry 中，通常是本地的 OCI 布局目录
+type Server struct {
+	Store     harbor.Registry
+	UploadDir string
+	Username  string
+	Password  string
+
+	mu       sync.Mutex
+	sessions map[string]*uploadSession
+}
+
+// uploadSession 一个未完成的 blob 上传会话
+type uploadSession struct {
+	repo string
+	path string
+	size int64
+}
+
+// NewServer 创建仓库服务，上传中的分块暂存在 uploadDir
+func NewServer(store harbor.Registry, uploadDir string) (*Server, error) {
+	if err := os.MkdirAll(uploadDir, 0755); err != nil {
+		return nil, fmt.Errorf("创建上传目录失败: %v", err)
+	}
+	return &Server{
+		Store:     store,
+		UploadDir: uploadDir,
+		sessions:  make(map[string]*uploadSession),
+	}, nil
+}
+
+// NewLocalServer 创建以本地目录为存储的仓库服务
+func NewLocalServer(dir string) (*Server, error) {
+	layout, err := harbor.NewOCILayout(dir)
+	if err != nil {
+		return nil, err
+	}
+	return NewServer(layout, filepath.Join(dir, "_uploads"))
+}
+
+// registryError OCI 规范定义的错误响应
+type registryError struct {
+	status  int
+	code    string
+	message string
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
+
+func (e *registryError) write(w http.ResponseWriter) {
+	writeError(w, e.status, e.code, e.message)
+}
+
+// ServeHTTP 按 /v2/<name>/<action> 分发请求
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	defer func() {
+		log.Debugf("%s %s (%v)", r.Method, r.URL.Path, time.Since(start))
+	}()
+
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="harbor-image-migrator"`)
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+		return
+	}
+
+	path := r.URL.Path
+	switch {
+	case path == "/v2/" || path == "/v2":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+		return
+	case path == "/v2/_catalog":
+		s.handleCatalog(w, r)
+		return
+	case !strings.HasPrefix(path, "/v2/"):
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+		return
+	}
+
+	rest := strings.TrimPrefix(path, "/v2/")
+	if i := strings.LastIndex(rest, "/blobs/uploads"); i > 0 {
+		s.handleUpload(w, r, rest[:i], strings.Trim(rest[i+len("/blobs/uploads"):], "/"))
+		return
+	}
+	if i := strings.LastIndex(rest, "/manifests/"); i > 0 {
+		s.handleManifest(w, r, rest[:i], rest[i+len("/manifests/"):])
+		return
+	}
+	if i := strings.LastIndex(rest, "/blobs/"); i > 0 {
+		s.handleBlob(w, r, rest[:i], rest[i+len("/blobs/"):])
+		return
+	}
+	if strings.HasSuffix(rest, "/tags/list") {
+		s.handleTags(w, r, strings.TrimSuffix(rest, "/tags/list"))
+		return
+	}
+	writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+}
+
+// authorized 未配置账号时允许匿名访问
+func (s *Server) authorized(r *http.Request) bool {
+	if s.Username == "" && s.Password == "" {
+		return true
+	}
+	username, password, ok := r.BasicAuth()
+	return ok &&
+		subtle.ConstantTimeCompare([]byte(username), []byte(s.Username)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(s.Password)) == 1
+}
+
+func (s *Server) handleCatalog(w http.ResponseWriter, r *http.Request) {
+	catalog, ok := s.Store.(Catalog)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "UNSUPPORTED", "catalog not supported by storage")
+		return
+	}
+	repos, err := catalog.Repositories()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	repos = paginate(w, r, repos, "/v2/_catalog")
+	writeJSON(w, map[string]interface{}{"repositories": repos})
+}
+
+func (s *Server) handleTags(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+		return
+	}
+	tags, err := s.Store.ListTags(name)
+	if errors.Is(err, harbor.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	sort.Strings(tags)
+	tags = paginate(w, r, tags, "/v2/"+name+"/tags/list")
+	writeJSON(w, map[string]interface{}{"name": name, "tags": tags})
+}
+
+// paginate 处理 n 与 last 分页参数，还有后续数据时设置 Link 头
+func paginate(w http.ResponseWriter, r *http.Request, items []string, path string) []string {
+	if last := r.URL.Query().Get("last"); last != "" {
+		i := sort.SearchStrings(items, last)
+		if i < len(items) && items[i] == last {
+			i++
+		}
+		items = items[i:]
+	}
+	n, err := strconv.Atoi(r.URL.Query().Get("n"))
+	if err != nil || n <= 0 || n >= len(items) {
+		if items == nil {
+			items = []string{}
+		}
+		return items
+	}
+	items = items[:n]
+	w.Header().Set("Link", fmt.Sprintf(`<%s?n=%d&last=%s>; rel="next"`, path, n, items[n-1]))
+	return items
+}
+
+func (s *Server) handleManifest(w http.ResponseWriter, r *http.Request, name, reference string) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		data, mediaType, err := s.Store.GetManifest(name, reference)
+		if errors.Is(err, harbor.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", mediaType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Docker-Content-Digest", harbor.Digest(data))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+
+	case http.MethodPut:
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxManifestSize+1))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+			return
+		}
+		if len(data) > maxManifestSize {
+			writeError(w, http.StatusRequestEntityTooLarge, "SIZE_INVALID", "manifest too large")
+			return
+		}
+		mediaType := r.Header.Get("Content-Type")
+		if mediaType == "" {
+			mediaType = harbor.DetectMediaType(data)
+		}
+		if e := s.validateManifest(name, mediaType, data); e != nil {
+			e.write(w)
+			return
+		}
+		digest := harbor.Digest(data)
+		if strings.HasPrefix(reference, "sha256:") && reference != digest {
+			writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "provided digest did not match uploaded content")
+			return
+		}
+		if err := s.Store.PutManifest(name, reference, mediaType, data); err != nil {
+			writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+			return
+		}
+		log.Infof("收到 manifest: %s:%s (%s)", name, reference, digest)
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/manifests/%s", name, digest))
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+	}
+}
+
+// validateManifest 确认 manifest 引用的 blob 或子 manifest 均已上传
+func (s *Server) validateManifest(name, mediaType string, data []byte) *registryError {
+	var manifest harbor.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return &registryError{http.StatusBadRequest, "MANIFEST_INVALID", err.Error()}
+	}
+
+	if harbor.IsIndexMediaType(mediaType) {
+		for _, child := range manifest.Manifests {
+			exists, err := s.Store.ManifestExists(name, child.Digest)
+			if err != nil {
+				return &registryError{http.StatusInternalServerError, "UNKNOWN", err.Error()}
+			}
+			if !exists {
+				return &registryError{http.StatusBadRequest, "MANIFEST_UNKNOWN", "manifest unknown: " + child.Digest}
+			}
+		}
+		return nil
+	}
+
+	refs := manifest.Layers
+	if manifest.Config.Digest != "" {
+		refs = append([]harbor.Descriptor{manifest.Config}, refs...)
+	}
+	for _, desc := range refs {
+		exists, err := s.Store.BlobExists(name, desc.Digest)
+		if err != nil {
+			return &registryError{http.StatusInternalServerError, "UNKNOWN", err.Error()}
+		}
+		if !exists {
+			return &registryError{http.StatusBadRequest, "MANIFEST_BLOB_UNKNOWN", "blob unknown to registry: " + desc.Digest}
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleBlob(w http.ResponseWriter, r *http.Request, name, digest string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+		return
+	}
+
+	if r.Method == http.MethodHead {
+		size, err := s.Store.StatBlob(name, digest)
+		if errors.Is(err, harbor.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	reader, err := s.Store.GetBlob(name, digest)
+	if errors.Is(err, harbor.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	defer reader.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", digest)
+
+	// 本地文件支持 Range 请求，便于断点续传
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", time.Time{}, seeker)
+		return
+	}
+	if size, err := s.Store.StatBlob(name, digest); err == nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, reader)
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request, name, id string) {
+	if id == "" {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+			return
+		}
+		s.startUpload(w, r, name)
+		return
+	}
+
+	s.mu.Lock()
+	session, ok := s.sessions[id]
+	s.mu.Unlock()
+	if !ok || session.repo != name {
+		writeError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "blob upload unknown to registry")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.writeUploadStatus(w, name, id, session, http.StatusNoContent)
+	case http.MethodPatch:
+		if err := s.appendChunk(session, r.Body); err != nil {
+			writeError(w, http.StatusInternalServerError, "BLOB_UPLOAD_INVALID", err.Error())
+			return
+		}
+		s.writeUploadStatus(w, name, id, session, http.StatusAccepted)
+	case http.MethodPut:
+		if err := s.appendChunk(session, r.Body); err != nil {
+			writeError(w, http.StatusInternalServerError, "BLOB_UPLOAD_INVALID", err.Error())
+			return
+		}
+		s.finishUpload(w, name, id, session, r.URL.Query().Get("digest"))
+	case http.MethodDelete:
+		s.dropSession(id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+	}
+}
+
+// startUpload 处理 POST：支持跨仓库挂载、单次上传（带 digest）和开启会话
+func (s *Server) startUpload(w http.ResponseWriter, r *http.Request, name string) {
+	query := r.URL.Query()
+	if mount, from := query.Get("mount"), query.Get("from"); mount != "" && from != "" {
+		mounted, err := s.Store.MountBlob(name, from, mount)
+		if err == nil && mounted {
+			w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/%s", name, mount))
+			w.Header().Set("Docker-Content-Digest", mount)
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	session := &uploadSession{repo: name, path: filepath.Join(s.UploadDir, id)}
+	if err := os.WriteFile(session.path, nil, 0644); err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	s.mu.Lock()
+	s.sessions[id] = session
+	s.mu.Unlock()
+
+	if digest := query.Get("digest"); digest != "" {
+		if err := s.appendChunk(session, r.Body); err != nil {
+			s.dropSession(id)
+			writeError(w, http.StatusInternalServerError, "BLOB_UPLOAD_INVALID", err.Error())
+			return
+		}
+		s.finishUpload(w, name, id, session, digest)
+		return
+	}
+	s.writeUploadStatus(w, name, id, session, http.StatusAccepted)
+}
+
+func (s *Server) appendChunk(session *uploadSession, body io.Reader) error {
+	file, err := os.OpenFile(session.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	n, err := io.Copy(file, body)
+	s.mu.Lock()
+	session.size += n
+	s.mu.Unlock()
+	return err
+}
+
+// finishUpload 校验 digest 后将暂存文件写入存储
+func (s *Server) finishUpload(w http.ResponseWriter, name, id string, session *uploadSession, digest string) {
+	defer s.dropSession(id)
+	if digest == "" {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "digest parameter required")
+		return
+	}
+
+	actual, err := fileDigest(session.path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	if actual != digest {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", fmt.Sprintf("digest mismatch: expected %s, got %s", digest, actual))
+		return
+	}
+
+	file, err := os.Open(session.path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	err = s.Store.PutBlob(name, digest, session.size, file)
+	file.Close()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/%s", name, digest))
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) writeUploadStatus(w http.ResponseWriter, name, id string, session *uploadSession, status int) {
+	s.mu.Lock()
+	size := session.size
+	s.mu.Unlock()
+
+	w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", name, id))
+	w.Header().Set("Docker-Upload-UUID", id)
+	if size > 0 {
+		w.Header().Set("Range", fmt.Sprintf("0-%d", size-1))
+	} else {
+		w.Header().Set("Range", "0-0")
+	}
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(status)
+}
+
+func (s *Server) dropSession(id string) {
+	s.mu.Lock()
+	session, ok := s.sessions[id]
+	delete(s.sessions, id)
+	s.mu.Unlock()
+	if ok {
+		os.Remove(session.path)
+	}
+}
+
+func newSessionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成上传会话 ID 失败: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
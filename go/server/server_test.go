@@ -0,0 +1,298 @@
+package server_test
+
+import (
+	"dockerImageMigrator/harbor"
+	"dockerImageMigrator/log"
+	"dockerImageMigrator/server"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	log.Init()
+	os.Exit(m.Run())
+}
+
+func newServer(t *testing.T) (*server.Server, *harbor.MemoryRegistry) {
+	t.Helper()
+	store := harbor.NewMemoryRegistry()
+	s, err := server.NewServer(store, t.TempDir())
+	if err != nil {
+		t.Fatalf("创建仓库服务失败: %v", err)
+	}
+	return s, store
+}
+
+// do 发送请求并返回响应
+func do(s http.Handler, method, target string, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+// errorCode 取出错误响应中的第一个 code
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body struct {
+		Errors []struct{ Code string } `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || len(body.Errors) == 0 {
+		t.Fatalf("不是错误响应: %d %s", w.Code, w.Body)
+	}
+	return body.Errors[0].Code
+}
+
+// manifestFor 生成引用 blobs 的镜像 manifest
+func manifestFor(t *testing.T, config string, layers ...string) []byte {
+	t.Helper()
+	manifest := harbor.Manifest{
+		MediaType:     harbor.MediaTypeDockerManifest,
+		SchemaVersion: 2,
+		Config:        harbor.Descriptor{MediaType: "application/vnd.docker.container.image.v1+json", Size: int64(len(config)), Digest: harbor.Digest([]byte(config))},
+	}
+	for _, layer := range layers {
+		manifest.Layers = append(manifest.Layers, harbor.Descriptor{
+			MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip",
+			Size:      int64(len(layer)),
+			Digest:    harbor.Digest([]byte(layer)),
+		})
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestAuthentication(t *testing.T) {
+	s, _ := newServer(t)
+	s.Username, s.Password = "admin", "Harbor12345"
+
+	w := do(s, "GET", "/v2/", "")
+	if w.Code != http.StatusUnauthorized || !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Basic ") {
+		t.Fatalf("未认证时应返回 401 与 Basic 质询: %d %v", w.Code, w.Header())
+	}
+	req := httptest.NewRequest("GET", "/v2/", nil)
+	req.SetBasicAuth("admin", "wrong")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("密码错误时应返回 401: %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/v2/", nil)
+	req.SetBasicAuth("admin", "Harbor12345")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Docker-Distribution-API-Version") != "registry/2.0" {
+		t.Errorf("认证通过时应返回 200: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestChunkedBlobUpload(t *testing.T) {
+	s, store := newServer(t)
+	data := "hello layer content"
+	digest := harbor.Digest([]byte(data))
+
+	w := do(s, "POST", "/v2/library/app/blobs/uploads/", "")
+	location := w.Header().Get("Location")
+	if w.Code != http.StatusAccepted || !strings.HasPrefix(location, "/v2/library/app/blobs/uploads/") {
+		t.Fatalf("开启上传会话失败: %d %s", w.Code, location)
+	}
+
+	w = do(s, "PATCH", location, data[:5])
+	if w.Code != http.StatusAccepted || w.Header().Get("Range") != "0-4" {
+		t.Fatalf("上传分块失败: %d Range=%s", w.Code, w.Header().Get("Range"))
+	}
+	if w := do(s, "GET", location, ""); w.Code != http.StatusNoContent || w.Header().Get("Range") != "0-4" {
+		t.Errorf("查询上传进度错误: %d Range=%s", w.Code, w.Header().Get("Range"))
+	}
+	if w := do(s, "PATCH", "/v2/other/app/blobs/uploads/"+strings.TrimPrefix(location, "/v2/library/app/blobs/uploads/"), "x"); w.Code != http.StatusNotFound {
+		t.Errorf("会话不属于该仓库时应返回 404: %d", w.Code)
+	}
+
+	w = do(s, "PUT", location+"?digest="+digest, data[5:])
+	if w.Code != http.StatusCreated || w.Header().Get("Docker-Content-Digest") != digest {
+		t.Fatalf("完成上传失败: %d %s", w.Code, w.Body)
+	}
+	if ok, _ := store.BlobExists("library/app", digest); !ok {
+		t.Fatal("上传完成后存储中应有 blob")
+	}
+	if w := do(s, "PATCH", location, "x"); w.Code != http.StatusNotFound || errorCode(t, w) != "BLOB_UPLOAD_UNKNOWN" {
+		t.Errorf("完成后会话应失效: %d", w.Code)
+	}
+
+	w = do(s, "HEAD", "/v2/library/app/blobs/"+digest, "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Length") != "19" {
+		t.Errorf("HEAD blob 错误: %d %v", w.Code, w.Header())
+	}
+	w = do(s, "GET", "/v2/library/app/blobs/"+digest, "")
+	if w.Code != http.StatusOK || w.Body.String() != data {
+		t.Errorf("GET blob 错误: %d %q", w.Code, w.Body)
+	}
+	if w := do(s, "GET", "/v2/library/app/blobs/"+harbor.Digest([]byte("missing")), ""); w.Code != http.StatusNotFound || errorCode(t, w) != "BLOB_UNKNOWN" {
+		t.Errorf("blob 不存在时应返回 404: %d", w.Code)
+	}
+}
+
+func TestMonolithicUploadAndMount(t *testing.T) {
+	s, store := newServer(t)
+	data := "single request layer"
+	digest := harbor.Digest([]byte(data))
+
+	if w := do(s, "POST", "/v2/library/app/blobs/uploads/?digest="+harbor.Digest([]byte("other")), data); w.Code != http.StatusBadRequest || errorCode(t, w) != "DIGEST_INVALID" {
+		t.Fatalf("digest 不匹配时应拒绝: %d %s", w.Code, w.Body)
+	}
+	if ok, _ := store.BlobExists("library/app", digest); ok {
+		t.Fatal("digest 不匹配的 blob 不应写入存储")
+	}
+
+	w := do(s, "POST", "/v2/library/app/blobs/uploads/?digest="+digest, data)
+	if w.Code != http.StatusCreated || w.Header().Get("Location") != "/v2/library/app/blobs/"+digest {
+		t.Fatalf("单次上传失败: %d %v", w.Code, w.Header())
+	}
+
+	w = do(s, "POST", "/v2/mirror/app/blobs/uploads/?mount="+digest+"&from=library/app", "")
+	if w.Code != http.StatusCreated || w.Header().Get("Docker-Content-Digest") != digest {
+		t.Errorf("blob 已存在时应挂载成功: %d %v", w.Code, w.Header())
+	}
+	w = do(s, "POST", "/v2/mirror/app/blobs/uploads/?mount="+harbor.Digest([]byte("missing"))+"&from=library/app", "")
+	if w.Code != http.StatusAccepted || w.Header().Get("Docker-Upload-UUID") == "" {
+		t.Errorf("无法挂载时应改为开启上传会话: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestManifest(t *testing.T) {
+	s, store := newServer(t)
+	config, layer := `{"architecture":"amd64"}`, "layer"
+	manifest := manifestFor(t, config, layer)
+	digest := harbor.Digest(manifest)
+	contentType := []string{"Content-Type", harbor.MediaTypeDockerManifest}
+
+	w := do(s, "PUT", "/v2/library/app/manifests/v1", string(manifest), contentType...)
+	if w.Code != http.StatusBadRequest || errorCode(t, w) != "MANIFEST_BLOB_UNKNOWN" {
+		t.Fatalf("引用的 blob 未上传时应拒绝: %d %s", w.Code, w.Body)
+	}
+
+	for _, blob := range []string{config, layer} {
+		if err := store.PutBlob("library/app", harbor.Digest([]byte(blob)), -1, strings.NewReader(blob)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w := do(s, "PUT", "/v2/library/app/manifests/"+harbor.Digest([]byte("other")), string(manifest), contentType...); w.Code != http.StatusBadRequest || errorCode(t, w) != "DIGEST_INVALID" {
+		t.Errorf("按 digest 写入时内容不符应拒绝: %d %s", w.Code, w.Body)
+	}
+	w = do(s, "PUT", "/v2/library/app/manifests/v1", string(manifest), contentType...)
+	if w.Code != http.StatusCreated || w.Header().Get("Docker-Content-Digest") != digest {
+		t.Fatalf("写入 manifest 失败: %d %s", w.Code, w.Body)
+	}
+
+	for _, reference := range []string{"v1", digest} {
+		w = do(s, "GET", "/v2/library/app/manifests/"+reference, "")
+		if w.Code != http.StatusOK || w.Body.String() != string(manifest) ||
+			w.Header().Get("Content-Type") != harbor.MediaTypeDockerManifest || w.Header().Get("Docker-Content-Digest") != digest {
+			t.Errorf("按 %s 读取 manifest 错误: %d %v", reference, w.Code, w.Header())
+		}
+	}
+	w = do(s, "HEAD", "/v2/library/app/manifests/v1", "")
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("HEAD 不应返回内容: %d %d", w.Code, w.Body.Len())
+	}
+	if w := do(s, "GET", "/v2/library/app/manifests/v2", ""); w.Code != http.StatusNotFound || errorCode(t, w) != "MANIFEST_UNKNOWN" {
+		t.Errorf("tag 不存在时应返回 404: %d", w.Code)
+	}
+	if w := do(s, "DELETE", "/v2/library/app/manifests/v1", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("不支持删除: %d", w.Code)
+	}
+}
+
+func TestTagsAndCatalogPagination(t *testing.T) {
+	s, store := newServer(t)
+	config := `{}`
+	if err := store.PutBlob("", harbor.Digest([]byte(config)), -1, strings.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+	manifest := manifestFor(t, config)
+	for _, ref := range []string{"a/app:v1", "a/app:v2", "a/app:v3", "b/app:v1"} {
+		repo, tag, _ := strings.Cut(ref, ":")
+		if err := store.PutManifest(repo, tag, harbor.MediaTypeDockerManifest, manifest); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := do(s, "GET", "/v2/a/app/tags/list?n=2", "")
+	var tags struct {
+		Name string
+		Tags []string
+	}
+	json.Unmarshal(w.Body.Bytes(), &tags)
+	if w.Code != http.StatusOK || tags.Name != "a/app" || strings.Join(tags.Tags, ",") != "v1,v2" {
+		t.Fatalf("第一页 tag 错误: %d %s", w.Code, w.Body)
+	}
+	if link := w.Header().Get("Link"); link != `</v2/a/app/tags/list?n=2&last=v2>; rel="next"` {
+		t.Errorf("Link 头错误: %s", link)
+	}
+	w = do(s, "GET", "/v2/a/app/tags/list?n=2&last=v2", "")
+	json.Unmarshal(w.Body.Bytes(), &tags)
+	if strings.Join(tags.Tags, ",") != "v3" || w.Header().Get("Link") != "" {
+		t.Errorf("最后一页 tag 错误: %s Link=%s", w.Body, w.Header().Get("Link"))
+	}
+	if w := do(s, "GET", "/v2/c/app/tags/list", ""); w.Code != http.StatusNotFound || errorCode(t, w) != "NAME_UNKNOWN" {
+		t.Errorf("仓库不存在时应返回 404: %d", w.Code)
+	}
+
+	w = do(s, "GET", "/v2/_catalog", "")
+	var catalog struct{ Repositories []string }
+	json.Unmarshal(w.Body.Bytes(), &catalog)
+	if w.Code != http.StatusOK || strings.Join(catalog.Repositories, ",") != "a/app,b/app" {
+		t.Errorf("catalog 错误: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestLocalServerRoundTrip(t *testing.T) {
+	s, err := server.NewLocalServer(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	client := harbor.NewHTTPRegistry(ts.URL, "", "")
+	config, layer := `{"architecture":"arm64"}`, strings.Repeat("layer", 1000)
+	src := harbor.NewMemoryRegistry()
+	for _, blob := range []string{config, layer} {
+		if err := src.PutBlob("app", harbor.Digest([]byte(blob)), -1, strings.NewReader(blob)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manifest := manifestFor(t, config, layer)
+	if err := src.PutManifest("app", "v1", harbor.MediaTypeDockerManifest, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if err := harbor.CopyImage(src, "app", "v1", client, "mirror/app", "v1"); err != nil {
+		t.Fatalf("推送到本地仓库服务失败: %v", err)
+	}
+
+	reader, err := client.GetBlob("mirror/app", harbor.Digest([]byte(layer)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(got) != layer {
+		t.Error("从本地仓库服务读回的层内容不一致")
+	}
+	tags, err := client.ListTags("mirror/app")
+	if err != nil || len(tags) != 1 || tags[0] != "v1" {
+		t.Errorf("tag 错误: %v %v", tags, err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"dockerImageMigrator/log"
 	"fmt"
 	"golang.org/x/crypto/ssh"
+	"io"
 	"os"
 	"path/filepath"
 	"time"
@@ -74,6 +75,11 @@ func (s *SSHClient) Connect() error {
 
 // ExecuteCommand 执行远程命令
 func (s *SSHClient) ExecuteCommand(cmd string) (string, error) {
+	return s.ExecuteCommandWithInput(cmd, nil)
+}
+
+// ExecuteCommandWithInput 执行远程命令，input 不为 nil 时作为命令的标准输入，内容不会落盘到远程主机
+func (s *SSHClient) ExecuteCommandWithInput(cmd string, input io.Reader) (string, error) {
 	if s.client == nil {
 		return "", fmt.Errorf("client not connected")
 	}
@@ -83,6 +89,7 @@ func (s *SSHClient) ExecuteCommand(cmd string) (string, error) {
 		return "", fmt.Errorf("failed to create session: %v", err)
 	}
 	defer session.Close()
+	session.Stdin = input
 
 	log.Infof("Executing command: %s", cmd)
 	output, err := session.CombinedOutput(cmd)
@@ -0,0 +1,223 @@
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/scrypt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RefPrefix 配置中引用保险库条目的前缀，如 password: vault:harbor-prod
+const RefPrefix = "vault:"
+
+// scrypt 参数
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+	keyLen  = 32
+)
+
+// ErrWrongPassphrase 口令错误或文件被篡改
+var ErrWrongPassphrase = errors.New("口令错误或保险库文件已损坏")
+
+// file 保险库文件的格式，data 为 AES-256-GCM 加密后的 JSON
+type file struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// Vault 以口令加密的本地密钥保险库
+type Vault struct {
+	Path string
+
+	key     []byte
+	salt    []byte
+	n, r, p int // 派生 key 时使用的 scrypt 参数，Save 时原样写回
+	secrets map[string]string
+}
+
+// DefaultPath 返回 MIGRATOR_VAULT 或 ~/.migrator/vault.json
+func DefaultPath() string {
+	if path := os.Getenv("MIGRATOR_VAULT"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "vault.json"
+	}
+	return filepath.Join(home, ".migrator", "vault.json")
+}
+
+// IsRef 判断配置值是否为保险库引用，返回条目名
+func IsRef(value string) (string, bool) {
+	name, ok := strings.CutPrefix(value, RefPrefix)
+	return name, ok && name != ""
+}
+
+// Open 打开保险库，文件不存在时返回一个空的保险库，Save 时以该口令创建
+func Open(path, passphrase string) (*Vault, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("口令不能为空")
+	}
+	v := &Vault{Path: path, n: scryptN, r: scryptR, p: scryptP, secrets: make(map[string]string)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		v.salt = make([]byte, 16)
+		if _, err := rand.Read(v.salt); err != nil {
+			return nil, fmt.Errorf("生成随机数失败: %v", err)
+		}
+		v.key, err = deriveKey(passphrase, v.salt, v.n, v.r, v.p)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取保险库失败: %v", err)
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("解析保险库 %s 失败: %v", path, err)
+	}
+	if f.Version != 1 || f.KDF != "scrypt" {
+		return nil, fmt.Errorf("不支持的保险库格式: version=%d kdf=%s", f.Version, f.KDF)
+	}
+	v.salt, v.n, v.r, v.p = f.Salt, f.N, f.R, f.P
+	v.key, err = deriveKey(passphrase, v.salt, v.n, v.r, v.p)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(v.key)
+	if err != nil {
+		return nil, err
+	}
+	// nonce 长度不对时 gcm.Open 会 panic，按文件损坏处理
+	if len(f.Nonce) != gcm.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	plain, err := gcm.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	if err := json.Unmarshal(plain, &v.secrets); err != nil {
+		return nil, fmt.Errorf("解析保险库内容失败: %v", err)
+	}
+	return v, nil
+}
+
+func deriveKey(passphrase string, salt []byte, n, r, p int) ([]byte, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, n, r, p, keyLen)
+	if err != nil {
+		return nil, fmt.Errorf("派生密钥失败: %v", err)
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("初始化加密失败: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// Get 返回条目的值
+func (v *Vault) Get(name string) (string, bool) {
+	value, ok := v.secrets[name]
+	return value, ok
+}
+
+// Set 设置条目，需要调用 Save 写入文件
+func (v *Vault) Set(name, value string) {
+	v.secrets[name] = value
+}
+
+// Delete 删除条目，条目不存在时返回 false
+func (v *Vault) Delete(name string) bool {
+	if _, ok := v.secrets[name]; !ok {
+		return false
+	}
+	delete(v.secrets, name)
+	return true
+}
+
+// Names 返回所有条目名，按字母排序
+func (v *Vault) Names() []string {
+	names := make([]string, 0, len(v.secrets))
+	for name := range v.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save 加密后写入文件，每次保存使用新的 nonce
+func (v *Vault) Save() error {
+	plain, err := json.Marshal(v.secrets)
+	if err != nil {
+		return fmt.Errorf("序列化保险库失败: %v", err)
+	}
+	gcm, err := newGCM(v.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("生成随机数失败: %v", err)
+	}
+
+	data, err := json.MarshalIndent(file{
+		Version: 1,
+		KDF:     "scrypt",
+		Salt:    v.salt,
+		N:       v.n,
+		R:       v.r,
+		P:       v.p,
+		Nonce:   nonce,
+		Data:    gcm.Seal(nil, nonce, plain, nil),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化保险库失败: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(v.Path), 0700); err != nil {
+		return fmt.Errorf("创建保险库目录失败: %v", err)
+	}
+	// 先写临时文件再重命名，避免写入中断时损坏原文件
+	tmp, err := os.CreateTemp(filepath.Dir(v.Path), ".vault-*")
+	if err != nil {
+		return fmt.Errorf("写入保险库失败: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入保险库失败: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入保险库失败: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return fmt.Errorf("写入保险库失败: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), v.Path); err != nil {
+		return fmt.Errorf("写入保险库失败: %v", err)
+	}
+	return nil
+}
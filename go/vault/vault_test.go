@@ -0,0 +1,134 @@
+package vault
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVaultRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "vault.json")
+
+	v, err := Open(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Set("harbor-prod", "Harbor12345")
+	v.Set("ssh-root", "pa:ss")
+	if err := v.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "Harbor12345") {
+		t.Fatal("保险库文件中不应出现明文")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Fatalf("保险库文件权限应为 0600: %v", info.Mode())
+	}
+
+	v, err = Open(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := v.Get("harbor-prod"); !ok || got != "Harbor12345" {
+		t.Fatalf("读取条目失败: %q %v", got, ok)
+	}
+	if names := v.Names(); strings.Join(names, ",") != "harbor-prod,ssh-root" {
+		t.Fatalf("条目列表不正确: %v", names)
+	}
+	if !v.Delete("ssh-root") || v.Delete("ssh-root") {
+		t.Fatal("删除条目结果不正确")
+	}
+
+	if _, err := Open(path, "wrong"); err != ErrWrongPassphrase {
+		t.Fatalf("错误口令应返回 ErrWrongPassphrase，得到 %v", err)
+	}
+}
+
+func TestVaultCorruptedNonce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.json")
+	v, err := Open(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Set("harbor-prod", "Harbor12345")
+	if err := v.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatal(err)
+	}
+	f.Nonce = f.Nonce[:4]
+	if data, err = json.Marshal(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, "correct horse"); err != ErrWrongPassphrase {
+		t.Fatalf("nonce 长度错误时应返回 ErrWrongPassphrase，得到 %v", err)
+	}
+}
+
+func TestVaultKeepsScryptParameters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.json")
+	v, err := Open(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 模拟以其他参数创建的保险库
+	v.n, v.r, v.p = 1<<10, 4, 2
+	v.key, err = deriveKey("correct horse", v.salt, v.n, v.r, v.p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err = Open(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Set("harbor-prod", "Harbor12345")
+	if err := v.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatal(err)
+	}
+	if f.N != 1<<10 || f.R != 4 || f.P != 2 {
+		t.Fatalf("保存时应写回打开时的 scrypt 参数: n=%d r=%d p=%d", f.N, f.R, f.P)
+	}
+	if _, err := Open(path, "correct horse"); err != nil {
+		t.Fatalf("保存后应能以原口令打开: %v", err)
+	}
+}
+
+func TestIsRef(t *testing.T) {
+	if name, ok := IsRef("vault:harbor-prod"); !ok || name != "harbor-prod" {
+		t.Fatalf("应识别为引用: %q %v", name, ok)
+	}
+	for _, value := range []string{"Harbor12345", "vault:", ""} {
+		if _, ok := IsRef(value); ok {
+			t.Errorf("%q 不应识别为引用", value)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"dockerImageMigrator/harbor"
+	"dockerImageMigrator/workload"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// verify 校验源与目标仓库中的镜像是否一致，参数可以是镜像地址或 k8s yaml 文件
+func verify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	rehash := fs.Bool("rehash", false, "下载目标端的每个 blob 并重新计算 sha256")
+	jsonOutput := fs.Bool("json", false, "以 JSON 格式输出报告")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: migrator verify [-rehash] [-json] <镜像地址|yaml文件|->...")
+		fmt.Fprintln(fs.Output(), "参数为 - 时从标准输入逐行读取镜像地址")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	images, err := collectImages(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+
+	var results []*harbor.VerifyResult
+	failed := 0
+	for _, image := range images {
+		registry, path, tag, err := parseImage(image)
+		if err != nil {
+			results = append(results, &harbor.VerifyResult{Source: image, Problems: []string{err.Error()}})
+			failed++
+			continue
+		}
+
+		dest, _ := destImage(path, tag)
+		result := harbor.VerifyMigration(sourceHarbor(registry, path, tag), dest, *rehash)
+		result.Source = image
+		if !result.OK() {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if *jsonOutput {
+		printJSON(results)
+	} else {
+		printVerifyReport(results)
+	}
+
+	if failed > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// collectImages 展开参数中的 yaml 文件与标准输入，返回去重后的镜像列表
+func collectImages(args []string) ([]string, error) {
+	args, err := expandStdinArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []string
+	seen := make(map[string]bool)
+	add := func(image string) {
+		if !seen[image] {
+			seen[image] = true
+			images = append(images, image)
+		}
+	}
+
+	for _, arg := range args {
+		ext := strings.ToLower(filepath.Ext(arg))
+		if ext != ".yaml" && ext != ".yml" {
+			add(arg)
+			continue
+		}
+
+		file, err := workload.ReadFile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", arg, err)
+		}
+		for _, field := range file.AllImages(imagePathRules) {
+			add(field.Value)
+		}
+	}
+	return images, nil
+}
+
+// printVerifyReport 逐个镜像打印校验结果
+func printVerifyReport(results []*harbor.VerifyResult) {
+	passed := 0
+	for _, result := range results {
+		if result.OK() {
+			passed++
+			fmt.Printf("✅ PASS %s -> %s (%s, %d 个 blob)\n", result.Source, result.Dest, result.DestDigest, result.BlobsChecked)
+			continue
+		}
+		fmt.Printf("❌ FAIL %s -> %s\n", result.Source, result.Dest)
+		for _, problem := range result.Problems {
+			fmt.Printf("    - %s\n", problem)
+		}
+	}
+	fmt.Printf("\n共 %d 个镜像，通过 %d，失败 %d\n", len(results), passed, len(results)-passed)
+}
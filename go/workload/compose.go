@@ -0,0 +1,36 @@
+package workload
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+// IsCompose 判断是否为 docker compose 文件：顶层有 services 且不是 k8s 对象
+func (f *File) IsCompose() bool {
+	if len(f.Docs) != 1 || len(f.Docs[0].Content) == 0 {
+		return false
+	}
+	root := f.Docs[0].Content[0]
+	if Kind(root) != "" || ScalarValue(root, "apiVersion") != "" {
+		return false
+	}
+	services := Get(root, "services")
+	return services != nil && services.Kind == yaml.MappingNode
+}
+
+// ComposeImages 返回 compose 文件中 services.*.image 字段
+func (f *File) ComposeImages() []*ImageField {
+	if !f.IsCompose() {
+		return nil
+	}
+	var fields []*ImageField
+	services := Get(f.Docs[0].Content[0], "services")
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		image := Get(services.Content[i+1], "image")
+		if image == nil || image.Kind != yaml.ScalarNode {
+			continue
+		}
+		path := "services." + services.Content[i].Value + ".image"
+		fields = append(fields, &ImageField{Path: path, Value: image.Value, node: image, file: f})
+	}
+	return fields
+}
@@ -0,0 +1,52 @@
+package workload
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComposeImages(t *testing.T) {
+	source := `# 边缘站点
+services:
+  web:
+    image: registry.local/edge/web:1   # 前端
+    ports:
+      - "80:80"
+  worker:
+    build: ./worker
+  db:
+    image: "registry.local/edge/mysql:8"
+`
+	f, err := Parse([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.IsCompose() {
+		t.Fatal("应识别为 compose 文件")
+	}
+
+	fields := f.AllImages(nil)
+	if len(fields) != 2 || fields[0].Path != "services.web.image" || fields[1].Path != "services.db.image" {
+		t.Fatalf("字段不正确: %+v", fields)
+	}
+	for _, field := range fields {
+		field.Set(strings.Replace(field.Value, "registry.local", "harbor.local", 1))
+	}
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.ReplaceAll(source, "registry.local", "harbor.local"); string(data) != want {
+		t.Fatalf("输出与期望不一致:\n%s", data)
+	}
+}
+
+func TestIsComposeRejectsKubernetes(t *testing.T) {
+	f, err := Parse([]byte("apiVersion: v1\nkind: Service\nservices:\n  a: {}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.IsCompose() {
+		t.Fatal("k8s 对象不应识别为 compose 文件")
+	}
+}
@@ -0,0 +1,295 @@
+package workload
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// File 一个可能包含多个文档的 yaml 文件。
+// 修改镜像后写回时直接在原文上替换对应的标量，注释、键顺序、锚点与引号风格都保持不变；
+// 结构被修改的文档（新增或删除字段）单独重新序列化，其余文档保持原样
+type File struct {
+	Docs []*yaml.Node
+
+	source   []byte
+	parsed   int // 从 source 解析出的文档数，之后的文档为新追加的
+	edited   []*yaml.Node
+	modified map[*yaml.Node]bool
+}
+
+// ReadFile 读取并解析 yaml 文件
+func ReadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取yaml文件失败: %v", err)
+	}
+	return Parse(data)
+}
+
+// Parse 解析 yaml 内容
+func Parse(data []byte) (*File, error) {
+	f := &File{source: data}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("解码YAML文档失败: %v", err)
+		}
+		f.Docs = append(f.Docs, &doc)
+	}
+	f.parsed = len(f.Docs)
+	return f, nil
+}
+
+// Set 修改文件中的一个标量节点，写回时只替换该标量
+func (f *File) Set(node *yaml.Node, value string) {
+	if node.Value == value {
+		return
+	}
+	node.Value = value
+	for _, n := range f.edited {
+		if n == node {
+			return
+		}
+	}
+	f.edited = append(f.edited, node)
+}
+
+// MarkModified 标记文档的结构已被修改，写回时重新序列化该文档
+func (f *File) MarkModified(doc *yaml.Node) {
+	if f.modified == nil {
+		f.modified = make(map[*yaml.Node]bool)
+	}
+	f.modified[doc] = true
+}
+
+// Append 在文件末尾追加一个文档
+func (f *File) Append(root *yaml.Node) {
+	f.Docs = append(f.Docs, &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}})
+}
+
+// Bytes 返回修改后的 yaml 内容
+func (f *File) Bytes() ([]byte, error) {
+	if len(f.edited) == 0 && len(f.modified) == 0 && len(f.Docs) == f.parsed {
+		return append([]byte(nil), f.source...), nil
+	}
+
+	lines, err := f.splice()
+	if err != nil {
+		// 多行标量等无法原地替换的情况，退回到重新序列化（仍保留注释）
+		return f.encode()
+	}
+
+	var buf bytes.Buffer
+	line := 0
+	for _, doc := range f.Docs[:f.parsed] {
+		if !f.modified[doc] || len(doc.Content) == 0 {
+			continue
+		}
+		start, end := docLines(lines, doc.Content[0].Line-1)
+		// 保留文档前的分隔行
+		if start < len(lines) && isDocSeparator(lines[start]) {
+			start++
+		}
+		buf.WriteString(strings.Join(lines[line:start], ""))
+		data, err := encodeDoc(doc)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+		line = end
+	}
+	buf.WriteString(strings.Join(lines[line:], ""))
+
+	for _, doc := range f.Docs[f.parsed:] {
+		if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteString("\n")
+		}
+		if buf.Len() > 0 {
+			buf.WriteString("---\n")
+		}
+		data, err := encodeDoc(doc)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+// docLines 返回第 line 行（从 0 开始）所在文档的行范围，包含文档前的分隔行
+func docLines(lines []string, line int) (start, end int) {
+	start = 0
+	for i := line; i >= 0 && i < len(lines); i-- {
+		if isDocSeparator(lines[i]) {
+			start = i
+			break
+		}
+	}
+	end = len(lines)
+	for i := line + 1; i < len(lines); i++ {
+		if isDocSeparator(lines[i]) || strings.HasPrefix(lines[i], "...") {
+			end = i
+			break
+		}
+	}
+	return start, end
+}
+
+// isDocSeparator 判断是否为文档分隔行 ---
+func isDocSeparator(line string) bool {
+	if !strings.HasPrefix(line, "---") {
+		return false
+	}
+	rest := line[3:]
+	return rest == "" || rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\n' || rest[0] == '\r'
+}
+
+// splice 在原文上逐个替换被修改的标量，从后往前处理以免位置偏移
+func (f *File) splice() ([]string, error) {
+	lines := strings.SplitAfter(string(f.source), "\n")
+	edits := append([]*yaml.Node(nil), f.edited...)
+	sort.Slice(edits, func(i, j int) bool {
+		if edits[i].Line != edits[j].Line {
+			return edits[i].Line > edits[j].Line
+		}
+		return edits[i].Column > edits[j].Column
+	})
+
+	for _, node := range edits {
+		if node.Line < 1 || node.Line > len(lines) {
+			return nil, fmt.Errorf("第 %d 行超出范围", node.Line)
+		}
+		line := []rune(lines[node.Line-1])
+		start := skipProperties(line, node.Column-1)
+		end, err := scalarEnd(line, start, node.Style)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行: %v", node.Line, err)
+		}
+		replaced := string(line[:start]) + quoteScalar(node.Value, node.Style) + string(line[end:])
+		lines[node.Line-1] = replaced
+	}
+	return lines, nil
+}
+
+// skipProperties 跳过标量前的锚点 &name 与标签 !tag，返回标量内容的起始位置。
+// 节点的列指向这些属性而不是标量本身，替换时需要保留它们
+func skipProperties(line []rune, start int) int {
+	for start >= 0 && start < len(line) && (line[start] == '&' || line[start] == '!') {
+		for start < len(line) && line[start] != ' ' && line[start] != '\t' && line[start] != '\n' && line[start] != '\r' {
+			start++
+		}
+		for start < len(line) && (line[start] == ' ' || line[start] == '\t') {
+			start++
+		}
+	}
+	return start
+}
+
+// scalarEnd 返回从 start 开始的单行标量在原文中的结束位置
+func scalarEnd(line []rune, start int, style yaml.Style) (int, error) {
+	if start < 0 || start >= len(line) {
+		return 0, fmt.Errorf("列超出范围")
+	}
+
+	switch {
+	case style&yaml.DoubleQuotedStyle != 0:
+		if line[start] != '"' {
+			return 0, fmt.Errorf("未找到双引号")
+		}
+		for i := start + 1; i < len(line); i++ {
+			switch line[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1, nil
+			}
+		}
+		return 0, fmt.Errorf("双引号标量跨行")
+
+	case style&yaml.SingleQuotedStyle != 0:
+		if line[start] != '\'' {
+			return 0, fmt.Errorf("未找到单引号")
+		}
+		for i := start + 1; i < len(line); i++ {
+			if line[i] == '\'' {
+				if i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					continue
+				}
+				return i + 1, nil
+			}
+		}
+		return 0, fmt.Errorf("单引号标量跨行")
+
+	case style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+		return 0, fmt.Errorf("不支持块标量")
+
+	default:
+		// 普通标量到注释、流式集合的分隔符或行尾为止
+		end := len(line)
+		for i := start; i < len(line); i++ {
+			c := line[i]
+			if c == '\n' || c == '\r' || c == ',' || c == ']' || c == '}' ||
+				(c == '#' && i > start && (line[i-1] == ' ' || line[i-1] == '\t')) {
+				end = i
+				break
+			}
+		}
+		for end > start && (line[end-1] == ' ' || line[end-1] == '\t') {
+			end--
+		}
+		return end, nil
+	}
+}
+
+// quoteScalar 按原有风格输出标量
+func quoteScalar(value string, style yaml.Style) string {
+	switch {
+	case style&yaml.DoubleQuotedStyle != 0:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+	case style&yaml.SingleQuotedStyle != 0:
+		return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	default:
+		return value
+	}
+}
+
+// encode 重新序列化所有文档
+func (f *File) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	for i, doc := range f.Docs {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		data, err := encodeDoc(doc)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeDoc 序列化单个文档
+func encodeDoc(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, fmt.Errorf("序列化YAML文档失败: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("序列化YAML文档失败: %v", err)
+	}
+	return buf.Bytes(), nil
+}
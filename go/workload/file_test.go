@@ -0,0 +1,209 @@
+package workload
+
+import (
+	"gopkg.in/yaml.v3"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBytesPreservesFormatting(t *testing.T) {
+	source := `# 顶部注释
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: demo   # 行尾注释
+  labels: &labels
+    app: demo
+spec:
+  selector:
+    matchLabels: *labels
+  template:
+    metadata:
+      labels: *labels
+    spec:
+      initContainers:
+        - name: init
+          image: "registry.local/demo/init:1"  # 双引号
+      containers:
+        - name: main
+          image: 'registry.local/demo/main:1'
+        - {name: side, image: registry.local/demo/side:1, imagePullPolicy: Always}
+        - name: 中文
+          image: registry.local/demo/zh:1 # 中文注释
+---
+# 第二个文档
+apiVersion: v1
+kind: Pod
+spec:
+  containers:
+    - image: registry.local/demo/pod:1
+`
+	f, err := Parse([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := f.AllImages(nil)
+	if len(fields) != 5 {
+		t.Fatalf("期望 5 个镜像字段，得到 %d", len(fields))
+	}
+	for _, field := range fields {
+		field.Set(strings.Replace(field.Value, "registry.local", "harbor.local", 1))
+	}
+
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.ReplaceAll(source, "registry.local", "harbor.local")
+	if string(data) != want {
+		t.Fatalf("输出与期望不一致:\n%s", data)
+	}
+}
+
+func TestBytesPreservesAnchorsAndTags(t *testing.T) {
+	source := `kind: Pod
+spec:
+  containers:
+    - name: a
+      image: &img registry.local/demo/app:1
+    - name: b
+      image: *img
+    - name: c
+      image: !!str "registry.local/demo/tagged:1"  # 标签
+    - name: d
+      image: &both !!str 'registry.local/demo/both:1'
+`
+	f, err := Parse([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range f.AllImages(nil) {
+		field.Set(strings.Replace(field.Value, "registry.local", "harbor.local", 1))
+	}
+
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.ReplaceAll(source, "registry.local", "harbor.local")
+	if string(data) != want {
+		t.Fatalf("输出与期望不一致:\n%s", data)
+	}
+
+	reparsed, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var images []string
+	for _, field := range reparsed.AllImages(nil) {
+		images = append(images, field.Value)
+	}
+	if got := strings.Join(images, ","); got != "harbor.local/demo/app:1,harbor.local/demo/app:1,harbor.local/demo/tagged:1,harbor.local/demo/both:1" {
+		t.Errorf("重新解析后的镜像不正确: %s", got)
+	}
+}
+
+func TestBytesUnchanged(t *testing.T) {
+	source, err := os.ReadFile("../backend-portal-front.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 设置为相同的值不算修改
+	for _, field := range f.AllImages(nil) {
+		field.Set(field.Value)
+	}
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(source) {
+		t.Fatal("未修改镜像时输出应与原文一致")
+	}
+}
+
+func TestBytesBlockScalarFallback(t *testing.T) {
+	f, err := Parse([]byte(`kind: Pod
+spec:
+  containers:
+    - image: >-
+        registry.local/demo/app:1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := f.AllImages(nil)
+	if len(fields) != 1 || fields[0].Value != "registry.local/demo/app:1" {
+		t.Fatalf("字段不正确: %+v", fields)
+	}
+	fields[0].Set("harbor.local/demo/app:1")
+
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reparsed, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reparsed.AllImages(nil)[0].Value; got != "harbor.local/demo/app:1" {
+		t.Fatalf("回退序列化后镜像不正确: %s", got)
+	}
+}
+
+func TestBytesModifiedDocument(t *testing.T) {
+	source := `# 第一个文档
+kind: ConfigMap
+data:
+  a: "1"   # 保留
+---
+# 第二个文档
+kind: Pod
+spec:
+  containers:
+    - image: registry.local/demo/pod:1
+`
+	f, err := Parse([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.AllImages(nil)[0].Set("harbor.local/demo/pod:1")
+
+	// 第二个文档新增字段，需要重新序列化
+	pod := f.Docs[1]
+	spec := Get(pod.Content[0], "spec")
+	spec.Content = append(spec.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: "restartPolicy"},
+		&yaml.Node{Kind: yaml.ScalarNode, Value: "Never"})
+	f.MarkModified(pod)
+	f.Append(&yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: "kind"}, {Kind: yaml.ScalarNode, Value: "Secret"},
+	}})
+
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# 第一个文档
+kind: ConfigMap
+data:
+  a: "1"   # 保留
+---
+# 第二个文档
+kind: Pod
+spec:
+  containers:
+    - image: harbor.local/demo/pod:1
+  restartPolicy: Never
+---
+kind: Secret
+`
+	if string(data) != want {
+		t.Fatalf("输出与期望不一致:\n%s", data)
+	}
+}
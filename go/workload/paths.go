@@ -0,0 +1,166 @@
+package workload
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// PathRule 描述某类自定义资源中镜像所在的字段
+type PathRule struct {
+	// APIVersion 为空时匹配任意版本，group/* 匹配该 group 下的所有版本
+	APIVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Paths      []string `yaml:"paths"`
+
+	compiled [][]segment
+}
+
+// PathRules 自定义资源的镜像字段规则
+type PathRules struct {
+	Resources []*PathRule `yaml:"resources"`
+}
+
+// segment 字段路径中的一段，如 containers[*] 或 image
+type segment struct {
+	key   string
+	index int  // 下标，-1 表示不取下标
+	all   bool // [*]
+}
+
+// LoadPathRules 从 yaml 文件加载镜像字段规则
+func LoadPathRules(path string) (*PathRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取镜像字段规则文件失败: %v", err)
+	}
+	var rules PathRules
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("解析镜像字段规则文件 %s 失败: %v", path, err)
+	}
+	if err := rules.Compile(); err != nil {
+		return nil, fmt.Errorf("镜像字段规则文件 %s 无效: %v", path, err)
+	}
+	return &rules, nil
+}
+
+// Compile 校验并解析所有字段路径
+func (r *PathRules) Compile() error {
+	for i, rule := range r.Resources {
+		if rule.Kind == "" {
+			return fmt.Errorf("第 %d 条规则缺少 kind", i+1)
+		}
+		if len(rule.Paths) == 0 {
+			return fmt.Errorf("第 %d 条规则 (%s) 缺少 paths", i+1, rule.Kind)
+		}
+		rule.compiled = nil
+		for _, path := range rule.Paths {
+			segments, err := parsePath(path)
+			if err != nil {
+				return fmt.Errorf("第 %d 条规则 (%s): %v", i+1, rule.Kind, err)
+			}
+			rule.compiled = append(rule.compiled, segments)
+		}
+	}
+	return nil
+}
+
+// match 判断规则是否适用于对象
+func (r *PathRule) match(obj *yaml.Node) bool {
+	if Kind(obj) != r.Kind {
+		return false
+	}
+	if r.APIVersion == "" {
+		return true
+	}
+	apiVersion := ScalarValue(obj, "apiVersion")
+	if group, ok := strings.CutSuffix(r.APIVersion, "/*"); ok {
+		return strings.HasPrefix(apiVersion, group+"/")
+	}
+	return apiVersion == r.APIVersion
+}
+
+// parsePath 解析 spec.template.spec.containers[*].image 形式的路径，允许以 $. 或 . 开头
+func parsePath(path string) ([]segment, error) {
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(path), "$"), ".")
+	if trimmed == "" {
+		return nil, fmt.Errorf("字段路径为空")
+	}
+
+	var segments []segment
+	for _, part := range strings.Split(trimmed, ".") {
+		seg := segment{index: -1}
+		if open := strings.Index(part, "["); open >= 0 {
+			if !strings.HasSuffix(part, "]") {
+				return nil, fmt.Errorf("字段路径 %s 中的下标格式错误", path)
+			}
+			inner := part[open+1 : len(part)-1]
+			seg.key = part[:open]
+			if inner == "*" {
+				seg.all = true
+			} else {
+				n, err := strconv.Atoi(inner)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("字段路径 %s 中的下标 %s 无效", path, inner)
+				}
+				seg.index = n
+			}
+		} else {
+			seg.key = part
+		}
+		if seg.key == "" {
+			return nil, fmt.Errorf("字段路径 %s 中存在空字段名", path)
+		}
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
+
+// collect 沿路径查找字符串字段，找到的每个字段都以 ImageField 返回
+func (f *File) collect(node *yaml.Node, segments []segment, prefix string, fields *[]*ImageField) {
+	seg := segments[0]
+	rest := segments[1:]
+	path := joinPath(prefix, seg.key)
+	value := Get(node, seg.key)
+	if value == nil {
+		return
+	}
+
+	if seg.index < 0 && !seg.all {
+		if len(rest) == 0 {
+			if value.Kind == yaml.ScalarNode {
+				*fields = append(*fields, &ImageField{Path: path, Value: value.Value, node: value, file: f})
+			}
+			return
+		}
+		f.collect(value, rest, path, fields)
+		return
+	}
+
+	if value.Kind != yaml.SequenceNode {
+		return
+	}
+	for i, item := range value.Content {
+		if !seg.all && i != seg.index {
+			continue
+		}
+		item = resolve(item)
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		if len(rest) == 0 {
+			if item.Kind == yaml.ScalarNode {
+				*fields = append(*fields, &ImageField{Path: itemPath, Value: item.Value, node: item, file: f})
+			}
+			continue
+		}
+		f.collect(item, rest, itemPath, fields)
+	}
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
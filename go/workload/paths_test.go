@@ -0,0 +1,88 @@
+package workload
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImagesWithPathRules(t *testing.T) {
+	rules, err := LoadPathRules("../image-paths.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Parse([]byte(`apiVersion: tekton.dev/v1
+kind: Task
+spec:
+  steps:
+    - name: build
+      image: registry.local/ci/builder:1
+    - name: push
+      image: registry.local/ci/pusher:1
+  sidecars:
+    - image: registry.local/ci/docker:dind
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := f.Objects()[0]
+
+	fields := f.Images(obj, rules)
+	if len(fields) != 3 {
+		t.Fatalf("期望 3 个镜像字段，得到 %d", len(fields))
+	}
+	if fields[1].Path != "spec.steps[1].image" || fields[1].Value != "registry.local/ci/pusher:1" {
+		t.Fatalf("字段不正确: %+v", fields[1])
+	}
+
+	fields[1].Set("harbor.local/ci/pusher:1")
+	if got := ScalarValue(Get(obj, "spec").Content[1].Content[1], "image"); got != "harbor.local/ci/pusher:1" {
+		t.Fatalf("Set 未修改文档: %v", got)
+	}
+
+	// apiVersion 不匹配的同名资源不处理
+	Get(obj, "apiVersion").Value = "other.io/v1"
+	if fields := f.Images(obj, rules); len(fields) != 0 {
+		t.Fatalf("apiVersion 不匹配时不应返回字段: %d", len(fields))
+	}
+}
+
+func TestImagesScalarPaths(t *testing.T) {
+	rules := &PathRules{Resources: []*PathRule{{
+		Kind:  "Operator",
+		Paths: []string{"$.spec.image", "spec.images[0]"},
+	}}}
+	if err := rules.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Parse([]byte(`kind: Operator
+spec:
+  image: registry.local/op/app:1
+  images: [registry.local/op/a:1, registry.local/op/b:1]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := f.AllImages(rules)
+	if len(fields) != 2 || fields[0].Path != "spec.image" || fields[1].Path != "spec.images[0]" {
+		t.Fatalf("字段不正确: %+v", fields)
+	}
+	fields[1].Set("harbor.local/op/a:1")
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "images: [harbor.local/op/a:1, registry.local/op/b:1]") {
+		t.Fatalf("Set 未修改数组元素:\n%s", data)
+	}
+}
+
+func TestPathRulesInvalid(t *testing.T) {
+	for _, path := range []string{"", "spec.containers[x].image", "spec..image", "spec.containers[*"} {
+		rules := &PathRules{Resources: []*PathRule{{Kind: "Foo", Paths: []string{path}}}}
+		if err := rules.Compile(); err == nil {
+			t.Errorf("路径 %q 期望校验失败", path)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package workload
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+// AddPullSecret 在每个内置工作负载的 pod spec 的 imagePullSecrets 中加入 name，
+// 已有同名条目的跳过，返回修改过的对象。修改过的文档写回时重新序列化
+func (f *File) AddPullSecret(name string) []*yaml.Node {
+	var modified []*yaml.Node
+	for _, doc := range f.Docs {
+		if len(doc.Content) == 0 {
+			continue
+		}
+		for _, obj := range flatten(doc.Content[0]) {
+			podSpec := PodSpec(obj)
+			if podSpec == nil || hasPullSecret(podSpec, name) {
+				continue
+			}
+			secrets := Get(podSpec, "imagePullSecrets")
+			if secrets == nil || secrets.Kind != yaml.SequenceNode {
+				secrets = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+				setField(podSpec, "imagePullSecrets", secrets)
+			}
+			secrets.Content = append(secrets.Content, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Tag: "!!str", Value: "name"},
+				{Kind: yaml.ScalarNode, Tag: "!!str", Value: name},
+			}})
+			f.MarkModified(doc)
+			modified = append(modified, obj)
+		}
+	}
+	return modified
+}
+
+func hasPullSecret(podSpec *yaml.Node, name string) bool {
+	secrets := Get(podSpec, "imagePullSecrets")
+	if secrets == nil || secrets.Kind != yaml.SequenceNode {
+		return false
+	}
+	for _, secret := range secrets.Content {
+		if ScalarValue(secret, "name") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// setField 设置映射节点中的字段，已存在时替换其值
+func setField(node *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = value
+			return
+		}
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
@@ -0,0 +1,83 @@
+package workload
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddPullSecret(t *testing.T) {
+	const source = `# 前端
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: dockerhub.cestc.local/app/web:1.0
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: report
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          imagePullSecrets:
+          - name: harbor-pull
+          containers:
+          - name: report
+            image: dockerhub.cestc.local/app/report:1.0
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: debug
+spec:
+  imagePullSecrets:
+  - name: other
+  containers:
+  - name: debug
+    image: dockerhub.cestc.local/app/debug:1.0
+`
+	file, err := Parse([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := file.AddPullSecret("harbor-pull")
+	if len(modified) != 2 {
+		t.Fatalf("应修改 Deployment 与 Pod，实际 %d 个对象", len(modified))
+	}
+
+	data, err := file.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	if !strings.Contains(out, "# 前端") {
+		t.Error("应保留注释")
+	}
+	if strings.Count(out, "name: harbor-pull") != 3 {
+		t.Errorf("每个 pod spec 应恰好有一个 harbor-pull:\n%s", out)
+	}
+	if !strings.Contains(out, "- name: other\n    - name: harbor-pull") && !strings.Contains(out, "- name: other\n  - name: harbor-pull") {
+		t.Errorf("已有的 imagePullSecrets 应保留并追加:\n%s", out)
+	}
+
+	reparsed, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again := reparsed.AddPullSecret("harbor-pull"); len(again) != 0 {
+		t.Errorf("重复添加不应修改对象: %d", len(again))
+	}
+}
@@ -0,0 +1,158 @@
+package workload
+
+import (
+	"gopkg.in/yaml.v3"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// 疑似密钥的判断依据
+const (
+	ReasonName    = "name"    // 变量名匹配密钥的命名
+	ReasonEntropy = "entropy" // 值是高熵的随机字符串
+)
+
+// secretWords 变量名按 _ - . 分词后出现这些词即视为密钥，如 MYSQL_PWD、REDIS_PASSWORD、GITLAB_TOKEN
+var secretWords = map[string]bool{
+	"PWD": true, "PASS": true, "PASSWD": true, "PASSWORD": true, "PASSPHRASE": true,
+	"SECRET": true, "TOKEN": true, "APIKEY": true, "CREDENTIAL": true, "CREDENTIALS": true,
+}
+
+// secretPairs 相邻两个词组成的密钥命名，如 ACCESS_KEY、PRIVATE_KEY
+var secretPairs = map[string]bool{
+	"API_KEY": true, "ACCESS_KEY": true, "SECRET_KEY": true, "PRIVATE_KEY": true, "AUTH_KEY": true, "ENCRYPT_KEY": true,
+}
+
+// notSecretWords 以这些词结尾的变量保存的是密钥的位置而不是密钥本身，如 PASSWORD_FILE
+var notSecretWords = map[string]bool{"FILE": true, "PATH": true, "DIR": true, "URL": true, "NAME": true, "USER": true, "USERNAME": true}
+
+// 高熵判断：足够长、同时含字母与数字、每个字符的平均信息量足够高
+const (
+	entropyMinLength = 20
+	entropyThreshold = 3.5
+)
+
+var envWordSplit = regexp.MustCompile(`[_.\-]+`)
+
+// ipPrefix 以 IP 地址开头的值，如 192.168.1.6:3306
+var ipPrefix = regexp.MustCompile(`^\d{1,3}(\.\d{1,3}){3}`)
+
+// SecretEnv 容器 env 中以明文写出的疑似密钥
+type SecretEnv struct {
+	Object    *yaml.Node `json:"-"` // 所在对象
+	Container string     `json:"container"`
+	Name      string     `json:"name"`
+	Value     string     `json:"-"`
+	Reason    string     `json:"reason"`
+
+	doc   *yaml.Node
+	entry *yaml.Node // env 列表中的条目
+}
+
+// LooksSecret 按变量名与值判断是否为密钥，返回判断依据
+func LooksSecret(name, value string) (string, bool) {
+	if value == "" || strings.HasPrefix(value, "$(") {
+		return "", false
+	}
+	words := envWordSplit.Split(strings.ToUpper(name), -1)
+	if !notSecretWords[words[len(words)-1]] {
+		for i, word := range words {
+			if secretWords[word] || i > 0 && secretPairs[words[i-1]+"_"+word] {
+				return ReasonName, true
+			}
+		}
+	}
+	if highEntropy(value) {
+		return ReasonEntropy, true
+	}
+	return "", false
+}
+
+// highEntropy 判断值是否像随机生成的密钥，URL、路径、IP 地址与带空格的文本不计入
+func highEntropy(value string) bool {
+	if len(value) < entropyMinLength || strings.Contains(value, "/") || ipPrefix.MatchString(value) {
+		return false
+	}
+	var letters, digits bool
+	counts := make(map[rune]int)
+	for _, r := range value {
+		switch {
+		case unicode.IsSpace(r):
+			return false
+		case unicode.IsLetter(r):
+			letters = true
+		case unicode.IsDigit(r):
+			digits = true
+		}
+		counts[r]++
+	}
+	if !letters || !digits {
+		return false
+	}
+	entropy := 0.0
+	n := float64(len([]rune(value)))
+	for _, count := range counts {
+		p := float64(count) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= entropyThreshold
+}
+
+// FindSecretEnv 查找内置工作负载所有容器中以 value 明文写出的疑似密钥，已经使用 valueFrom 的变量不计入
+func (f *File) FindSecretEnv() []*SecretEnv {
+	var result []*SecretEnv
+	for _, doc := range f.Docs {
+		if len(doc.Content) == 0 {
+			continue
+		}
+		for _, obj := range flatten(doc.Content[0]) {
+			for _, container := range Containers(obj) {
+				env := Get(container, "env")
+				if env == nil || env.Kind != yaml.SequenceNode {
+					continue
+				}
+				for _, entry := range env.Content {
+					value := Get(entry, "value")
+					if entry.Kind != yaml.MappingNode || value == nil || value.Kind != yaml.ScalarNode {
+						continue
+					}
+					name := ScalarValue(entry, "name")
+					if reason, ok := LooksSecret(name, value.Value); ok {
+						result = append(result, &SecretEnv{
+							Object:    obj,
+							Container: ScalarValue(container, "name"),
+							Name:      name,
+							Value:     value.Value,
+							Reason:    reason,
+							doc:       doc,
+							entry:     entry,
+						})
+					}
+				}
+			}
+		}
+	}
+	return result
+}
+
+// MoveToSecret 把变量的值改为引用 Secret secret 中的 key，保留条目上的注释
+func (f *File) MoveToSecret(env *SecretEnv, secret, key string) {
+	ref := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "secretKeyRef"},
+		{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: "name"},
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: secret},
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: "key"},
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		}},
+	}}
+	for i := 0; i+1 < len(env.entry.Content); i += 2 {
+		if env.entry.Content[i].Value == "value" {
+			env.entry.Content[i].Value = "valueFrom"
+			env.entry.Content[i+1] = ref
+		}
+	}
+	f.MarkModified(env.doc)
+}
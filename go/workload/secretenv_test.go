@@ -0,0 +1,103 @@
+package workload
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLooksSecret(t *testing.T) {
+	tests := []struct {
+		name, value string
+		want        string
+	}{
+		{"MYSQL_PWD", "UserPasswordnN57:2", ReasonName},
+		{"REDIS_PWD", "x", ReasonName},
+		{"es.password", "Cestc@123ielastic", ReasonName},
+		{"GITLAB_TOKEN", "abc", ReasonName},
+		{"AWS_SECRET_ACCESS_KEY", "abc", ReasonName},
+		{"OSS_ACCESS_KEY", "abc", ReasonName},
+		{"APP_SIGNATURE", "q8Zr2Lx9Vb4Tn7Km1Wp3Yc6", ReasonEntropy},
+		{"MYSQL_PASSWORD_FILE", "/run/secrets/mysql", ""},
+		{"MYSQL_USERNAME", "root", ""},
+		{"REDIS_PWD", "", ""},
+		{"DB_PASSWORD", "$(MYSQL_PWD)", ""},
+		{"BYPASS_CACHE", "true", ""},
+		{"CACHE_KEY", "portal", ""},
+		{"PORTAL_SERVER", "http://portal.hbgxs.cestcys.cn/a1b2c3d4e5", ""},
+		{"FDFS_TRACK_LIST", "192.168.1.5:22122", ""},
+		{"MYSQL_SERVER", "192.168.1.6:3306/portal", ""},
+		{"KAFKA_BROKERS", "10.100.100.21:9092,10.100.100.22:9092", ""},
+		{"JAVA_OPTS", "-Xms512m -Xmx2048m -Duser.timezone=GMT+08", ""},
+	}
+	for _, tt := range tests {
+		reason, ok := LooksSecret(tt.name, tt.value)
+		if reason != tt.want || ok != (tt.want != "") {
+			t.Errorf("LooksSecret(%q, %q) = %q, %v，期望 %q", tt.name, tt.value, reason, ok, tt.want)
+		}
+	}
+}
+
+func TestMoveSecretEnv(t *testing.T) {
+	const source = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: portal-front
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: dockerhub.cestc.local/app/web:1.0
+        env:
+        - name: ENVIR
+          value: test
+        - name: MYSQL_PWD # 数据库密码
+          value: UserPasswordnN57:2
+        - name: REDIS_PWD
+          valueFrom:
+            secretKeyRef:
+              name: redis
+              key: password
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  DB_PASSWORD: plain
+`
+	file, err := Parse([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	envs := file.FindSecretEnv()
+	if len(envs) != 1 || envs[0].Name != "MYSQL_PWD" || envs[0].Container != "web" || envs[0].Value != "UserPasswordnN57:2" {
+		t.Fatalf("应只发现 MYSQL_PWD: %+v", envs)
+	}
+	if ScalarValue(GetPath(envs[0].Object, "metadata"), "name") != "portal-front" {
+		t.Error("应记录所在对象")
+	}
+
+	file.MoveToSecret(envs[0], "portal-front-secrets", "MYSQL_PWD")
+	data, err := file.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	if strings.Contains(out, "UserPasswordnN57") {
+		t.Errorf("明文密码应被移除:\n%s", out)
+	}
+	for _, want := range []string{"# 数据库密码", "name: portal-front-secrets", "key: MYSQL_PWD", "DB_PASSWORD: plain"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("结果中缺少 %q:\n%s", want, out)
+		}
+	}
+
+	reparsed, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if envs := reparsed.FindSecretEnv(); len(envs) != 0 {
+		t.Errorf("移入 Secret 后不应再发现明文密钥: %+v", envs)
+	}
+}
@@ -0,0 +1,214 @@
+package workload
+
+import (
+	"gopkg.in/yaml.v3"
+	"strings"
+)
+
+// 容器列表所在的字段
+var containerFields = []string{"initContainers", "containers", "ephemeralContainers"}
+
+// 各类内置工作负载中 pod spec 所在的路径
+var podSpecPaths = map[string]string{
+	"Pod":                   "spec",
+	"Deployment":            "spec.template.spec",
+	"StatefulSet":           "spec.template.spec",
+	"DaemonSet":             "spec.template.spec",
+	"ReplicaSet":            "spec.template.spec",
+	"Job":                   "spec.template.spec",
+	"ReplicationController": "spec.template.spec",
+	"CronJob":               "spec.jobTemplate.spec.template.spec",
+	"PodTemplate":           "template.spec",
+}
+
+// ImageField 文档中的一个镜像字段
+type ImageField struct {
+	Path  string // 字段路径，如 spec.template.spec.containers[0].image
+	Value string
+
+	node *yaml.Node
+	file *File
+}
+
+// Set 修改文档中该字段的值，写回时只替换这个标量，保留原有的引号风格
+func (f *ImageField) Set(image string) {
+	f.Value = image
+	f.file.Set(f.node, image)
+}
+
+// Kind 返回对象的 kind
+func Kind(obj *yaml.Node) string {
+	return ScalarValue(obj, "kind")
+}
+
+// ScalarValue 返回映射节点中某个标量字段的值，不存在时返回空字符串
+func ScalarValue(obj *yaml.Node, key string) string {
+	if value := Get(obj, key); value != nil && value.Kind == yaml.ScalarNode {
+		return value.Value
+	}
+	return ""
+}
+
+// Get 返回映射节点中 key 对应的值节点，自动解析别名
+func Get(node *yaml.Node, key string) *yaml.Node {
+	node = resolve(node)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return resolve(node.Content[i+1])
+		}
+	}
+	return nil
+}
+
+// GetPath 沿 . 分隔的路径逐层取值
+func GetPath(node *yaml.Node, path string) *yaml.Node {
+	for _, key := range strings.Split(path, ".") {
+		node = Get(node, key)
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// PodSpec 返回内置工作负载中的 pod spec 节点，不包含 pod 的对象返回 nil
+func PodSpec(obj *yaml.Node) *yaml.Node {
+	path, ok := podSpecPaths[Kind(obj)]
+	if !ok {
+		return nil
+	}
+	podSpec := GetPath(obj, path)
+	if podSpec == nil || podSpec.Kind != yaml.MappingNode {
+		return nil
+	}
+	return podSpec
+}
+
+// Containers 返回对象中 initContainers、containers、ephemeralContainers 下的所有容器节点
+func Containers(obj *yaml.Node) []*yaml.Node {
+	podSpec := PodSpec(obj)
+	if podSpec == nil {
+		return nil
+	}
+
+	var result []*yaml.Node
+	for _, field := range containerFields {
+		containers := Get(podSpec, field)
+		if containers == nil || containers.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, container := range containers.Content {
+			if container = resolve(container); container.Kind == yaml.MappingNode {
+				result = append(result, container)
+			}
+		}
+	}
+	return result
+}
+
+// Images 返回对象中的所有镜像字段：内置工作负载的容器镜像，以及 rules 中为自定义资源配置的字段
+func (f *File) Images(obj *yaml.Node, rules *PathRules) []*ImageField {
+	var fields []*ImageField
+
+	if prefix, ok := podSpecPaths[Kind(obj)]; ok {
+		for _, field := range containerFields {
+			segments, _ := parsePath(prefix + "." + field + "[*].image")
+			f.collect(obj, segments, "", &fields)
+		}
+	}
+
+	if rules != nil {
+		for _, rule := range rules.Resources {
+			if !rule.match(obj) {
+				continue
+			}
+			for _, segments := range rule.compiled {
+				f.collect(obj, segments, "", &fields)
+			}
+		}
+	}
+
+	// 自定义规则可能与内置路径重叠，按路径去重
+	seen := make(map[string]bool)
+	result := fields[:0]
+	for _, field := range fields {
+		if !seen[field.Path] {
+			seen[field.Path] = true
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+// AllImages 返回文件中所有对象的镜像字段，docker compose 文件返回 services.*.image
+func (f *File) AllImages(rules *PathRules) []*ImageField {
+	if f.IsCompose() {
+		return f.ComposeImages()
+	}
+	var fields []*ImageField
+	for _, obj := range f.Objects() {
+		fields = append(fields, f.Images(obj, rules)...)
+	}
+	return fields
+}
+
+// Objects 返回文件中的所有对象，kind: List（以及 DeploymentList 等 *List）中的 items 会被展开
+func (f *File) Objects() []*yaml.Node {
+	var result []*yaml.Node
+	for _, doc := range f.Docs {
+		if len(doc.Content) > 0 {
+			result = append(result, flatten(doc.Content[0])...)
+		}
+	}
+	return result
+}
+
+func flatten(obj *yaml.Node) []*yaml.Node {
+	obj = resolve(obj)
+	if obj == nil || obj.Kind != yaml.MappingNode {
+		return nil
+	}
+	items := Get(obj, "items")
+	if items == nil || items.Kind != yaml.SequenceNode || !strings.HasSuffix(Kind(obj), "List") {
+		return []*yaml.Node{obj}
+	}
+	var result []*yaml.Node
+	for _, item := range items.Content {
+		result = append(result, flatten(item)...)
+	}
+	return result
+}
+
+// resolve 将别名节点解析为其锚点节点
+func resolve(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// DockerHubRegistry 未写仓库主机的镜像（如 nginx、bitnami/nginx）实际拉取的仓库
+const DockerHubRegistry = "registry-1.docker.io"
+
+// NormalizeImage 补全 Docker Hub 的简写：没有仓库主机的镜像加上 DockerHubRegistry，
+// 单段名称加上 library/，docker.io 与 index.docker.io 统一为 DockerHubRegistry。
+// 第一段含 . 或 :，或为 localhost 时视为仓库主机，原样返回
+func NormalizeImage(image string) string {
+	host, rest, ok := strings.Cut(image, "/")
+	switch {
+	case !ok:
+		return DockerHubRegistry + "/library/" + image
+	case host == "docker.io" || host == "index.docker.io" || host == DockerHubRegistry:
+		if !strings.Contains(rest, "/") {
+			rest = "library/" + rest
+		}
+		return DockerHubRegistry + "/" + rest
+	case strings.ContainsAny(host, ".:") || host == "localhost":
+		return image
+	default:
+		return DockerHubRegistry + "/" + image
+	}
+}
@@ -0,0 +1,111 @@
+package workload
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+const allKinds = `
+apiVersion: v1
+kind: Pod
+spec:
+  initContainers:
+    - name: init
+      image: registry.local/pod/init:1
+  containers:
+    - name: main
+      image: registry.local/pod/main:1
+  ephemeralContainers:
+    - name: debug
+      image: registry.local/pod/debug:1
+---
+apiVersion: apps/v1
+kind: StatefulSet
+spec:
+  template:
+    spec:
+      containers:
+        - image: registry.local/sts/app:1
+---
+apiVersion: batch/v1
+kind: CronJob
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+            - image: registry.local/cron/app:1
+---
+apiVersion: v1
+kind: List
+items:
+  - apiVersion: apps/v1
+    kind: DaemonSet
+    spec:
+      template:
+        spec:
+          containers:
+            - image: registry.local/ds/app:1
+  - apiVersion: v1
+    kind: List
+    items:
+      - apiVersion: batch/v1
+        kind: Job
+        spec:
+          template:
+            spec:
+              initContainers:
+                - image: registry.local/job/init:1
+---
+apiVersion: v1
+kind: ConfigMap
+data:
+  image: registry.local/not/an-image:1
+`
+
+func TestContainers(t *testing.T) {
+	f, err := Parse([]byte(allKinds))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var images []string
+	for _, obj := range f.Objects() {
+		for _, container := range Containers(obj) {
+			images = append(images, ScalarValue(container, "image"))
+		}
+	}
+	sort.Strings(images)
+
+	want := []string{
+		"registry.local/cron/app:1",
+		"registry.local/ds/app:1",
+		"registry.local/job/init:1",
+		"registry.local/pod/debug:1",
+		"registry.local/pod/init:1",
+		"registry.local/pod/main:1",
+		"registry.local/sts/app:1",
+	}
+	if strings.Join(images, ",") != strings.Join(want, ",") {
+		t.Fatalf("镜像列表不正确:\n得到 %v\n期望 %v", images, want)
+	}
+}
+
+func TestNormalizeImage(t *testing.T) {
+	tests := map[string]string{
+		"nginx:1.25":                      "registry-1.docker.io/library/nginx:1.25",
+		"bitnami/nginx:1.25":              "registry-1.docker.io/bitnami/nginx:1.25",
+		"docker.io/nginx:1.25":            "registry-1.docker.io/library/nginx:1.25",
+		"index.docker.io/bitnami/nginx:1": "registry-1.docker.io/bitnami/nginx:1",
+		"registry.local/demo/app:1.0":     "registry.local/demo/app:1.0",
+		"10.100.100.21:10080/demo/app:1":  "10.100.100.21:10080/demo/app:1",
+		"localhost/app:1":                 "localhost/app:1",
+	}
+	for image, want := range tests {
+		if got := NormalizeImage(image); got != want {
+			t.Errorf("NormalizeImage(%q) = %q，期望 %q", image, got, want)
+		}
+	}
+}